@@ -0,0 +1,91 @@
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// Defaults applied to anything left unset on an app bundle, once its base has been merged in.
+const (
+	// DefaultPullPolicy is the pull policy of the image.
+	DefaultPullPolicy = v1.PullAlways
+	// DefaultRouteProtocol is the protocol of every route.
+	DefaultRouteProtocol = v1.ProtocolTCP
+	// DefaultIngressAuth is whether ingresses are put behind the auth middleware.
+	DefaultIngressAuth = false
+	// DefaultBackupRetain is the number of longhorn backups kept.
+	DefaultBackupRetain = 7
+	// DefaultWorkloadKind is the kind of workload running the container.
+	DefaultWorkloadKind = WorkloadKindDeployment
+	// DefaultAntiAffinity is how strictly the replicas are kept off the same node.
+	DefaultAntiAffinity = AntiAffinityRequired
+)
+
+// Default fills in every unset field that has a documented default, the service type comes from the operator-wide config.
+// The reconciler applies it in memory once the base is merged in. Only the constant defaults (see DefaultStatic) are also written to the stored app bundle,
+// by the defaulting webhook; the service type is not, so a later change to the config still applies.
+func (ab *AppBundle) Default(cfg *AtrokConfigSpec) {
+	ab.Spec.Default(cfg)
+}
+
+// Default fills in every unset field of the spec that has a documented default, see AppBundle.Default.
+func (spec *AppBundleSpec) Default(cfg *AtrokConfigSpec) {
+	if cfg == nil {
+		defaults := DefaultAtrokConfigSpec()
+		cfg = &defaults
+	}
+
+	spec.DefaultStatic()
+
+	if spec.ServiceType == nil && cfg.ServiceType != nil {
+		serviceType := *cfg.ServiceType
+		spec.ServiceType = &serviceType
+	}
+
+	if spec.Workload == nil || spec.Workload.Kind == nil {
+		workload := &AppBundleWorkload{}
+		if spec.Workload != nil {
+			workload = spec.Workload.DeepCopy()
+		}
+		kind := DefaultWorkloadKind
+		workload.Kind = &kind
+		spec.Workload = workload
+	}
+
+	if spec.Scheduling == nil || spec.Scheduling.AntiAffinity == nil {
+		scheduling := &AppBundleScheduling{}
+		if spec.Scheduling != nil {
+			scheduling = spec.Scheduling.DeepCopy()
+		}
+		antiAffinity := DefaultAntiAffinity
+		scheduling.AntiAffinity = &antiAffinity
+		spec.Scheduling = scheduling
+	}
+}
+
+// DefaultStatic fills in the unset fields whose default is a constant: the pull policy, the protocol and ingress auth of the routes and the backups retained.
+// These are what the defaulting webhook writes to app bundles without a base.
+func (spec *AppBundleSpec) DefaultStatic() {
+	if spec.Image != nil && spec.Image.PullPolicy == nil {
+		pullPolicy := DefaultPullPolicy
+		spec.Image.PullPolicy = &pullPolicy
+	}
+
+	for key, route := range spec.Routes {
+		if route.Protocol == nil {
+			protocol := DefaultRouteProtocol
+			route.Protocol = &protocol
+		}
+		if route.Ingress != nil && route.Ingress.Auth == nil {
+			ingress := *route.Ingress
+			auth := DefaultIngressAuth
+			ingress.Auth = &auth
+			route.Ingress = &ingress
+		}
+		spec.Routes[key] = route
+	}
+
+	if spec.Backup != nil && spec.Backup.Retain == nil {
+		retain := DefaultBackupRetain
+		spec.Backup.Retain = &retain
+	}
+}
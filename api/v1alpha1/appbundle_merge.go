@@ -0,0 +1,201 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"dario.cat/mergo"
+)
+
+// MergeStrategy decides how a field set on an AppBundle (or AppBundleBase) combines with the value it inherits from its base.
+// +kubebuilder:validation:Enum=Merge;Replace;Append
+type MergeStrategy string
+
+const (
+	// MergeStrategyMerge combines the values: maps keep inherited keys and entries under the same key are merged with the nearer one winning,
+	// objects have their unset fields filled in from the inherited one. The default for maps and objects.
+	MergeStrategyMerge MergeStrategy = "Merge"
+	// MergeStrategyReplace uses the value as it is, ignoring the inherited one. The default for lists and plain values.
+	MergeStrategyReplace MergeStrategy = "Replace"
+	// MergeStrategyAppend puts the items of a list after the inherited ones. Only valid for lists.
+	MergeStrategyAppend MergeStrategy = "Append"
+)
+
+// AppBundleMerge controls how the spec it is part of combines with the spec inherited from the base.
+type AppBundleMerge struct {
+	// Strategies maps a field of the spec by its json name, e.g. "envs" or "command", to how it combines with the inherited value.
+	Strategies map[string]MergeStrategy `json:"strategies,omitempty"`
+	// Delete lists inherited map entries to drop, keyed by the field they are in, e.g. {"envs": ["DEBUG"], "routes": ["metrics"]}.
+	Delete map[string][]string `json:"delete,omitempty"`
+}
+
+// nonMergeableFields are the fields of the spec that describe the inheritance itself rather than what is inherited.
+var nonMergeableFields = []string{"base", "merge"}
+
+// GetMergeableFieldKinds returns the kind of every field of the spec that takes part in merging, keyed by json name.
+// Pointers to maps are reported as maps and pointers to structs as structs.
+func GetMergeableFieldKinds() map[string]reflect.Kind {
+	kinds := map[string]reflect.Kind{}
+	specType := reflect.TypeOf(AppBundleSpec{})
+	for i := 0; i < specType.NumField(); i++ {
+		name := jsonName(specType.Field(i))
+		if slices.Contains(nonMergeableFields, name) {
+			continue
+		}
+
+		fieldType := specType.Field(i).Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		kinds[name] = fieldType.Kind()
+	}
+
+	return kinds
+}
+
+// GetDefaultMergeStrategy returns the strategy used for fields of the given kind when none is set.
+func GetDefaultMergeStrategy(kind reflect.Kind) MergeStrategy {
+	switch kind {
+	case reflect.Map, reflect.Struct:
+		return MergeStrategyMerge
+	default:
+		return MergeStrategyReplace
+	}
+}
+
+// IsMergeStrategyAllowed reports whether the strategy can be used for a field of the given kind.
+func IsMergeStrategyAllowed(strategy MergeStrategy, kind reflect.Kind) bool {
+	switch strategy {
+	case MergeStrategyReplace:
+		return true
+	case MergeStrategyMerge:
+		return kind == reflect.Map || kind == reflect.Struct
+	case MergeStrategyAppend:
+		return kind == reflect.Slice
+	default:
+		return false
+	}
+}
+
+// MergeAppBundleSpecs returns the spec resulting from layering spec over the inherited one, following the merge section of spec.
+// Neither argument is modified. The base and merge section of the result are those of spec.
+func MergeAppBundleSpecs(inherited, spec *AppBundleSpec) (*AppBundleSpec, error) {
+	merged := inherited.DeepCopy()
+	layer := spec.DeepCopy()
+
+	var strategies map[string]MergeStrategy
+	var deletions map[string][]string
+	if layer.Merge != nil {
+		strategies = layer.Merge.Strategies
+		deletions = layer.Merge.Delete
+	}
+
+	mergedValue := reflect.ValueOf(merged).Elem()
+	layerValue := reflect.ValueOf(layer).Elem()
+	for i := 0; i < mergedValue.NumField(); i++ {
+		name := jsonName(mergedValue.Type().Field(i))
+		dst := mergedValue.Field(i)
+		src := layerValue.Field(i)
+
+		if slices.Contains(nonMergeableFields, name) {
+			dst.Set(src)
+			continue
+		}
+
+		if keys, ok := deletions[name]; ok {
+			deleteMapKeys(dst, keys)
+		}
+
+		if src.IsZero() {
+			continue
+		}
+
+		kind := src.Type().Kind()
+		if kind == reflect.Pointer {
+			kind = src.Type().Elem().Kind()
+		}
+
+		strategy, ok := strategies[name]
+		if !ok {
+			strategy = GetDefaultMergeStrategy(kind)
+		}
+		if !IsMergeStrategyAllowed(strategy, kind) {
+			return nil, fmt.Errorf("merge strategy %s can not be used for %s", strategy, name)
+		}
+
+		if dst.IsZero() || strategy == MergeStrategyReplace {
+			dst.Set(src)
+			continue
+		}
+
+		switch strategy {
+		case MergeStrategyAppend:
+			dst.Set(reflect.AppendSlice(dst, src))
+		case MergeStrategyMerge:
+			if kind == reflect.Map {
+				if err := mergeMaps(dst, src); err != nil {
+					return nil, fmt.Errorf("failed to merge %s: %w", name, err)
+				}
+				continue
+			}
+
+			// Fill in what the nearer object leaves unset from the inherited one
+			if err := mergo.Merge(src.Interface(), dst.Interface()); err != nil {
+				return nil, fmt.Errorf("failed to merge %s: %w", name, err)
+			}
+			dst.Set(src)
+		}
+	}
+
+	return merged, nil
+}
+
+// mergeMaps sets every entry of src on dst (which may be a pointer to a map), merging entries present in both with the one from src winning.
+func mergeMaps(dst, src reflect.Value) error {
+	if dst.Kind() == reflect.Pointer {
+		dst = dst.Elem()
+		src = src.Elem()
+	}
+	if dst.IsNil() {
+		dst.Set(src)
+		return nil
+	}
+
+	for _, key := range src.MapKeys() {
+		value := src.MapIndex(key)
+		if existing := dst.MapIndex(key); existing.IsValid() && value.Kind() == reflect.Struct {
+			merged := reflect.New(value.Type())
+			merged.Elem().Set(value)
+			if err := mergo.Merge(merged.Interface(), existing.Interface()); err != nil {
+				return err
+			}
+			value = merged.Elem()
+		}
+		dst.SetMapIndex(key, value)
+	}
+
+	return nil
+}
+
+// deleteMapKeys removes the keys from the map (or pointer to a map), anything else is left alone.
+func deleteMapKeys(value reflect.Value, keys []string) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Map || value.IsNil() {
+		return
+	}
+
+	for _, key := range keys {
+		value.SetMapIndex(reflect.ValueOf(key), reflect.Value{})
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
@@ -2,13 +2,16 @@
 package v1alpha1
 
 import (
-	"reflect"
+	"maps"
 
-	"dario.cat/mergo"
 	"github.com/rxwycdh/rxhash"
 
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // AppBundleSpec defines the desired state of AppBundle, its the core of the AppBundle (minus metadata etc.)
@@ -16,8 +19,10 @@ type AppBundleSpec struct {
 	Base           *string                        `json:"base,omitempty"`
 	Image          *AppBundleImage                `json:"image,omitempty"`
 	NodeSelector   *map[string]string             `json:"nodeSelector,omitempty"`
-	UseNvidia      *bool                          `json:"useNvidia,omitempty"`
+	Scheduling     *AppBundleScheduling           `json:"scheduling,omitempty"`
 	Replicas       *int32                         `json:"replicas,omitempty"`
+	Workload       *AppBundleWorkload             `json:"workload,omitempty"`
+	Strategy       *AppBundleStrategy             `json:"strategy,omitempty"`
 	Resources      *v1.ResourceRequirements       `json:"resources,omitempty"`
 	Envs           map[string]string              `json:"envs,omitempty"`
 	SecretStoreRef *string                        `json:"secretStoreRef,omitempty"`
@@ -35,38 +40,24 @@ type AppBundleSpec struct {
 	Command        []*string                      `json:"command,omitempty"`
 	Args           []*string                      `json:"args,omitempty"`
 	Configs        map[string]AppBundleConfig     `json:"configs,omitempty"`
-}
-
-func MergeDictValues(dst, src interface{}) (interface{}, error) {
-	switch dstV := dst.(type) {
-	case string:
-		if dstV == "" {
-			return src.(string), nil
-		}
-		return dstV, nil
-	case AppBundleVolume:
-		if err := mergo.Merge(&dstV, src.(AppBundleVolume)); err != nil {
-			return nil, err
-		}
-		return dstV, nil
-	case AppBundleConfig:
-		if err := mergo.Merge(&dstV, src.(AppBundleConfig)); err != nil {
-			return nil, err
-		}
-		return dstV, nil
-	case AppBundleRoute:
-		if err := mergo.Merge(&dstV, src.(AppBundleRoute)); err != nil {
-			return nil, err
-		}
-		return dstV, nil
-	case AppBundleSourcedEnv:
-		if err := mergo.Merge(&dstV, src.(AppBundleSourcedEnv)); err != nil {
-			return nil, err
-		}
-		return dstV, nil
-	default:
-		panic("Unsupported type, the types passed in are (dst,src) = " + reflect.TypeOf(dst).String() + " and " + reflect.TypeOf(src).String())
-	}
+	// Sidecars are extra containers run in the pod next to the one of the app bundle, keyed by container name.
+	Sidecars map[string]AppBundleSidecar `json:"sidecars,omitempty"`
+	// InitContainers run one after the other, in the order listed, before the containers of the pod start.
+	// They run after the containers copying over configs, so the configs are already in place.
+	InitContainers []AppBundleInitContainer `json:"initContainers,omitempty"`
+	// UseNvidia sets the pods up as the nvidia.com/gpu profile of the AtrokConfig says, without requesting any gpus, and makes every gpu visible.
+	//
+	// Deprecated: use Accelerators with the nvidia.com/gpu resource instead.
+	UseNvidia *bool `json:"useNvidia,omitempty"`
+	// Accelerators are the extended resources the container of the app bundle requests, keyed by resource name (e.g. nvidia.com/gpu).
+	// The pods also get the runtime class, tolerations and node labels of the profile for the resource in the AtrokConfig, if there is one.
+	Accelerators map[string]AppBundleAccelerator `json:"accelerators,omitempty"`
+	// Security is the security context of the pods, without it they run with none.
+	Security *AppBundleSecurity `json:"security,omitempty"`
+	// ServiceAccount makes the pods run under a service account of their own, granted the roles it lists, rather than the default one of the namespace.
+	ServiceAccount *AppBundleServiceAccount `json:"serviceAccount,omitempty"`
+	// Merge controls how this spec combines with the one inherited from the base.
+	Merge *AppBundleMerge `json:"merge,omitempty"`
 }
 
 // func (s AppBundleConfigs) Less(i, j int) bool {
@@ -101,6 +92,55 @@ type AppBundleImage struct {
 	Repository *string        `json:"repository,omitempty"`
 	Tag        *string        `json:"tag,omitempty"`
 	PullPolicy *v1.PullPolicy `json:"pullPolicy,omitempty"`
+	// PullSecrets are the names of secrets the pods pull their images with, in place of the image pull secrets of the AtrokConfig.
+	// Only read from the image of the app bundle, as the pods pull the images of all their containers with the same secrets.
+	PullSecrets []string `json:"pullSecrets,omitempty"`
+	// Registry has a pull secret generated from credentials in the secret store of the app bundle, used along with PullSecrets.
+	// Only read from the image of the app bundle, as with PullSecrets.
+	Registry *AppBundleImageRegistry `json:"registry,omitempty"`
+}
+
+// AppBundleImageRegistry are the credentials of an image registry, generated into a kubernetes.io/dockerconfigjson secret through an ExternalSecret.
+type AppBundleImageRegistry struct {
+	// Server is the registry the credentials are for, e.g. ghcr.io.
+	Server string `json:"server"`
+	// Username is the remote ref of the username in the secret store.
+	Username string `json:"username"`
+	// Password is the remote ref of the password (or token) in the secret store.
+	Password string `json:"password"`
+}
+
+// AppBundleSidecar is a container run next to the one of the app bundle, e.g. a VPN client, an oauth proxy or a log tailer.
+// Volumes and configs of the app bundle are shared with it by key rather than declared again.
+type AppBundleSidecar struct {
+	Image       *AppBundleImage                `json:"image,omitempty"`
+	Command     []*string                      `json:"command,omitempty"`
+	Args        []*string                      `json:"args,omitempty"`
+	Envs        map[string]string              `json:"envs,omitempty"`
+	SourcedEnvs map[string]AppBundleSourcedEnv `json:"sourcedEnvs,omitempty"`
+	// Ports maps a port name to the port the sidecar listens on. A route reaches it by setting the port as its target port.
+	Ports          map[string]int           `json:"ports,omitempty"`
+	Resources      *v1.ResourceRequirements `json:"resources,omitempty"`
+	LivenessProbe  *v1.Probe                `json:"livenessProbe,omitempty"`
+	ReadinessProbe *v1.Probe                `json:"readinessProbe,omitempty"`
+	StartupProbe   *v1.Probe                `json:"startupProbe,omitempty"`
+	// Volumes lists the keys of the volumes of the app bundle to mount, at the same path as in the container of the app bundle.
+	Volumes []string `json:"volumes,omitempty"`
+	// Configs lists the keys of the configs of the app bundle to mount, read only at the same path as in the container of the app bundle.
+	Configs []string `json:"configs,omitempty"`
+}
+
+// AppBundleInitContainer is a container run to completion before the container of the app bundle starts, e.g. to run migrations, fix permissions or wait for a dependency.
+// It mounts the volumes and configs of the app bundle at the same paths and gets its envs, with its own envs set on top.
+type AppBundleInitContainer struct {
+	Name string `json:"name"`
+	// Image of the init container, the image of the app bundle if unset.
+	Image       *AppBundleImage                `json:"image,omitempty"`
+	Command     []*string                      `json:"command,omitempty"`
+	Args        []*string                      `json:"args,omitempty"`
+	Envs        map[string]string              `json:"envs,omitempty"`
+	SourcedEnvs map[string]AppBundleSourcedEnv `json:"sourcedEnvs,omitempty"`
+	Resources   *v1.ResourceRequirements       `json:"resources,omitempty"`
 }
 
 type AppBundleRoute struct {
@@ -132,6 +172,232 @@ type AppBundleVolume struct {
 	StorageClass  *string `json:"storageClass,omitempty"`
 	ExistingClaim *string `json:"existingClaim,omitempty"`
 	Backup        *bool   `json:"backup,omitempty"`
+	// Retain keeps the generated claim, and so its data, once the volume is removed from the spec or the app bundle is deleted.
+	// The claim is released from the app bundle instead, after which it can be mounted again as an existing claim.
+	Retain *bool `json:"retain,omitempty"`
+}
+
+// AppBundleAntiAffinity is a preset for how strictly the replicas of an app bundle are kept off the same node.
+// +kubebuilder:validation:Enum=None;Preferred;Required
+type AppBundleAntiAffinity string
+
+const (
+	// AntiAffinityNone lets the scheduler put the replicas wherever it likes.
+	AntiAffinityNone AppBundleAntiAffinity = "None"
+	// AntiAffinityPreferred spreads the replicas over the nodes where it can, putting several on one node rather than leaving any unscheduled.
+	AntiAffinityPreferred AppBundleAntiAffinity = "Preferred"
+	// AntiAffinityRequired never puts two replicas on the same node, leaving those that do not fit unscheduled.
+	AntiAffinityRequired AppBundleAntiAffinity = "Required"
+)
+
+// AppBundleScheduling decides where the pods of an app bundle run.
+type AppBundleScheduling struct {
+	// AntiAffinity is the preset keeping the replicas off the same node, DefaultAntiAffinity if unset.
+	// Only applies to workloads with replicas (deployments and stateful sets) and is left out when Affinity has a pod anti-affinity of its own.
+	AntiAffinity *AppBundleAntiAffinity `json:"antiAffinity,omitempty"`
+	// Affinity is set on the pods as it is, alongside the anti-affinity preset.
+	Affinity    *v1.Affinity    `json:"affinity,omitempty"`
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+	// TopologySpreadConstraints are set on the pods, those without a label selector spread the pods of the app bundle.
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	PriorityClassName         *string                       `json:"priorityClassName,omitempty"`
+	// RuntimeClassName takes precedence over the runtime class of the accelerator profiles.
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+}
+
+// AppBundleAccelerator is an accelerator requested by the container of an app bundle.
+type AppBundleAccelerator struct {
+	// Count is the number of devices requested. Without one the pods are only set up as the profile of the accelerator says.
+	// +kubebuilder:validation:Minimum=0
+	Count *int64 `json:"count,omitempty"`
+}
+
+// AppBundleSecurityPreset is a preset security context, named after the Pod Security Standard the pods then meet.
+// +kubebuilder:validation:Enum=Privileged;Baseline;Restricted
+type AppBundleSecurityPreset string
+
+const (
+	// SecurityPresetPrivileged runs the containers privileged, with the same access to the node as its processes.
+	SecurityPresetPrivileged AppBundleSecurityPreset = "Privileged"
+	// SecurityPresetBaseline keeps the containers unprivileged and confined by the seccomp profile of the container runtime.
+	SecurityPresetBaseline AppBundleSecurityPreset = "Baseline"
+	// SecurityPresetRestricted also runs the containers as non-root, with every capability dropped and no privilege escalation.
+	// It requires RunAsUser, as a non-root image can not be told apart from one running as root; the busybox containers copying configs over run as nobody.
+	SecurityPresetRestricted AppBundleSecurityPreset = "Restricted"
+)
+
+// AppBundleSecurity is the security context of the pods of an app bundle, applied to every one of their containers.
+// The fields set take precedence over the preset.
+type AppBundleSecurity struct {
+	Preset *AppBundleSecurityPreset `json:"preset,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	RunAsGroup *int64 `json:"runAsGroup,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	FSGroup                *int64 `json:"fsGroup,omitempty"`
+	ReadOnlyRootFilesystem *bool  `json:"readOnlyRootFilesystem,omitempty"`
+	// Capabilities are added to and dropped on top of those the preset drops.
+	Capabilities             *v1.Capabilities   `json:"capabilities,omitempty"`
+	SeccompProfile           *v1.SeccompProfile `json:"seccompProfile,omitempty"`
+	AllowPrivilegeEscalation *bool              `json:"allowPrivilegeEscalation,omitempty"`
+}
+
+// AppBundleServiceAccount is the service account generated for an app bundle, named after it, along with the roles and bindings granting it access.
+type AppBundleServiceAccount struct {
+	// AutomountServiceAccountToken decides whether the token of the service account is mounted into the pods, it is unless set to false.
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+	// ImagePullSecrets are the names of secrets set on the service account.
+	// They are set on the pods too, next to those of the AtrokConfig, as the service account's are only used by pods that have none.
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// Rules are granted in the namespace of the app bundle, through a Role generated for it. Whoever creates or changes the app bundle has to hold them already.
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+	// ClusterRules are granted across the cluster, through a ClusterRole generated for it. The AtrokConfig has to allow cluster RBAC,
+	// and whoever creates or changes the app bundle has to hold them across the cluster already.
+	ClusterRules []rbacv1.PolicyRule `json:"clusterRules,omitempty"`
+	// Roles are existing roles granted to the service account, each of which has to be among the bindableRoles of the AtrokConfig.
+	Roles []AppBundleRoleRef `json:"roles,omitempty"`
+}
+
+// AppBundleRoleRef refers to an existing role granted to the service account of an app bundle.
+type AppBundleRoleRef struct {
+	// +kubebuilder:validation:Enum=Role;ClusterRole
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// ClusterWide grants a ClusterRole across the cluster rather than only in the namespace of the app bundle. The AtrokConfig has to allow cluster RBAC.
+	ClusterWide *bool `json:"clusterWide,omitempty"`
+}
+
+// HasClusterRBAC reports whether the service account is granted anything across the cluster, which the AtrokConfig has to allow.
+func (sa *AppBundleServiceAccount) HasClusterRBAC() bool {
+	if len(sa.ClusterRules) != 0 {
+		return true
+	}
+
+	for _, role := range sa.Roles {
+		if role.ClusterWide != nil && *role.ClusterWide {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AppBundleWorkloadKind is the kind of workload running the container of an app bundle.
+// +kubebuilder:validation:Enum=Deployment;StatefulSet;DaemonSet;CronJob;Job
+type AppBundleWorkloadKind string
+
+const (
+	// WorkloadKindDeployment runs the app bundle as a Deployment.
+	WorkloadKindDeployment AppBundleWorkloadKind = "Deployment"
+	// WorkloadKindStatefulSet runs the app bundle as a StatefulSet behind a headless service,
+	// giving every replica a stable identity and claims of its own made from the volumes.
+	WorkloadKindStatefulSet AppBundleWorkloadKind = "StatefulSet"
+	// WorkloadKindDaemonSet runs the app bundle as a DaemonSet, one pod on every node its node selector allows, e.g. for node agents.
+	WorkloadKindDaemonSet AppBundleWorkloadKind = "DaemonSet"
+	// WorkloadKindCronJob runs the app bundle as a CronJob, starting a job on the schedule set in AppBundleWorkload.CronJob.
+	WorkloadKindCronJob AppBundleWorkloadKind = "CronJob"
+	// WorkloadKindJob runs the app bundle once as a Job, run again whenever the job changes.
+	WorkloadKindJob AppBundleWorkloadKind = "Job"
+)
+
+// IsJob reports whether the kind runs to completion rather than being kept running.
+func (kind AppBundleWorkloadKind) IsJob() bool {
+	return kind == WorkloadKindCronJob || kind == WorkloadKindJob
+}
+
+// AppBundleWorkload describes the workload running the container of an app bundle.
+type AppBundleWorkload struct {
+	// Kind of the workload, DefaultWorkloadKind if unset.
+	Kind *AppBundleWorkloadKind `json:"kind,omitempty"`
+	// DaemonSet holds the settings only a daemon set has, only valid with the DaemonSet kind.
+	DaemonSet *AppBundleDaemonSet `json:"daemonSet,omitempty"`
+	// CronJob holds the schedule and the settings only a cron job has, required with the CronJob kind.
+	CronJob *AppBundleCronJob `json:"cronJob,omitempty"`
+	// Job holds the settings of the job run by the Job kind, or of every job started by the CronJob kind.
+	Job *AppBundleJob `json:"job,omitempty"`
+}
+
+// AppBundleCronJob holds the settings of an app bundle running as a cron job.
+type AppBundleCronJob struct {
+	// Schedule is the cron expression jobs are started on.
+	Schedule *string `json:"schedule,omitempty"`
+	// TimeZone the schedule is in, e.g. "Europe/London". The time zone of the kube-controller-manager if unset.
+	TimeZone *string `json:"timeZone,omitempty"`
+	// ConcurrencyPolicy decides what happens when a job is due while the previous one is still running, Allow if unset.
+	ConcurrencyPolicy *batchv1.ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+	// StartingDeadlineSeconds is how late a job may still be started after missing its scheduled time.
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+	// SuccessfulJobsHistoryLimit is the number of succeeded jobs kept around, 3 if unset.
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// FailedJobsHistoryLimit is the number of failed jobs kept around, 1 if unset.
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+	// Suspend stops new jobs from being started, leaving running ones alone.
+	Suspend *bool `json:"suspend,omitempty"`
+}
+
+// AppBundleJob holds the settings of the jobs run for an app bundle.
+type AppBundleJob struct {
+	// BackoffLimit is the number of retries before the job is marked as failed, 6 if unset.
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// ActiveDeadlineSeconds is how long the job may run, retries included, before it is failed.
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// TTLSecondsAfterFinished deletes the job this long after it finished. Only valid for the CronJob kind, the job of the Job kind would be run again once deleted.
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// AppBundleStrategy describes how the deployment of an app bundle rolls out a change, only valid with the Deployment kind.
+type AppBundleStrategy struct {
+	// Type of the rollout, Recreate if unset. RollingUpdate falls back to Recreate while a ReadWriteOnce claim is mounted,
+	// as the new pods could not mount it next to the old ones.
+	// +kubebuilder:validation:Enum=Recreate;RollingUpdate
+	Type *appsv1.DeploymentStrategyType `json:"type,omitempty"`
+	// MaxSurge is the number (or percentage) of pods created above the replicas during a rolling update.
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+	// MaxUnavailable is the number (or percentage) of replicas that may be unavailable during a rolling update.
+	MaxUnavailable          *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	MinReadySeconds         *int32              `json:"minReadySeconds,omitempty"`
+	ProgressDeadlineSeconds *int32              `json:"progressDeadlineSeconds,omitempty"`
+	// RevisionHistoryLimit is the number of old replica sets kept to roll back to, 3 if unset.
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+}
+
+// AppBundleDaemonSet holds the settings of an app bundle running as a daemon set.
+type AppBundleDaemonSet struct {
+	// UpdateStrategy replaces the pods on the nodes one at a time by default (a rolling update), or only once they are deleted (OnDelete).
+	UpdateStrategy *appsv1.DaemonSetUpdateStrategy `json:"updateStrategy,omitempty"`
+}
+
+// GetWorkloadKind returns the kind of workload the spec asks for, DefaultWorkloadKind if it does not say.
+func (spec *AppBundleSpec) GetWorkloadKind() AppBundleWorkloadKind {
+	if spec.Workload == nil || spec.Workload.Kind == nil {
+		return DefaultWorkloadKind
+	}
+
+	return *spec.Workload.Kind
+}
+
+// GetAntiAffinity returns the anti-affinity preset the spec asks for, DefaultAntiAffinity if it does not say.
+func (spec *AppBundleSpec) GetAntiAffinity() AppBundleAntiAffinity {
+	if spec.Scheduling == nil || spec.Scheduling.AntiAffinity == nil {
+		return DefaultAntiAffinity
+	}
+
+	return *spec.Scheduling.AntiAffinity
+}
+
+// GetAccelerators returns the accelerators the spec asks for, with the nvidia.com/gpu one UseNvidia stands for unless it is already there.
+func (spec *AppBundleSpec) GetAccelerators() map[string]AppBundleAccelerator {
+	if spec.UseNvidia == nil || !*spec.UseNvidia {
+		return spec.Accelerators
+	}
+	if _, ok := spec.Accelerators[NvidiaGPUResource]; ok {
+		return spec.Accelerators
+	}
+
+	accelerators := map[string]AppBundleAccelerator{NvidiaGPUResource: {}}
+	maps.Copy(accelerators, spec.Accelerators)
+	return accelerators
 }
 
 type AppBundleVolumeLonghornBackup struct {
@@ -139,16 +405,113 @@ type AppBundleVolumeLonghornBackup struct {
 	Retain    *int    `json:"retain,omitempty"`
 }
 
+// Condition types reported in AppBundleStatus.Conditions
+const (
+	// ConditionReady is true when every other condition is true.
+	ConditionReady = "Ready"
+	// ConditionWorkloadAvailable is true when the workload (deployment, stateful set or daemon set) has all of its replicas updated and available,
+	// or for a job or cron job, when its latest run did not fail.
+	ConditionWorkloadAvailable = "WorkloadAvailable"
+	// ConditionDeploymentAvailable is true when the deployment has all of its replicas updated and available.
+	// Kept for app bundles running a deployment as it was reported before WorkloadAvailable, whose value it mirrors; absent for other workload kinds.
+	ConditionDeploymentAvailable = "DeploymentAvailable"
+	// ConditionServiceReady is true when the service exists (and for a LoadBalancer, has been given an address).
+	ConditionServiceReady = "ServiceReady"
+	// ConditionIngressReady is true when all the ingresses exist.
+	ConditionIngressReady = "IngressReady"
+	// ConditionSecretsSynced is true when the external secret has synced.
+	ConditionSecretsSynced = "SecretsSynced"
+	// ConditionVolumesBound is true when every claim mounted by the app bundle is bound.
+	ConditionVolumesBound = "VolumesBound"
+	// ConditionBackupConfigured is true when the longhorn recurring backup job exists.
+	ConditionBackupConfigured = "BackupConfigured"
+	// ConditionBaseResolved is true when the chain of bases could be resolved (or there is no base).
+	ConditionBaseResolved = "BaseResolved"
+)
+
+// Reasons used for the conditions in AppBundleStatus.Conditions
+const (
+	ReasonAvailable       = "Available"
+	ReasonProgressing     = "Progressing"
+	ReasonNotRequired     = "NotRequired"
+	ReasonReconcileFailed = "ReconcileFailed"
+	ReasonNotReady        = "NotReady"
+	ReasonBound           = "Bound"
+	ReasonPending         = "Pending"
+	ReasonSynced          = "Synced"
+	ReasonNotSynced       = "NotSynced"
+	ReasonConfigured      = "Configured"
+	ReasonResolved        = "Resolved"
+	ReasonBaseNotFound    = "BaseNotFound"
+	ReasonBaseCycle       = "BaseCycle"
+	ReasonBaseTooDeep     = "BaseChainTooDeep"
+	ReasonCompleted       = "Completed"
+	ReasonFailed          = "Failed"
+)
+
+// AppBundleRunResult is the outcome of a run of the job of an app bundle.
+type AppBundleRunResult string
+
+const (
+	RunResultRunning   AppBundleRunResult = "Running"
+	RunResultSucceeded AppBundleRunResult = "Succeeded"
+	RunResultFailed    AppBundleRunResult = "Failed"
+)
+
+// AppBundleRunStatus describes the latest run of the job of an app bundle with a Job or CronJob workload.
+type AppBundleRunStatus struct {
+	JobName        string             `json:"jobName"`
+	Result         AppBundleRunResult `json:"result"`
+	StartTime      *metav1.Time       `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time       `json:"completionTime,omitempty"`
+	Message        string             `json:"message,omitempty"`
+}
+
+// AppBundleResourceStatus describes a single resource generated for the app bundle.
+type AppBundleResourceStatus struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Healthy   bool   `json:"healthy"`
+	Message   string `json:"message,omitempty"`
+}
+
 // AppBundleStatus defines the observed state of AppBundle
 type AppBundleStatus struct {
 	LastReconciliation *string `json:"lastReconciliation,omitempty"`
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the generation of the app bundle the status was computed for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the state of the resources generated for the app bundle, see the Condition* constants.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Resources lists the resources generated for the app bundle along with their health.
+	Resources []AppBundleResourceStatus `json:"resources,omitempty"`
+	// EffectiveSpec is the spec the resources are built from, i.e. with the bases merged in and defaults applied.
+	// Only recorded when enabled in the AtrokConfig.
+	EffectiveSpec *AppBundleSpec `json:"effectiveSpec,omitempty"`
+	// EffectiveSpecHash is the hash of the spec the resources are built from, it changes whenever the app bundle or any base in its chain does.
+	EffectiveSpecHash string `json:"effectiveSpecHash,omitempty"`
+	// Provenance maps every field set in the effective spec to where its value came from: "self", the name of a base or "default".
+	// Maps are listed per key, e.g. "envs[TZ]", other fields by their name, e.g. "image".
+	Provenance map[string]string `json:"provenance,omitempty"`
+	// ConsecutiveFailures is the number of reconciles that failed in a row, reset by the first one to succeed.
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+	// NextRetryTime is when the app bundle is reconciled again after a failure, backing off exponentially with ConsecutiveFailures.
+	// Changing the spec retries straight away.
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+	// LastRun is the latest run of the job of a Job or CronJob workload.
+	LastRun *AppBundleRunStatus `json:"lastRun,omitempty"`
+	// LastScheduleTime is when the cron job of a CronJob workload last started a job.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:resource:shortName=ab,path=appbundles,singular=appbundle,scope=Namespaced
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // AppBundle is the Schema for the appbundles API
 type AppBundle struct {
@@ -0,0 +1,810 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Validate checks the spec of an app bundle whose base (if any) has already been merged in, so everything needed to build its resources must be present.
+func (ab *AppBundle) Validate() field.ErrorList {
+	allErrs := ValidateAppBundleSpec(&ab.Spec, true, field.NewPath("spec"))
+
+	// The container of the app bundle itself is named after it
+	if _, ok := ab.Spec.Sidecars[ab.Name]; ok {
+		allErrs = append(allErrs, field.Duplicate(field.NewPath("spec", "sidecars").Key(ab.Name), ab.Name))
+	}
+	for i, initContainer := range ab.Spec.InitContainers {
+		if initContainer.Name == ab.Name {
+			allErrs = append(allErrs, field.Duplicate(field.NewPath("spec", "initContainers").Index(i).Child("name"), ab.Name))
+		}
+	}
+
+	return allErrs
+}
+
+// Validate checks the spec of an app bundle base. A base only provides defaults for app bundles, so fields it leaves out are not required.
+func (abb *AppBundleBase) Validate() field.ErrorList {
+	ab, err := abb.ToAppBundle()
+	if err != nil {
+		return field.ErrorList{field.InternalError(field.NewPath("spec"), err)}
+	}
+
+	return ValidateAppBundleSpec(&ab.Spec, false, field.NewPath("spec"))
+}
+
+// ValidateAppBundleSpec checks the spec for values that would fail (or panic) when building the resources of the app bundle.
+// When complete is false only the values that are set are checked, missing ones are assumed to be provided elsewhere (e.g. by the app bundle using the base).
+func ValidateAppBundleSpec(spec *AppBundleSpec, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	allErrs = append(allErrs, validateImage(spec.Image, complete, fldPath.Child("image"))...)
+	if spec.Image != nil {
+		allErrs = append(allErrs, validateImagePullSecrets(spec.Image, fldPath.Child("image"))...)
+	}
+
+	for _, key := range sortedKeys(spec.Routes) {
+		allErrs = append(allErrs, validateRoute(spec.Routes[key], complete, fldPath.Child("routes").Key(key))...)
+	}
+
+	for _, key := range sortedKeys(spec.Volumes) {
+		allErrs = append(allErrs, validateVolume(spec.Volumes[key], complete, fldPath.Child("volumes").Key(key))...)
+	}
+
+	if complete {
+		allErrs = append(allErrs, validateWorkload(spec, fldPath)...)
+		allErrs = append(allErrs, validateSecurityVolumes(spec, fldPath)...)
+	}
+
+	if spec.Scheduling != nil {
+		allErrs = append(allErrs, validateScheduling(spec.Scheduling, fldPath.Child("scheduling"))...)
+	}
+
+	for _, name := range sortedKeys(spec.Accelerators) {
+		allErrs = append(allErrs, validateAccelerator(name, spec.Accelerators[name], fldPath.Child("accelerators").Key(name))...)
+	}
+
+	if spec.Security != nil {
+		allErrs = append(allErrs, validateSecurity(spec.Security, fldPath.Child("security"))...)
+	}
+
+	if spec.ServiceAccount != nil {
+		allErrs = append(allErrs, validateServiceAccount(spec.ServiceAccount, fldPath.Child("serviceAccount"))...)
+	}
+
+	if spec.Strategy != nil {
+		allErrs = append(allErrs, validateStrategy(spec.Strategy, fldPath.Child("strategy"))...)
+	}
+
+	if spec.Backup != nil {
+		allErrs = append(allErrs, validateBackup(spec.Backup, complete, fldPath.Child("backup"))...)
+	}
+
+	needsSecretStore := spec.Image != nil && spec.Image.Registry != nil
+	for _, key := range sortedKeys(spec.SourcedEnvs) {
+		sourcedEnv := spec.SourcedEnvs[key]
+		if sourcedEnv.ExternalSecret != "" {
+			needsSecretStore = true
+		}
+		allErrs = append(allErrs, validateSourcedEnv(sourcedEnv, complete, fldPath.Child("sourcedEnvs").Key(key))...)
+	}
+
+	for _, key := range sortedKeys(spec.Configs) {
+		if len(spec.Configs[key].Secrets) != 0 {
+			needsSecretStore = true
+		}
+		allErrs = append(allErrs, validateConfig(spec.Configs[key], complete, fldPath.Child("configs").Key(key))...)
+	}
+
+	for _, name := range sortedKeys(spec.Sidecars) {
+		sidecar := spec.Sidecars[name]
+		for _, sourcedEnv := range sidecar.SourcedEnvs {
+			if sourcedEnv.ExternalSecret != "" {
+				needsSecretStore = true
+			}
+		}
+		allErrs = append(allErrs, validateSidecar(name, sidecar, complete, fldPath.Child("sidecars").Key(name))...)
+	}
+
+	for i, initContainer := range spec.InitContainers {
+		for _, sourcedEnv := range initContainer.SourcedEnvs {
+			if sourcedEnv.ExternalSecret != "" {
+				needsSecretStore = true
+			}
+		}
+		allErrs = append(allErrs, validateInitContainer(initContainer, complete, fldPath.Child("initContainers").Index(i))...)
+	}
+
+	if complete {
+		allErrs = append(allErrs, validateContainerReferences(spec, fldPath)...)
+	}
+
+	if spec.Merge != nil {
+		allErrs = append(allErrs, validateMerge(spec.Merge, fldPath.Child("merge"))...)
+	}
+
+	if complete && needsSecretStore && (spec.SecretStoreRef == nil || *spec.SecretStoreRef == "") {
+		allErrs = append(allErrs, field.Required(fldPath.Child("secretStoreRef"), "required when configs have secrets, sourced envs use external secrets or the image has registry credentials"))
+	}
+
+	return allErrs
+}
+
+// validateWorkload checks the settings that only fit some kinds of workload, which can only be done once the kind is known.
+func validateWorkload(spec *AppBundleSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	kind := spec.GetWorkloadKind()
+
+	if spec.Workload != nil && spec.Workload.DaemonSet != nil && kind != WorkloadKindDaemonSet {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("workload", "daemonSet"), kind, "only valid for the DaemonSet kind"))
+	}
+
+	if spec.Strategy != nil && kind != WorkloadKindDeployment {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("strategy"), kind, "only valid for the Deployment kind"))
+	}
+
+	if spec.Workload != nil && spec.Workload.Job != nil && !kind.IsJob() {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("workload", "job"), kind, "only valid for the Job and CronJob kinds"))
+	}
+
+	if kind == WorkloadKindJob && spec.Workload.Job != nil && spec.Workload.Job.TTLSecondsAfterFinished != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("workload", "job", "ttlSecondsAfterFinished"), *spec.Workload.Job.TTLSecondsAfterFinished, "the job would be run again once deleted, only valid for the CronJob kind"))
+	}
+
+	if spec.Workload != nil && spec.Workload.CronJob != nil && kind != WorkloadKindCronJob {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("workload", "cronJob"), kind, "only valid for the CronJob kind"))
+	}
+
+	if kind == WorkloadKindCronJob {
+		schedulePath := fldPath.Child("workload", "cronJob", "schedule")
+		if spec.Workload.CronJob == nil || spec.Workload.CronJob.Schedule == nil {
+			allErrs = append(allErrs, field.Required(schedulePath, "a schedule is required for the CronJob kind"))
+		} else if err := ValidateCron(*spec.Workload.CronJob.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(schedulePath, *spec.Workload.CronJob.Schedule, err.Error()))
+		}
+	}
+
+	if kind == WorkloadKindDaemonSet {
+		// A generated claim is ReadWriteOnce, so pods on more than one node could never all mount it
+		for _, key := range sortedKeys(spec.Volumes) {
+			if spec.Volumes[key].Size != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("volumes").Key(key).Child("size"), *spec.Volumes[key].Size, "a daemon set can not mount generated claims, use a hostPath, emptyDir or existingClaim"))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func validateScheduling(scheduling *AppBundleScheduling, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	antiAffinities := []AppBundleAntiAffinity{AntiAffinityNone, AntiAffinityPreferred, AntiAffinityRequired}
+	if scheduling.AntiAffinity != nil && !slices.Contains(antiAffinities, *scheduling.AntiAffinity) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("antiAffinity"), *scheduling.AntiAffinity, antiAffinities))
+	}
+
+	for i, toleration := range scheduling.Tolerations {
+		if toleration.Operator == v1.TolerationOpExists && toleration.Value != "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("tolerations").Index(i).Child("value"), toleration.Value, "must be empty when the operator is Exists"))
+		}
+		if toleration.Key == "" && toleration.Operator != v1.TolerationOpExists {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("tolerations").Index(i).Child("operator"), toleration.Operator, "must be Exists when the key is empty"))
+		}
+	}
+
+	for i, constraint := range scheduling.TopologySpreadConstraints {
+		if constraint.MaxSkew < 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topologySpreadConstraints").Index(i).Child("maxSkew"), constraint.MaxSkew, "must be at least 1"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateAccelerator checks the accelerator requested under the given resource name, which has to be that of an extended resource.
+func validateAccelerator(name string, accelerator AppBundleAccelerator, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	for _, msg := range validation.IsQualifiedName(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+	}
+	if !strings.Contains(name, "/") || strings.HasPrefix(name, "kubernetes.io/") || strings.HasPrefix(name, "requests.") {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, "must be the name of an extended resource, e.g. nvidia.com/gpu"))
+	}
+
+	if accelerator.Count != nil && *accelerator.Count < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("count"), *accelerator.Count, "must not be negative"))
+	}
+
+	return allErrs
+}
+
+// baselineCapabilities are the capabilities the Baseline Pod Security Standard allows adding.
+var baselineCapabilities = []v1.Capability{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD", "NET_BIND_SERVICE",
+	"SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT",
+}
+
+// restrictedCapabilities are the capabilities the Restricted Pod Security Standard allows adding.
+var restrictedCapabilities = []v1.Capability{"NET_BIND_SERVICE"}
+
+// validateSecurity checks the security settings can be applied and, for the Baseline and Restricted presets, keep the pods meeting the standard the preset is named after.
+func validateSecurity(security *AppBundleSecurity, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	presets := []AppBundleSecurityPreset{SecurityPresetPrivileged, SecurityPresetBaseline, SecurityPresetRestricted}
+	if security.Preset != nil && !slices.Contains(presets, *security.Preset) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("preset"), *security.Preset, presets))
+	}
+
+	if profile := security.SeccompProfile; profile != nil {
+		profilePath := fldPath.Child("seccompProfile")
+		switch {
+		case profile.Type == v1.SeccompProfileTypeLocalhost && (profile.LocalhostProfile == nil || *profile.LocalhostProfile == ""):
+			allErrs = append(allErrs, field.Required(profilePath.Child("localhostProfile"), "required when the type is Localhost"))
+		case profile.Type != v1.SeccompProfileTypeLocalhost && profile.LocalhostProfile != nil:
+			allErrs = append(allErrs, field.Invalid(profilePath.Child("localhostProfile"), *profile.LocalhostProfile, "may only be set when the type is Localhost"))
+		}
+	}
+
+	if security.Preset == nil {
+		return allErrs
+	}
+
+	switch *security.Preset {
+	case SecurityPresetPrivileged:
+		if security.AllowPrivilegeEscalation != nil && !*security.AllowPrivilegeEscalation {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("allowPrivilegeEscalation"), false, "must not be false when the containers run privileged"))
+		}
+	case SecurityPresetBaseline, SecurityPresetRestricted:
+		allowed := baselineCapabilities
+		if *security.Preset == SecurityPresetRestricted {
+			allowed = restrictedCapabilities
+		}
+		if security.Capabilities != nil {
+			for i, capability := range security.Capabilities.Add {
+				if !slices.Contains(allowed, capability) {
+					allErrs = append(allErrs, field.Invalid(fldPath.Child("capabilities", "add").Index(i), capability, fmt.Sprintf("may not be added with the %s preset", *security.Preset)))
+				}
+			}
+		}
+
+		if security.SeccompProfile != nil && security.SeccompProfile.Type == v1.SeccompProfileTypeUnconfined {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("seccompProfile", "type"), security.SeccompProfile.Type, fmt.Sprintf("may not be Unconfined with the %s preset", *security.Preset)))
+		}
+	}
+
+	if *security.Preset == SecurityPresetRestricted {
+		switch {
+		case security.RunAsUser == nil:
+			allErrs = append(allErrs, field.Required(fldPath.Child("runAsUser"), "required with the Restricted preset, the containers fail to start if their image runs as root otherwise"))
+		case *security.RunAsUser == 0:
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("runAsUser"), *security.RunAsUser, "must not be root with the Restricted preset"))
+		}
+		if security.AllowPrivilegeEscalation != nil && *security.AllowPrivilegeEscalation {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("allowPrivilegeEscalation"), true, "must not be true with the Restricted preset"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateSecurityVolumes checks the Baseline and Restricted presets are not used with host path volumes, which neither standard allows.
+func validateSecurityVolumes(spec *AppBundleSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if spec.Security == nil || spec.Security.Preset == nil || *spec.Security.Preset == SecurityPresetPrivileged {
+		return allErrs
+	}
+
+	for _, key := range sortedKeys(spec.Volumes) {
+		if hostPath := spec.Volumes[key].HostPath; hostPath != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("volumes").Key(key).Child("hostPath"), *hostPath, fmt.Sprintf("may not be used with the %s security preset", *spec.Security.Preset)))
+		}
+	}
+
+	return allErrs
+}
+
+func validateServiceAccount(serviceAccount *AppBundleServiceAccount, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	for i, rule := range serviceAccount.Rules {
+		allErrs = append(allErrs, validatePolicyRule(rule, true, fldPath.Child("rules").Index(i))...)
+	}
+	for i, rule := range serviceAccount.ClusterRules {
+		allErrs = append(allErrs, validatePolicyRule(rule, false, fldPath.Child("clusterRules").Index(i))...)
+	}
+
+	kinds := []string{"Role", "ClusterRole"}
+	for i, role := range serviceAccount.Roles {
+		rolePath := fldPath.Child("roles").Index(i)
+		if !slices.Contains(kinds, role.Kind) {
+			allErrs = append(allErrs, field.NotSupported(rolePath.Child("kind"), role.Kind, kinds))
+		}
+		if role.Name == "" {
+			allErrs = append(allErrs, field.Required(rolePath.Child("name"), "role name is required"))
+		}
+		if role.ClusterWide != nil && *role.ClusterWide && role.Kind != "ClusterRole" {
+			allErrs = append(allErrs, field.Invalid(rolePath.Child("clusterWide"), true, "only a ClusterRole can be granted cluster wide"))
+		}
+	}
+
+	return allErrs
+}
+
+// validatePolicyRule checks the rule the way the api server does, a rule of a namespaced role can not grant access to non-resource urls.
+func validatePolicyRule(rule rbacv1.PolicyRule, namespaced bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if len(rule.Verbs) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("verbs"), "verbs must contain at least one value"))
+	}
+
+	if len(rule.NonResourceURLs) != 0 {
+		if namespaced {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("nonResourceURLs"), rule.NonResourceURLs, "namespaced rules cannot apply to non-resource URLs"))
+		}
+		if len(rule.APIGroups) != 0 || len(rule.Resources) != 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("nonResourceURLs"), rule.NonResourceURLs, "rules cannot apply to both regular resources and non-resource URLs"))
+		}
+		return allErrs
+	}
+
+	if len(rule.APIGroups) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("apiGroups"), "resource rules must supply at least one api group"))
+	}
+	if len(rule.Resources) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("resources"), "resource rules must supply at least one resource"))
+	}
+
+	return allErrs
+}
+
+func validateStrategy(strategy *AppBundleStrategy, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	rollingUpdate := strategy.Type != nil && *strategy.Type == appsv1.RollingUpdateDeploymentStrategyType
+	surgeIsZero, unavailableIsZero := false, false
+	for _, setting := range []struct {
+		name   string
+		value  *intstr.IntOrString
+		isZero *bool
+	}{
+		{name: "maxSurge", value: strategy.MaxSurge, isZero: &surgeIsZero},
+		{name: "maxUnavailable", value: strategy.MaxUnavailable, isZero: &unavailableIsZero},
+	} {
+		if setting.value == nil {
+			continue
+		}
+		if !rollingUpdate {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(setting.name), setting.value.String(), "only valid for the RollingUpdate type"))
+			continue
+		}
+
+		scaled, err := intstr.GetScaledValueFromIntOrPercent(setting.value, 100, true)
+		switch {
+		case err != nil:
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(setting.name), setting.value.String(), err.Error()))
+		case scaled < 0:
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(setting.name), setting.value.String(), "must not be negative"))
+		case setting.value.Type == intstr.String && scaled > 100:
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(setting.name), setting.value.String(), "must not be more than 100%"))
+		default:
+			*setting.isZero = scaled == 0
+		}
+	}
+
+	// The rollout could never make progress, it can neither add nor take away a pod
+	if surgeIsZero && unavailableIsZero {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxUnavailable"), strategy.MaxUnavailable.String(), "may not be 0 when maxSurge is 0"))
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value *int32
+	}{
+		{name: "minReadySeconds", value: strategy.MinReadySeconds},
+		{name: "progressDeadlineSeconds", value: strategy.ProgressDeadlineSeconds},
+		{name: "revisionHistoryLimit", value: strategy.RevisionHistoryLimit},
+	} {
+		if setting.value != nil && *setting.value < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(setting.name), *setting.value, "must not be negative"))
+		}
+	}
+
+	if strategy.MinReadySeconds != nil && strategy.ProgressDeadlineSeconds != nil && *strategy.ProgressDeadlineSeconds <= *strategy.MinReadySeconds {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("progressDeadlineSeconds"), *strategy.ProgressDeadlineSeconds, "must be greater than minReadySeconds"))
+	}
+
+	return allErrs
+}
+
+func validateSidecar(name string, sidecar AppBundleSidecar, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	for _, msg := range validation.IsDNS1123Label(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+	}
+	if strings.HasPrefix(name, "copy-over-") {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, "the copy-over- prefix is reserved for the containers copying configs"))
+	}
+
+	allErrs = append(allErrs, validateImage(sidecar.Image, complete, fldPath.Child("image"))...)
+	if sidecar.Image != nil {
+		allErrs = append(allErrs, validateNoImagePullSecrets(sidecar.Image, fldPath.Child("image"))...)
+	}
+
+	for _, portName := range sortedKeys(sidecar.Ports) {
+		for _, msg := range validation.IsValidPortName(portName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ports").Key(portName), portName, msg))
+		}
+		if port := sidecar.Ports[portName]; port < 1 || port > 65535 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ports").Key(portName), port, "must be between 1 and 65535"))
+		}
+	}
+
+	for _, key := range sortedKeys(sidecar.SourcedEnvs) {
+		allErrs = append(allErrs, validateSourcedEnv(sidecar.SourcedEnvs[key], complete, fldPath.Child("sourcedEnvs").Key(key))...)
+	}
+
+	return allErrs
+}
+
+func validateInitContainer(initContainer AppBundleInitContainer, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	for _, msg := range validation.IsDNS1123Label(initContainer.Name) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("name"), initContainer.Name, msg))
+	}
+	if strings.HasPrefix(initContainer.Name, "copy-over-") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("name"), initContainer.Name, "the copy-over- prefix is reserved for the containers copying configs"))
+	}
+
+	// The image of the app bundle is used when none is set
+	if initContainer.Image != nil {
+		allErrs = append(allErrs, validateImage(initContainer.Image, complete, fldPath.Child("image"))...)
+		allErrs = append(allErrs, validateNoImagePullSecrets(initContainer.Image, fldPath.Child("image"))...)
+	}
+
+	for _, key := range sortedKeys(initContainer.SourcedEnvs) {
+		allErrs = append(allErrs, validateSourcedEnv(initContainer.SourcedEnvs[key], complete, fldPath.Child("sourcedEnvs").Key(key))...)
+	}
+
+	return allErrs
+}
+
+// validateContainerReferences checks what the sidecars and init containers share with the rest of the pod, which can only be done once the volumes, configs, routes and containers are all known.
+func validateContainerReferences(spec *AppBundleSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	// Port names are unique within the pod, the routes name the ports of the container of the app bundle
+	portNames := map[string]bool{}
+	for key := range spec.Routes {
+		portNames[key] = true
+	}
+
+	// Sourced envs from external secrets all land in the one secret of the app bundle, keyed by env name
+	externalSecrets := map[string]string{}
+	for key, sourcedEnv := range spec.SourcedEnvs {
+		if sourcedEnv.ExternalSecret != "" {
+			externalSecrets[key] = sourcedEnv.ExternalSecret
+		}
+	}
+
+	// Names are unique among all the containers of the pod, init containers included
+	containerNames := map[string]bool{}
+	for name := range spec.Sidecars {
+		containerNames[name] = true
+	}
+	for i, initContainer := range spec.InitContainers {
+		if containerNames[initContainer.Name] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("initContainers").Index(i).Child("name"), initContainer.Name))
+		}
+		containerNames[initContainer.Name] = true
+	}
+
+	checkExternalSecrets := func(sourcedEnvs map[string]AppBundleSourcedEnv, sourcedEnvsPath *field.Path) {
+		for _, key := range sortedKeys(sourcedEnvs) {
+			remoteRef := sourcedEnvs[key].ExternalSecret
+			if remoteRef == "" {
+				continue
+			}
+			if existing, ok := externalSecrets[key]; ok && existing != remoteRef {
+				allErrs = append(allErrs, field.Invalid(sourcedEnvsPath.Key(key).Child("externalSecret"), remoteRef, fmt.Sprintf("%s is already sourced from %s, every container gets the same value for it", key, existing)))
+			}
+			externalSecrets[key] = remoteRef
+		}
+	}
+
+	for _, name := range sortedKeys(spec.Sidecars) {
+		sidecar := spec.Sidecars[name]
+		sidecarPath := fldPath.Child("sidecars").Key(name)
+
+		for i, key := range sidecar.Volumes {
+			if _, ok := spec.Volumes[key]; !ok {
+				allErrs = append(allErrs, field.NotFound(sidecarPath.Child("volumes").Index(i), key))
+			}
+		}
+
+		for i, key := range sidecar.Configs {
+			if _, ok := spec.Configs[key]; !ok {
+				allErrs = append(allErrs, field.NotFound(sidecarPath.Child("configs").Index(i), key))
+			}
+		}
+
+		for _, portName := range sortedKeys(sidecar.Ports) {
+			if portNames[portName] {
+				allErrs = append(allErrs, field.Duplicate(sidecarPath.Child("ports").Key(portName), portName))
+			}
+			portNames[portName] = true
+		}
+
+		checkExternalSecrets(sidecar.SourcedEnvs, sidecarPath.Child("sourcedEnvs"))
+	}
+
+	for i, initContainer := range spec.InitContainers {
+		checkExternalSecrets(initContainer.SourcedEnvs, fldPath.Child("initContainers").Index(i).Child("sourcedEnvs"))
+	}
+
+	return allErrs
+}
+
+func validateMerge(merge *AppBundleMerge, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	kinds := GetMergeableFieldKinds()
+
+	for _, name := range sortedKeys(merge.Strategies) {
+		strategy := merge.Strategies[name]
+		kind, ok := kinds[name]
+		if !ok {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("strategies").Key(name), name, sortedKeys(kinds)))
+			continue
+		}
+		if !IsMergeStrategyAllowed(strategy, kind) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("strategies").Key(name), strategy, fmt.Sprintf("can not be used for a field of kind %s", kind)))
+		}
+	}
+
+	for _, name := range sortedKeys(merge.Delete) {
+		if kind, ok := kinds[name]; !ok || kind != reflect.Map {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("delete").Key(name), name, "entries can only be deleted from maps"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateImage(image *AppBundleImage, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if image == nil {
+		if complete {
+			allErrs = append(allErrs, field.Required(fldPath, "image is required"))
+		}
+		return allErrs
+	}
+
+	if image.Repository == nil {
+		if complete {
+			allErrs = append(allErrs, field.Required(fldPath.Child("repository"), "image repository is required"))
+		}
+	} else if *image.Repository == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("repository"), *image.Repository, "must not be empty"))
+	}
+
+	if image.Tag == nil {
+		if complete {
+			allErrs = append(allErrs, field.Required(fldPath.Child("tag"), "image tag is required"))
+		}
+	} else if *image.Tag == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("tag"), *image.Tag, "must not be empty"))
+	}
+
+	return allErrs
+}
+
+// validateImagePullSecrets checks the pull secrets and registry credentials of the image of the app bundle.
+func validateImagePullSecrets(image *AppBundleImage, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	for i, name := range image.PullSecrets {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("pullSecrets").Index(i), name, msg))
+		}
+	}
+
+	if registry := image.Registry; registry != nil {
+		registryPath := fldPath.Child("registry")
+		if registry.Server == "" {
+			allErrs = append(allErrs, field.Required(registryPath.Child("server"), "registry server is required"))
+		}
+		if registry.Username == "" {
+			allErrs = append(allErrs, field.Required(registryPath.Child("username"), "remote ref of the username is required"))
+		}
+		if registry.Password == "" {
+			allErrs = append(allErrs, field.Required(registryPath.Child("password"), "remote ref of the password is required"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateNoImagePullSecrets checks the image of a container other than the one of the app bundle sets no pull secrets, which would be ignored.
+func validateNoImagePullSecrets(image *AppBundleImage, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if image.PullSecrets != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("pullSecrets"), "set on spec.image, the pods pull the images of all their containers with the same secrets"))
+	}
+	if image.Registry != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("registry"), "set on spec.image, the pods pull the images of all their containers with the same secrets"))
+	}
+
+	return allErrs
+}
+
+func validateRoute(route AppBundleRoute, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if route.Port == nil {
+		if complete {
+			allErrs = append(allErrs, field.Required(fldPath.Child("port"), "route port is required"))
+		}
+	} else if *route.Port < 1 || *route.Port > 65535 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), *route.Port, "must be between 1 and 65535"))
+	}
+
+	if route.TargetPort != nil && (*route.TargetPort < 1 || *route.TargetPort > 65535) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("targetPort"), *route.TargetPort, "must be between 1 and 65535"))
+	}
+
+	if route.Ingress != nil && complete && (route.Ingress.Domain == nil || *route.Ingress.Domain == "") {
+		allErrs = append(allErrs, field.Required(fldPath.Child("ingress", "domain"), "ingress domain is required"))
+	}
+
+	return allErrs
+}
+
+func validateVolume(volume AppBundleVolume, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if complete && (volume.Path == nil || *volume.Path == "") {
+		allErrs = append(allErrs, field.Required(fldPath.Child("path"), "volume path is required"))
+	}
+
+	// A volume is exactly one of a host path, an empty dir, an existing claim or a claim generated with the given size
+	kinds := []string{}
+	if volume.HostPath != nil {
+		kinds = append(kinds, "hostPath")
+	}
+	if volume.EmptyDir != nil && *volume.EmptyDir {
+		kinds = append(kinds, "emptyDir")
+	}
+	if volume.ExistingClaim != nil {
+		kinds = append(kinds, "existingClaim")
+	}
+	if volume.Size != nil {
+		kinds = append(kinds, "size")
+	}
+
+	switch {
+	case len(kinds) > 1:
+		allErrs = append(allErrs, field.Invalid(fldPath, strings.Join(kinds, ", "), "only one of hostPath, emptyDir, existingClaim or size may be set"))
+	case len(kinds) == 0 && complete:
+		allErrs = append(allErrs, field.Required(fldPath, "one of hostPath, emptyDir, existingClaim or size must be set"))
+	}
+
+	if volume.HostPath != nil && *volume.HostPath == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("hostPath"), *volume.HostPath, "must not be empty"))
+	}
+	if volume.ExistingClaim != nil && *volume.ExistingClaim == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("existingClaim"), *volume.ExistingClaim, "must not be empty"))
+	}
+
+	if volume.Retain != nil && *volume.Retain && (volume.HostPath != nil || (volume.EmptyDir != nil && *volume.EmptyDir) || volume.ExistingClaim != nil) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("retain"), *volume.Retain, "only claims generated by the app bundle can be retained"))
+	}
+
+	if volume.Size != nil {
+		if size, err := resource.ParseQuantity(*volume.Size); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("size"), *volume.Size, err.Error()))
+		} else if size.Sign() <= 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("size"), *volume.Size, "must be greater than zero"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateBackup(backup *AppBundleVolumeLonghornBackup, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if backup.Frequency == nil {
+		if complete {
+			allErrs = append(allErrs, field.Required(fldPath.Child("frequency"), "backup frequency is required"))
+		}
+	} else if err := ValidateCron(*backup.Frequency); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("frequency"), *backup.Frequency, err.Error()))
+	}
+
+	if backup.Retain == nil {
+		if complete {
+			allErrs = append(allErrs, field.Required(fldPath.Child("retain"), "number of backups to retain is required"))
+		}
+	} else if *backup.Retain < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("retain"), *backup.Retain, "must be at least 1"))
+	}
+
+	return allErrs
+}
+
+func validateSourcedEnv(sourcedEnv AppBundleSourcedEnv, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	sources := []string{}
+	if sourcedEnv.ExternalSecret != "" {
+		sources = append(sources, "externalSecret")
+	}
+	if sourcedEnv.Secret != "" {
+		sources = append(sources, "secret")
+	}
+	if sourcedEnv.ConfigMap != "" {
+		sources = append(sources, "configMap")
+	}
+
+	switch {
+	case len(sources) > 1:
+		allErrs = append(allErrs, field.Invalid(fldPath, strings.Join(sources, ", "), "only one of externalSecret, secret or configMap may be set"))
+	case len(sources) == 0 && complete:
+		allErrs = append(allErrs, field.Required(fldPath, "one of externalSecret, secret or configMap must be set"))
+	}
+
+	// The key is only used to pick from an existing secret or config map
+	if complete && sourcedEnv.ExternalSecret == "" && len(sources) != 0 && sourcedEnv.Key == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("key"), "key is required when sourcing from a secret or config map"))
+	}
+
+	return allErrs
+}
+
+func validateConfig(config AppBundleConfig, complete bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if complete && config.FileName == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("fileName"), "config file name is required"))
+	}
+
+	if config.Existing != nil && len(config.Secrets) != 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("secrets"), config.Secrets, "secrets can not be templated into an existing config map"))
+	}
+
+	return allErrs
+}
+
+// ValidateCron checks that the expression is a standard five field cron expression (or descriptor such as @daily),
+// parsed the same way the CronJob controller does. Longhorn recurring jobs take the same expressions.
+func ValidateCron(expr string) error {
+	_, err := cron.ParseStandard(expr)
+	return err
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -15,8 +15,10 @@ type AppBundleBaseSpec struct {
 	Base           *string                        `json:"base,omitempty" copier:"-"`
 	Image          *AppBundleImage                `json:"image,omitempty"`
 	NodeSelector   *map[string]string             `json:"nodeSelector,omitempty"`
-	UseNvidia      *bool                          `json:"useNvidia,omitempty"`
+	Scheduling     *AppBundleScheduling           `json:"scheduling,omitempty"`
 	Replicas       *int32                         `json:"replicas,omitempty"`
+	Workload       *AppBundleWorkload             `json:"workload,omitempty"`
+	Strategy       *AppBundleStrategy             `json:"strategy,omitempty"`
 	Resources      *v1.ResourceRequirements       `json:"resources,omitempty"`
 	Envs           map[string]string              `json:"envs,omitempty"`
 	SecretStoreRef *string                        `json:"secretStoreRef,omitempty"`
@@ -33,6 +35,24 @@ type AppBundleBaseSpec struct {
 	Command        []*string                      `json:"command,omitempty"`
 	Args           []*string                      `json:"args,omitempty"`
 	Configs        map[string]AppBundleConfig     `json:"configs,omitempty"`
+	// Sidecars are extra containers run in the pod next to the one of the app bundle, keyed by container name.
+	Sidecars map[string]AppBundleSidecar `json:"sidecars,omitempty"`
+	// InitContainers run one after the other, in the order listed, before the containers of the pod start.
+	// They run after the containers copying over configs, so the configs are already in place.
+	InitContainers []AppBundleInitContainer `json:"initContainers,omitempty"`
+	// UseNvidia sets the pods up as the nvidia.com/gpu profile of the AtrokConfig says, without requesting any gpus, and makes every gpu visible.
+	//
+	// Deprecated: use Accelerators with the nvidia.com/gpu resource instead.
+	UseNvidia *bool `json:"useNvidia,omitempty"`
+	// Accelerators are the extended resources the container of the app bundle requests, keyed by resource name (e.g. nvidia.com/gpu).
+	// The pods also get the runtime class, tolerations and node labels of the profile for the resource in the AtrokConfig, if there is one.
+	Accelerators map[string]AppBundleAccelerator `json:"accelerators,omitempty"`
+	// Security is the security context of the pods, without it they run with none.
+	Security *AppBundleSecurity `json:"security,omitempty"`
+	// ServiceAccount makes the pods run under a service account of their own, granted the roles it lists, rather than the default one of the namespace.
+	ServiceAccount *AppBundleServiceAccount `json:"serviceAccount,omitempty"`
+	// Merge controls how this spec combines with the one inherited from the base.
+	Merge *AppBundleMerge `json:"merge,omitempty"`
 }
 
 // AppBundleBaseStatus defines the observed state of AppBundleBase
@@ -0,0 +1,179 @@
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultAtrokConfigName is the name of the AtrokConfig the operator reads unless told otherwise.
+const DefaultAtrokConfigName = "atrok"
+
+// DefaultMaxBaseDepth is the longest chain of AppBundleBases an AppBundle may inherit from.
+const DefaultMaxBaseDepth = 10
+
+// Resource names of the accelerators DefaultAtrokConfigSpec has a profile for.
+const (
+	NvidiaGPUResource = "nvidia.com/gpu"
+	AMDGPUResource    = "amd.com/gpu"
+	IntelGPUResource  = "gpu.intel.com/i915"
+)
+
+// AtrokConfigSpec defines the operator-wide settings used when building resources for every AppBundle.
+// Any field left unset falls back to the value returned by DefaultAtrokConfigSpec.
+type AtrokConfigSpec struct {
+	// ImagePullSecrets are the names of secrets attached to every generated pod.
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// AuthMiddleware is the traefik middleware attached to ingresses of routes with auth enabled. Empty disables it.
+	AuthMiddleware *string `json:"authMiddleware,omitempty"`
+	// EntryPoint is the traefik entry point ingresses are exposed on.
+	EntryPoint *string `json:"entryPoint,omitempty"`
+	// ClusterIssuer is the cert-manager cluster issuer used for ingress certificates.
+	ClusterIssuer *string `json:"clusterIssuer,omitempty"`
+	// HomepageInstance, if set, is added to the homepage annotations so multiple homepage instances can be told apart.
+	HomepageInstance *string `json:"homepageInstance,omitempty"`
+	// StorageClass is used for generated PVCs whose volume does not set a storage class.
+	StorageClass *string `json:"storageClass,omitempty"`
+	// ServiceType is used for generated services when the AppBundle does not set one, a change applies to every such AppBundle on its next reconcile.
+	ServiceType *v1.ServiceType `json:"serviceType,omitempty"`
+	// IngressAnnotations are added to every generated ingress, annotations set on the AppBundle take precedence.
+	IngressAnnotations map[string]string `json:"ingressAnnotations,omitempty"`
+	// RecordEffectiveSpec makes the operator record the spec it builds resources from in the status of every AppBundle.
+	RecordEffectiveSpec *bool `json:"recordEffectiveSpec,omitempty"`
+	// MaxBaseDepth is the longest chain of AppBundleBases an AppBundle may inherit from, longer chains fail to resolve.
+	// +kubebuilder:validation:Minimum=1
+	MaxBaseDepth *int `json:"maxBaseDepth,omitempty"`
+	// AllowClusterRBAC lets app bundles grant their service account access across the cluster, through cluster roles and cluster role bindings.
+	// Off by default, as anyone able to create an app bundle could otherwise grant themselves access to every namespace.
+	AllowClusterRBAC *bool `json:"allowClusterRBAC,omitempty"`
+	// BindableRoles are the names of the existing roles and cluster roles app bundles may grant their service account, none by default.
+	// The operator can only bind roles it is granted bind on, so config/rbac/bind_role.yaml has to list the same names as its resourceNames.
+	BindableRoles []string `json:"bindableRoles,omitempty"`
+	// AcceleratorProfiles set up the pods of app bundles requesting an accelerator, keyed by the resource name of the accelerator.
+	// Profiles are added to those of DefaultAtrokConfigSpec, replacing the default one of the same resource.
+	AcceleratorProfiles map[string]AcceleratorProfile `json:"acceleratorProfiles,omitempty"`
+}
+
+// AcceleratorProfile is how the pods of app bundles requesting an accelerator are set up to run on the nodes having it.
+type AcceleratorProfile struct {
+	// RuntimeClassName is set on the pods unless the scheduling of the app bundle sets one.
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+	// Tolerations are added to the pods, unless they already tolerate the same key.
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+	// NodeSelector is added to the node selector of the pods, the labels the app bundle selects on take precedence.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Envs are added to the container of the app bundle, unless it already has an env of the same name.
+	Envs map[string]string `json:"envs,omitempty"`
+}
+
+// AtrokConfigStatus defines the observed state of AtrokConfig
+type AtrokConfigStatus struct{}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=atc,path=atrokconfigs,singular=atrokconfig,scope=Cluster
+
+// AtrokConfig is the Schema for the atrokconfigs API
+type AtrokConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AtrokConfigSpec   `json:"spec,omitempty"`
+	Status AtrokConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AtrokConfigList contains a list of AtrokConfig
+type AtrokConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AtrokConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AtrokConfig{}, &AtrokConfigList{})
+}
+
+// DefaultAtrokConfigSpec returns the settings the operator used before AtrokConfig existed, these apply to any field left unset.
+func DefaultAtrokConfigSpec() AtrokConfigSpec {
+	authMiddleware := "auth-authelia@kubernetescrd"
+	entryPoint := "websecure"
+	clusterIssuer := "letsencrypt"
+	serviceType := v1.ServiceTypeClusterIP
+	maxBaseDepth := DefaultMaxBaseDepth
+	nvidiaRuntimeClass := "nvidia"
+	allowClusterRBAC := false
+
+	return AtrokConfigSpec{
+		ImagePullSecrets: []string{"regcred"},
+		AuthMiddleware:   &authMiddleware,
+		EntryPoint:       &entryPoint,
+		ClusterIssuer:    &clusterIssuer,
+		ServiceType:      &serviceType,
+		MaxBaseDepth:     &maxBaseDepth,
+		AllowClusterRBAC: &allowClusterRBAC,
+		AcceleratorProfiles: map[string]AcceleratorProfile{
+			NvidiaGPUResource: {
+				RuntimeClassName: &nvidiaRuntimeClass,
+				Tolerations:      []v1.Toleration{{Key: NvidiaGPUResource, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}},
+			},
+			AMDGPUResource: {
+				Tolerations: []v1.Toleration{{Key: AMDGPUResource, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}},
+			},
+			IntelGPUResource: {
+				Tolerations: []v1.Toleration{{Key: IntelGPUResource, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}},
+			},
+		},
+	}
+}
+
+// WithDefaults returns a copy of the spec where every unset field is taken from DefaultAtrokConfigSpec.
+func (s AtrokConfigSpec) WithDefaults() AtrokConfigSpec {
+	defaults := DefaultAtrokConfigSpec()
+	out := *s.DeepCopy()
+
+	if out.ImagePullSecrets == nil {
+		out.ImagePullSecrets = defaults.ImagePullSecrets
+	}
+	if out.AuthMiddleware == nil {
+		out.AuthMiddleware = defaults.AuthMiddleware
+	}
+	if out.EntryPoint == nil {
+		out.EntryPoint = defaults.EntryPoint
+	}
+	if out.ClusterIssuer == nil {
+		out.ClusterIssuer = defaults.ClusterIssuer
+	}
+	if out.ServiceType == nil {
+		out.ServiceType = defaults.ServiceType
+	}
+	if out.MaxBaseDepth == nil {
+		out.MaxBaseDepth = defaults.MaxBaseDepth
+	}
+	if out.AllowClusterRBAC == nil {
+		out.AllowClusterRBAC = defaults.AllowClusterRBAC
+	}
+	for name, profile := range defaults.AcceleratorProfiles {
+		if _, ok := out.AcceleratorProfiles[name]; !ok {
+			if out.AcceleratorProfiles == nil {
+				out.AcceleratorProfiles = map[string]AcceleratorProfile{}
+			}
+			out.AcceleratorProfiles[name] = profile
+		}
+	}
+
+	return out
+}
+
+// GetImagePullSecrets returns the image pull secrets as references usable in a pod spec.
+func (s AtrokConfigSpec) GetImagePullSecrets() []v1.LocalObjectReference {
+	if len(s.ImagePullSecrets) == 0 {
+		return nil
+	}
+
+	refs := make([]v1.LocalObjectReference, 0, len(s.ImagePullSecrets))
+	for _, name := range s.ImagePullSecrets {
+		refs = append(refs, v1.LocalObjectReference{Name: name})
+	}
+	return refs
+}
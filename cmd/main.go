@@ -31,6 +31,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -38,6 +39,7 @@ import (
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 
 	"github.com/atropos112/atrok/internal/controller"
+	webhookv1alpha1 "github.com/atropos112/atrok/internal/webhook/v1alpha1"
 	extsec "github.com/external-secrets/external-secrets/apis/externalsecrets/v1"
 	//+kubebuilder:scaffold:imports
 )
@@ -63,6 +65,7 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var atrokConfigName string
 	if os.Getenv("ATROK_PYROSCOPE_ENABLED") == "true" {
 		pyroscope.Start(pyroscope.Config{
 			ApplicationName: "atrok",
@@ -113,6 +116,8 @@ func main() {
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":9080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":9081", "The address the probe endpoint binds to.")
+	flag.StringVar(&atrokConfigName, "atrok-config", atroxyzv1alpha1.DefaultAtrokConfigName,
+		"The name of the cluster-scoped AtrokConfig holding the operator-wide settings.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -153,20 +158,38 @@ func main() {
 		os.Exit(1)
 	}
 
+	// App bundles whose base changed, sent by the base controller and reconciled by the app bundle controller
+	baseEvents := make(chan event.GenericEvent, 128)
 	if err = (&controller.AppBundleReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:     mgr.GetClient(),
+		Scheme:     mgr.GetScheme(),
+		ConfigName: atrokConfigName,
+		Recorder:   mgr.GetEventRecorder("appbundle-controller"),
+		BaseEvents: baseEvents,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AppBundle")
 		os.Exit(1)
 	}
 	if err = (&controller.AppBundleBaseReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorder("appbundlebase-controller"),
+		AppBundleEvents: baseEvents,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AppBundleBase")
 		os.Exit(1)
 	}
+	// Webhooks need serving certificates, set ENABLE_WEBHOOKS=false to run without them (e.g. locally)
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = webhookv1alpha1.SetupAppBundleWebhookWithManager(mgr, atrokConfigName); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AppBundle")
+			os.Exit(1)
+		}
+		if err = webhookv1alpha1.SetupAppBundleBaseWebhookWithManager(mgr, atrokConfigName); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AppBundleBase")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
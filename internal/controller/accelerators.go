@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"maps"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// SetAccelerators requests the accelerators of the app bundle for its container and sets the pods up as the profiles of the accelerators say.
+// What the app bundle sets itself is kept, e.g. a runtime class in its scheduling or a node label it selects on.
+func SetAccelerators(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec, podSpec *corev1.PodSpec) {
+	accelerators := ab.Spec.GetAccelerators()
+	container := &podSpec.Containers[0]
+
+	for _, name := range getSortedKeys(accelerators) {
+		if count := accelerators[name].Count; count != nil && *count > 0 {
+			// Cloned as they may still be those of the app bundle
+			resourceName := corev1.ResourceName(name)
+			quantity := *resource.NewQuantity(*count, resource.DecimalSI)
+			container.Resources.Limits = maps.Clone(container.Resources.Limits)
+			if container.Resources.Limits == nil {
+				container.Resources.Limits = corev1.ResourceList{}
+			}
+			container.Resources.Limits[resourceName] = quantity
+
+			// Extended resources can not be overcommitted, a request has to match the limit
+			if _, ok := container.Resources.Requests[resourceName]; ok {
+				container.Resources.Requests = maps.Clone(container.Resources.Requests)
+				container.Resources.Requests[resourceName] = quantity
+			}
+		}
+
+		profile, ok := cfg.AcceleratorProfiles[name]
+		if !ok {
+			continue
+		}
+
+		for _, toleration := range profile.Tolerations {
+			if !slices.ContainsFunc(podSpec.Tolerations, func(t corev1.Toleration) bool { return t.Key == toleration.Key }) {
+				podSpec.Tolerations = append(podSpec.Tolerations, toleration)
+			}
+		}
+
+		if podSpec.RuntimeClassName == nil && profile.RuntimeClassName != nil {
+			runtimeClassName := *profile.RuntimeClassName
+			podSpec.RuntimeClassName = &runtimeClassName
+		}
+
+		if len(profile.NodeSelector) != 0 {
+			nodeSelector := maps.Clone(profile.NodeSelector)
+			maps.Copy(nodeSelector, podSpec.NodeSelector)
+			podSpec.NodeSelector = nodeSelector
+		}
+
+		for _, key := range getSortedKeys(profile.Envs) {
+			addEnvIfMissing(container, corev1.EnvVar{Name: key, Value: profile.Envs[key]})
+		}
+	}
+
+	if ab.Spec.UseNvidia != nil && *ab.Spec.UseNvidia {
+		addEnvIfMissing(container, corev1.EnvVar{Name: "NVIDIA_VISIBLE_DEVICES", Value: "all"})
+	}
+}
+
+// addEnvIfMissing adds the env to the container unless it already has one of the same name.
+func addEnvIfMissing(container *corev1.Container, env corev1.EnvVar) {
+	if !slices.ContainsFunc(container.Env, func(e corev1.EnvVar) bool { return e.Name == env.Name }) {
+		container.Env = append(container.Env, env)
+	}
+}
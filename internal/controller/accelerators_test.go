@@ -0,0 +1,91 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle with accelerators", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		count := int64(2)
+		ab.Spec.Accelerators = map[string]atroxyzv1alpha1.AppBundleAccelerator{atroxyzv1alpha1.AMDGPUResource: {Count: &count}}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should request the accelerators and tolerate the nodes having them", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		podSpec := deployment.Spec.Template.Spec
+		gpus := podSpec.Containers[0].Resources.Limits[corev1.ResourceName("amd.com/gpu")]
+		Expect(gpus.Value()).To(Equal(int64(2)))
+		Expect(podSpec.Tolerations).To(ConsistOf(corev1.Toleration{Key: "amd.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}))
+		Expect(podSpec.RuntimeClassName).To(BeNil())
+	})
+
+	It("Should set the pods up as the profile in the config says", func() {
+		runtimeClassName := "rocm"
+		cfg := atroxyzv1alpha1.AtrokConfigSpec{
+			AcceleratorProfiles: map[string]atroxyzv1alpha1.AcceleratorProfile{
+				atroxyzv1alpha1.AMDGPUResource: {
+					RuntimeClassName: &runtimeClassName,
+					NodeSelector:     map[string]string{"gpu.vendor": "amd"},
+					Envs:             map[string]string{"HSA_OVERRIDE_GFX_VERSION": "10.3.0"},
+				},
+			},
+		}.WithDefaults()
+
+		deployment, err := CreateExpectedDeployment(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		podSpec := deployment.Spec.Template.Spec
+		Expect(*podSpec.RuntimeClassName).To(Equal("rocm"))
+		Expect(podSpec.NodeSelector).To(Equal(map[string]string{"gpu.vendor": "amd"}))
+		Expect(podSpec.Tolerations).To(BeEmpty())
+		Expect(podSpec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "HSA_OVERRIDE_GFX_VERSION", Value: "10.3.0"}))
+
+		// The profiles of the other accelerators are still there
+		Expect(cfg.AcceleratorProfiles).To(HaveKey(atroxyzv1alpha1.NvidiaGPUResource))
+	})
+
+	It("Should keep UseNvidia working as the nvidia accelerator without any gpus", func() {
+		useNvidia := true
+		ab.Spec.Accelerators = nil
+		ab.Spec.UseNvidia = &useNvidia
+
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		deployment, err := CreateExpectedDeployment(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		podSpec := deployment.Spec.Template.Spec
+		Expect(*podSpec.RuntimeClassName).To(Equal("nvidia"))
+		Expect(podSpec.Tolerations).To(HaveLen(1))
+		Expect(podSpec.Tolerations[0].Key).To(Equal("nvidia.com/gpu"))
+		Expect(podSpec.Containers[0].Resources.Limits).NotTo(HaveKey(corev1.ResourceName("nvidia.com/gpu")))
+		Expect(podSpec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "NVIDIA_VISIBLE_DEVICES", Value: "all"}))
+	})
+})
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/applyconfigurations"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// ToApplyConfiguration turns the object as generated for the app bundle into the apply configuration sent to the api server.
+// Built-in kinds get the typed apply configuration of client-go, custom resources (e.g. external secrets) an unstructured one.
+// Only the fields atrok means to own are set on it: those set to a non-zero value, and pointers that are set at all.
+// The api types use pointers wherever the zero value means something (e.g. replicas: 0 or privileged: false), as the apply configurations do,
+// so a zero value that is not behind a pointer (e.g. resources: {} or minReadySeconds: 0) is just unset and left to the api server and other managers.
+func ToApplyConfiguration(scheme *runtime.Scheme, obj client.Object) (runtime.ApplyConfiguration, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	content, _ := appliedFields(reflect.ValueOf(obj)).(map[string]any)
+	if content == nil {
+		content = map[string]any{}
+	}
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]any); ok {
+		for _, key := range []string{"resourceVersion", "managedFields", "uid", "generation", "creationTimestamp"} {
+			delete(metadata, key)
+		}
+	}
+	content["apiVersion"], content["kind"] = gvk.ToAPIVersionAndKind()
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if applyConfiguration, ok := applyconfigurations.ForKind(gvk).(runtime.ApplyConfiguration); ok {
+		if err := json.Unmarshal(data, applyConfiguration); err != nil {
+			return nil, err
+		}
+		return applyConfiguration, nil
+	}
+
+	applied := &unstructured.Unstructured{}
+	if err := applied.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return client.ApplyConfigurationFromUnstructured(applied), nil
+}
+
+// FromApplyConfiguration reads the object the api server returned for the apply configuration back into an object of the same type as obj.
+func FromApplyConfiguration(applyConfiguration runtime.ApplyConfiguration, obj client.Object) (client.Object, error) {
+	data, err := json.Marshal(applyConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a client object", obj)
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// appliedFields returns the json form of the value holding only the fields meant to be owned, see ToApplyConfiguration.
+// Returns nil when nothing in the value is meant, so its parent leaves it out.
+func appliedFields(value reflect.Value) any {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		// A pointer is set on purpose, even to a zero value or an empty struct (e.g. emptyDir: {})
+		if fields := appliedFields(value.Elem()); fields != nil {
+			return fields
+		}
+		return zeroJSON(value.Elem())
+	}
+
+	if value.IsZero() {
+		return nil
+	}
+
+	// Types with a json form of their own (quantities, int or strings, times, bytes) are taken as they are
+	if isJSONLeaf(value) {
+		return marshalled(value)
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		fields := map[string]any{}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, inline := jsonFieldName(field)
+			if name == "-" {
+				continue
+			}
+
+			fieldValue := appliedFields(value.Field(i))
+			if fieldValue == nil {
+				continue
+			}
+			if nested, ok := fieldValue.(map[string]any); ok && inline {
+				for key, nestedValue := range nested {
+					fields[key] = nestedValue
+				}
+				continue
+			}
+			fields[name] = fieldValue
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		return fields
+	case reflect.Map:
+		entries := map[string]any{}
+		for _, key := range value.MapKeys() {
+			// Every entry is meant, even one with a zero value (e.g. a label with an empty value)
+			entry := appliedFields(value.MapIndex(key))
+			if entry == nil {
+				entry = zeroJSON(value.MapIndex(key))
+			}
+			entries[key.String()] = entry
+		}
+		return entries
+	case reflect.Slice, reflect.Array:
+		items := make([]any, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			item := appliedFields(value.Index(i))
+			if item == nil {
+				item = zeroJSON(value.Index(i))
+			}
+			items = append(items, item)
+		}
+		return items
+	default:
+		return value.Interface()
+	}
+}
+
+// isJSONLeaf reports whether the value has a json form of its own rather than one made of its fields.
+func isJSONLeaf(value reflect.Value) bool {
+	if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+		return true
+	}
+
+	marshaler := reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	return value.Type().Implements(marshaler) || reflect.PointerTo(value.Type()).Implements(marshaler)
+}
+
+// marshalled returns the json form of the value as decoded into plain maps, lists and scalars.
+func marshalled(value reflect.Value) any {
+	pointer := reflect.New(value.Type())
+	pointer.Elem().Set(value)
+
+	data, err := json.Marshal(pointer.Interface())
+	if err != nil {
+		return nil
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// zeroJSON returns the json form of a zero value set on purpose: an empty object for structs, the zero itself otherwise.
+func zeroJSON(value reflect.Value) any {
+	switch value.Kind() {
+	case reflect.Struct:
+		if isJSONLeaf(value) {
+			return marshalled(value)
+		}
+		return map[string]any{}
+	case reflect.Map:
+		return map[string]any{}
+	case reflect.Slice, reflect.Array:
+		return []any{}
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return zeroJSON(value.Elem())
+	default:
+		return value.Interface()
+	}
+}
+
+// jsonFieldName returns the name of the struct field in json and whether it is inlined into its parent.
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" && field.Anonymous {
+		return "", true
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(options, "inline")
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups=atro.xyz,resources=atrokconfigs,verbs=get;list;watch
+
+// GetAtrokConfig returns the operator-wide configuration with defaults applied to anything left unset.
+// If no AtrokConfig exists the defaults are returned as they are.
+func (r *AppBundleReconciler) GetAtrokConfig(ctx context.Context) (*atroxyzv1alpha1.AtrokConfigSpec, error) {
+	atrokConfig := &atroxyzv1alpha1.AtrokConfig{}
+	if err := r.Get(ctx, client.ObjectKey{Name: r.atrokConfigName()}, atrokConfig); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		defaults := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		return &defaults, nil
+	}
+
+	cfg := atrokConfig.Spec.WithDefaults()
+	return &cfg, nil
+}
+
+func (r *AppBundleReconciler) atrokConfigName() string {
+	if r.ConfigName == "" {
+		return atroxyzv1alpha1.DefaultAtrokConfigName
+	}
+	return r.ConfigName
+}
+
+// mapAtrokConfigToAppBundles enqueues every AppBundle when the AtrokConfig in use changes as all of them are built from it.
+func (r *AppBundleReconciler) mapAtrokConfigToAppBundles(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetName() != r.atrokConfigName() {
+		return nil
+	}
+
+	abList := &atroxyzv1alpha1.AppBundleList{}
+	if err := r.List(ctx, abList); err != nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(abList.Items))
+	for _, ab := range abList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: GetAppBundleNamespacedName(&ab)})
+	}
+	return requests
+}
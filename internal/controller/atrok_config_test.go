@@ -0,0 +1,108 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Operator-wide AtrokConfig", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme, ConfigName: GetRandomName()}
+
+		// ADD ROUTE WITH INGRESS
+		port := 80
+		domain := "test.com"
+		auth := true
+		ab.Spec.Routes = map[string]atroxyzv1alpha1.AppBundleRoute{
+			"web": {Port: &port, Ingress: &atroxyzv1alpha1.AppBundleRouteIngress{Domain: &domain, Auth: &auth}},
+		}
+
+		// CREATE APPBUNDLE
+		er := rec.Create(ctx, ab)
+		Expect(er).NotTo(HaveOccurred())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+	})
+
+	It("Should fall back to defaults when no AtrokConfig exists", func() {
+		By("Reading the config without creating one")
+		cfg, err := rec.GetAtrokConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*cfg).To(Equal(atroxyzv1alpha1.DefaultAtrokConfigSpec()))
+	})
+
+	It("Should build ingresses from the AtrokConfig", func() {
+		By("Creating an AtrokConfig and reconciling ingress using app bundle")
+		entryPoint := "web"
+		clusterIssuer := "staging"
+		noAuth := ""
+		atrokConfig := &atroxyzv1alpha1.AtrokConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: rec.ConfigName},
+			Spec: atroxyzv1alpha1.AtrokConfigSpec{
+				EntryPoint:         &entryPoint,
+				ClusterIssuer:      &clusterIssuer,
+				AuthMiddleware:     &noAuth,
+				IngressAnnotations: map[string]string{"example.com/extra": "yes"},
+			},
+		}
+		err := rec.Create(ctx, atrokConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = rec.ReconcileIngress(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+
+		// GET the resource
+		ingress := &netv1.Ingress{ObjectMeta: GetObjectMetaForIngress(ab)}
+		err = rec.Get(ctx, client.ObjectKeyFromObject(ingress), ingress)
+		Expect(err).NotTo(HaveOccurred())
+
+		// CHECK the resource
+		Expect(ingress.Annotations).To(HaveKeyWithValue("traefik.ingress.kubernetes.io/router.entryPoints", entryPoint))
+		Expect(ingress.Annotations).To(HaveKeyWithValue("cert-manager.io/cluster-issuer", clusterIssuer))
+		Expect(ingress.Annotations).To(HaveKeyWithValue("example.com/extra", "yes"))
+		Expect(ingress.Annotations).NotTo(HaveKey("traefik.ingress.kubernetes.io/router.middlewares"))
+	})
+
+	It("Should default the service type from the AtrokConfig in memory only", func() {
+		By("Creating an AtrokConfig and defaulting the app bundle as the reconciler does")
+		serviceType := corev1.ServiceTypeLoadBalancer
+		recordEffectiveSpec := true
+		atrokConfig := &atroxyzv1alpha1.AtrokConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: rec.ConfigName},
+			Spec:       atroxyzv1alpha1.AtrokConfigSpec{ServiceType: &serviceType, RecordEffectiveSpec: &recordEffectiveSpec},
+		}
+		Expect(rec.Create(ctx, atrokConfig)).To(Succeed())
+
+		cfg, err := rec.GetAtrokConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		ab.Default(cfg)
+		SetEffectiveSpec(ab, cfg)
+		Expect(*ab.Status.EffectiveSpec.ServiceType).To(Equal(serviceType))
+
+		// CHECK the stored app bundle still leaves the service type to the config
+		stored := &atroxyzv1alpha1.AppBundle{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), stored)).To(Succeed())
+		Expect(stored.Spec.ServiceType).To(BeNil())
+
+		service, err := CreateExpectedService(stored, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.Spec.Type).To(Equal(serviceType))
+	})
+})
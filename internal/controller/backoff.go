@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Backoff between reconciles of an app bundle that keep failing.
+const (
+	// BackoffBase is the wait after the first failure, doubling with every one after it.
+	BackoffBase = 5 * time.Second
+	// BackoffMax caps the wait however many times the reconcile failed.
+	BackoffMax = 10 * time.Minute
+	// BackoffJitter is the fraction the wait is randomly shortened or lengthened by, so app bundles failing together do not retry together.
+	BackoffJitter = 0.2
+)
+
+// GetBackoff returns how long to wait before retrying after the given number of consecutive failures, see BackoffBase, BackoffMax and BackoffJitter.
+func GetBackoff(failures int32) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+
+	backoff := float64(BackoffMax)
+	if exp := float64(BackoffBase) * math.Pow(2, float64(failures-1)); exp < backoff {
+		backoff = exp
+	}
+	backoff *= 1 + BackoffJitter*(2*rand.Float64()-1)
+
+	return time.Duration(backoff)
+}
+
+// RecordReconcileResult updates the failure bookkeeping in the status of the app bundle and returns how long to wait before retrying, zero if the reconcile succeeded.
+func RecordReconcileResult(ab *atroxyzv1alpha1.AppBundle, reconcileErr error, now time.Time) time.Duration {
+	if reconcileErr == nil {
+		ab.Status.ConsecutiveFailures = 0
+		ab.Status.NextRetryTime = nil
+		return 0
+	}
+
+	ab.Status.ConsecutiveFailures++
+	backoff := GetBackoff(ab.Status.ConsecutiveFailures)
+	nextRetryTime := metav1.NewTime(now.Add(backoff))
+	ab.Status.NextRetryTime = &nextRetryTime
+
+	return backoff
+}
+
+// GetRemainingBackoff returns how long the app bundle still has to wait before being retried after a failure.
+// Changes to the spec are never held back, so it returns false once the generation moved past the failed one.
+func GetRemainingBackoff(ab *atroxyzv1alpha1.AppBundle, now time.Time) (time.Duration, bool) {
+	if ab.Status.ConsecutiveFailures == 0 || ab.Status.NextRetryTime == nil || ab.Status.ObservedGeneration != ab.Generation {
+		return 0, false
+	}
+
+	remaining := ab.Status.NextRetryTime.Sub(now)
+	return remaining, remaining > 0
+}
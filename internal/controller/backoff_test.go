@@ -0,0 +1,77 @@
+package controller
+
+// Test framework setup
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Backing off from failing reconciles", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var now time.Time
+
+	BeforeEach(func() {
+		// SETUP
+		ab = GetBasicAppBundle()
+		ab.Generation = 1
+		ab.Status.ObservedGeneration = 1
+		now = time.Now()
+	})
+
+	It("Should double the wait with every failure up to the maximum", func() {
+		within := func(d time.Duration) OmegaMatcher {
+			return BeNumerically("~", d, float64(d)*BackoffJitter)
+		}
+
+		Expect(GetBackoff(0)).To(BeZero())
+		Expect(GetBackoff(1)).To(within(BackoffBase))
+		Expect(GetBackoff(2)).To(within(2 * BackoffBase))
+		Expect(GetBackoff(4)).To(within(8 * BackoffBase))
+		Expect(GetBackoff(100)).To(within(BackoffMax))
+	})
+
+	It("Should count failures in the status and reset them on success", func() {
+		err := errors.New("boom")
+		Expect(RecordReconcileResult(ab, err, now)).To(BeNumerically(">", 0))
+		Expect(RecordReconcileResult(ab, err, now)).To(BeNumerically(">", BackoffBase))
+		Expect(ab.Status.ConsecutiveFailures).To(Equal(int32(2)))
+		Expect(ab.Status.NextRetryTime.Time).To(BeTemporally(">", now))
+
+		Expect(RecordReconcileResult(ab, nil, now)).To(BeZero())
+		Expect(ab.Status.ConsecutiveFailures).To(BeZero())
+		Expect(ab.Status.NextRetryTime).To(BeNil())
+	})
+
+	It("Should hold back retries until the next retry time unless the spec changed", func() {
+		RecordReconcileResult(ab, errors.New("boom"), now)
+
+		remaining, ok := GetRemainingBackoff(ab, now)
+		Expect(ok).To(BeTrue())
+		Expect(remaining).To(BeNumerically(">", 0))
+
+		By("Retrying once the time has come")
+		_, ok = GetRemainingBackoff(ab, now.Add(2*BackoffBase))
+		Expect(ok).To(BeFalse())
+
+		By("Retrying straight away after a spec change")
+		ab.Generation = 2
+		_, ok = GetRemainingBackoff(ab, now)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should forget the mutexes of deleted app bundles", func() {
+		getMutex("appBundle", ab.Name, ab.Namespace)
+		getMutex("configmap", ab.Name, ab.Namespace)
+
+		releaseMutexes(ab.Name, ab.Namespace)
+		for _, mutexes := range resourceMutexes.m {
+			Expect(mutexes).NotTo(HaveKey(ab.Name + "-" + ab.Namespace))
+		}
+	})
+})
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// BaseNotFoundError is returned when a base referenced in a chain of bases does not exist.
+type BaseNotFoundError struct {
+	Name  string
+	Chain []string
+}
+
+// BaseCycleError is returned when a chain of bases loops back onto a base already in it.
+type BaseCycleError struct {
+	Chain []string
+}
+
+// BaseChainTooDeepError is returned when a chain of bases is longer than allowed.
+type BaseChainTooDeepError struct {
+	Chain    []string
+	MaxDepth int
+}
+
+func (e BaseNotFoundError) Error() string {
+	return fmt.Sprintf("base %s referenced by %s does not exist", e.Name, e.Chain[len(e.Chain)-1])
+}
+
+func (e BaseCycleError) Error() string {
+	return "bases form a cycle: " + strings.Join(e.Chain, " -> ")
+}
+
+func (e BaseChainTooDeepError) Error() string {
+	return fmt.Sprintf("chain of bases is deeper than %d: %s -> ...", e.MaxDepth, strings.Join(e.Chain, " -> "))
+}
+
+// GetBaseChain returns abb followed by its base, the base of that base and so on, nearest first.
+// The chain must not be longer than maxDepth, loop or reference a base that does not exist.
+func GetBaseChain(ctx context.Context, c client.Reader, abb *atroxyzv1alpha1.AppBundleBase, maxDepth int) ([]*atroxyzv1alpha1.AppBundleBase, error) {
+	chain := []*atroxyzv1alpha1.AppBundleBase{abb}
+	names := []string{abb.Name}
+
+	for current := abb; current.Spec.Base != nil; {
+		next := *current.Spec.Base
+		if slices.Contains(names, next) {
+			return nil, BaseCycleError{Chain: append(names, next)}
+		}
+		if len(chain) >= maxDepth {
+			return nil, BaseChainTooDeepError{Chain: names, MaxDepth: maxDepth}
+		}
+
+		nextAbb := &atroxyzv1alpha1.AppBundleBase{}
+		if err := c.Get(ctx, client.ObjectKey{Name: next}, nextAbb); err != nil {
+			if k8serror.IsNotFound(err) {
+				return nil, BaseNotFoundError{Name: next, Chain: names}
+			}
+			return nil, err
+		}
+
+		chain = append(chain, nextAbb)
+		names = append(names, next)
+		current = nextAbb
+	}
+
+	return chain, nil
+}
+
+// ResolveBase merges the bases of the app bundle into it, recording the outcome in the BaseResolved condition.
+// Only meant for the reconcile of the app bundle, anything else resolving a base uses MergeBase.
+func (r *AppBundleReconciler) ResolveBase(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	if ab.Spec.Base == nil {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionBaseResolved, true, atroxyzv1alpha1.ReasonNotRequired, "No base defined")
+		return nil
+	}
+
+	base := *ab.Spec.Base
+	if err := r.MergeBase(ctx, ab); err != nil {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionBaseResolved, false, GetBaseChainReason(err), err.Error())
+		return err
+	}
+
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionBaseResolved, true, atroxyzv1alpha1.ReasonResolved, "Resolved base "+base)
+	return nil
+}
+
+// MergeBase merges the chain of bases of the app bundle into it, doing nothing if it has no base.
+// Only the app bundle passed in is changed, so it is safe to use outside of a reconcile, e.g. by the webhooks or the watches.
+func (r *AppBundleReconciler) MergeBase(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	if ab.Spec.Base == nil {
+		return nil
+	}
+
+	abb := &atroxyzv1alpha1.AppBundleBase{}
+	if err := r.Get(ctx, client.ObjectKey{Name: *ab.Spec.Base}, abb); err != nil {
+		if k8serror.IsNotFound(err) {
+			return BaseNotFoundError{Name: *ab.Spec.Base, Chain: []string{ab.Name}}
+		}
+		return err
+	}
+
+	return ResolveAppBundleBase(ctx, r, ab, abb)
+}
+
+// GetBaseChainReason returns the condition reason describing why a chain of bases failed to resolve.
+func GetBaseChainReason(err error) string {
+	var notFound BaseNotFoundError
+	var cycle BaseCycleError
+	var tooDeep BaseChainTooDeepError
+
+	switch {
+	case errors.As(err, &notFound):
+		return atroxyzv1alpha1.ReasonBaseNotFound
+	case errors.As(err, &cycle):
+		return atroxyzv1alpha1.ReasonBaseCycle
+	case errors.As(err, &tooDeep):
+		return atroxyzv1alpha1.ReasonBaseTooDeep
+	default:
+		return atroxyzv1alpha1.ReasonReconcileFailed
+	}
+}
+
+// BaseIndexField indexes app bundles and app bundle bases by the name of the base they inherit from.
+const BaseIndexField = "spec.base"
+
+// BaseIndexFunc returns the base an app bundle or app bundle base inherits from, for BaseIndexField.
+func BaseIndexFunc(obj client.Object) []string {
+	var base *string
+	switch o := obj.(type) {
+	case *atroxyzv1alpha1.AppBundle:
+		base = o.Spec.Base
+	case *atroxyzv1alpha1.AppBundleBase:
+		base = o.Spec.Base
+	}
+
+	if base == nil {
+		return nil
+	}
+	return []string{*base}
+}
+
+// IndexBase registers BaseIndexField for both app bundles and app bundle bases.
+func IndexBase(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &atroxyzv1alpha1.AppBundle{}, BaseIndexField, BaseIndexFunc); err != nil {
+		return err
+	}
+	return indexer.IndexField(ctx, &atroxyzv1alpha1.AppBundleBase{}, BaseIndexField, BaseIndexFunc)
+}
+
+// GetDependentAppBundles returns every app bundle inheriting from the named base, directly or through other bases.
+// The client must have BaseIndexField registered, see IndexBase. Cycles in the bases are walked only once.
+func GetDependentAppBundles(ctx context.Context, c client.Reader, name string) ([]atroxyzv1alpha1.AppBundle, error) {
+	abs := []atroxyzv1alpha1.AppBundle{}
+	visited := map[string]bool{}
+	queue := []string{name}
+
+	for len(queue) > 0 {
+		base := queue[0]
+		queue = queue[1:]
+		if visited[base] {
+			continue
+		}
+		visited[base] = true
+
+		abList := &atroxyzv1alpha1.AppBundleList{}
+		if err := c.List(ctx, abList, client.MatchingFields{BaseIndexField: base}); err != nil {
+			return nil, err
+		}
+		abs = append(abs, abList.Items...)
+
+		abbList := &atroxyzv1alpha1.AppBundleBaseList{}
+		if err := c.List(ctx, abbList, client.MatchingFields{BaseIndexField: base}); err != nil {
+			return nil, err
+		}
+		for _, abb := range abbList.Items {
+			queue = append(queue, abb.Name)
+		}
+	}
+
+	return abs, nil
+}
@@ -7,8 +7,13 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 	//+kubebuilder:scaffold:imports
@@ -173,4 +178,307 @@ var _ = Describe("Correctly populated heavily populated AppBundle", func() {
 
 		Expect(ab.Spec.Routes).To(HaveLen(2))
 	})
+
+	It("Should record which base each value came from", func() {
+		By("Applying base resolver to app bundle with provenance enabled")
+		route_port := 9000
+		env_value := "UTC"
+		abb := &atroxyzv1alpha1.AppBundleBase{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: GetRandomName(),
+			},
+			Spec: atroxyzv1alpha1.AppBundleBaseSpec{
+				Routes: map[string]atroxyzv1alpha1.AppBundleRoute{
+					"test":    {Port: &route_port},
+					"metrics": {Port: &route_port},
+				},
+				Envs: map[string]string{"TZ": env_value},
+			},
+		}
+		ab.Spec.Base = &abb.Name
+		ab.Status.Provenance = map[string]string{}
+		RecordProvenance(ab, &ab.Spec, ProvenanceSelf)
+
+		err := ResolveAppBundleBase(ctx, abRec, ab, abb)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ab.Status.Provenance).To(HaveKeyWithValue("image", ProvenanceSelf))
+		Expect(ab.Status.Provenance).To(HaveKeyWithValue("routes[test]", ProvenanceSelf))
+		Expect(ab.Status.Provenance).To(HaveKeyWithValue("routes[metrics]", abb.Name))
+		Expect(ab.Status.Provenance).To(HaveKeyWithValue("envs[TZ]", abb.Name))
+		Expect(ab.Status.Provenance).NotTo(HaveKey("base"))
+	})
+})
+
+var _ = Describe("AppBundle with a broken chain of bases", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var abRec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		abRec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+	})
+
+	It("Should report a missing base", func() {
+		By("Resolving a base that does not exist")
+		base := GetRandomName()
+		ab.Spec.Base = &base
+
+		err := abRec.ResolveBase(ctx, ab)
+		Expect(err).To(BeAssignableToTypeOf(BaseNotFoundError{}))
+
+		condition := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionBaseResolved)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(atroxyzv1alpha1.ReasonBaseNotFound))
+	})
+
+	It("Should stop at a cycle", func() {
+		By("Creating two bases inheriting from each other")
+		nameA := GetRandomName()
+		nameB := GetRandomName()
+		abbA := &atroxyzv1alpha1.AppBundleBase{ObjectMeta: metav1.ObjectMeta{Name: nameA}, Spec: atroxyzv1alpha1.AppBundleBaseSpec{Base: &nameB}}
+		abbB := &atroxyzv1alpha1.AppBundleBase{ObjectMeta: metav1.ObjectMeta{Name: nameB}, Spec: atroxyzv1alpha1.AppBundleBaseSpec{Base: &nameA}}
+		Expect(abRec.Create(ctx, abbA)).To(Succeed())
+		Expect(abRec.Create(ctx, abbB)).To(Succeed())
+		ab.Spec.Base = &nameA
+
+		err := abRec.ResolveBase(ctx, ab)
+		Expect(err).To(BeAssignableToTypeOf(BaseCycleError{}))
+
+		condition := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionBaseResolved)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal(atroxyzv1alpha1.ReasonBaseCycle))
+	})
+	It("Should merge a base without leaving anything behind outside of a reconcile", func() {
+		By("Merging a base that does not exist")
+		base := GetRandomName()
+		ab.Spec.Base = &base
+
+		err := abRec.MergeBase(ctx, ab)
+		Expect(err).To(BeAssignableToTypeOf(BaseNotFoundError{}))
+		Expect(ab.Status.Conditions).To(BeEmpty())
+
+		resourceMutexes.Lock()
+		defer resourceMutexes.Unlock()
+		Expect(resourceMutexes.m["status"]).NotTo(HaveKey(ab.Name + "-" + ab.Namespace))
+	})
+})
+
+var _ = Describe("Merging an AppBundle with its base", func() {
+	var abRec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		abRec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+	})
+
+	strPtr := func(s string) *string { return &s }
+	intPtr := func(i int) *int { return &i }
+
+	DescribeTable("Should follow the merge strategies",
+		func(baseSpec atroxyzv1alpha1.AppBundleBaseSpec, spec atroxyzv1alpha1.AppBundleSpec, check func(*atroxyzv1alpha1.AppBundleSpec)) {
+			ab := GetBasicAppBundle()
+			ab.Spec.Image = nil
+			ab.Spec = spec
+			abb := &atroxyzv1alpha1.AppBundleBase{ObjectMeta: metav1.ObjectMeta{Name: GetRandomName()}, Spec: baseSpec}
+
+			err := ResolveAppBundleBase(ctx, abRec, ab, abb)
+			Expect(err).NotTo(HaveOccurred())
+			check(&ab.Spec)
+		},
+		Entry("merging maps by default with the app bundle winning",
+			atroxyzv1alpha1.AppBundleBaseSpec{Envs: map[string]string{"TZ": "UTC", "LOG": "info"}},
+			atroxyzv1alpha1.AppBundleSpec{Envs: map[string]string{"LOG": "debug"}},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(spec.Envs).To(Equal(map[string]string{"TZ": "UTC", "LOG": "debug"}))
+			},
+		),
+		Entry("merging entries under the same key",
+			atroxyzv1alpha1.AppBundleBaseSpec{Routes: map[string]atroxyzv1alpha1.AppBundleRoute{"web": {Port: intPtr(80), TargetPort: intPtr(8080)}}},
+			atroxyzv1alpha1.AppBundleSpec{Routes: map[string]atroxyzv1alpha1.AppBundleRoute{"web": {Port: intPtr(443)}}},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(*spec.Routes["web"].Port).To(Equal(443))
+				Expect(*spec.Routes["web"].TargetPort).To(Equal(8080))
+			},
+		),
+		Entry("replacing a map",
+			atroxyzv1alpha1.AppBundleBaseSpec{Envs: map[string]string{"TZ": "UTC", "LOG": "info"}},
+			atroxyzv1alpha1.AppBundleSpec{
+				Envs:  map[string]string{"LOG": "debug"},
+				Merge: &atroxyzv1alpha1.AppBundleMerge{Strategies: map[string]atroxyzv1alpha1.MergeStrategy{"envs": atroxyzv1alpha1.MergeStrategyReplace}},
+			},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(spec.Envs).To(Equal(map[string]string{"LOG": "debug"}))
+			},
+		),
+		Entry("deleting inherited entries",
+			atroxyzv1alpha1.AppBundleBaseSpec{
+				Envs:   map[string]string{"TZ": "UTC", "DEBUG": "1"},
+				Routes: map[string]atroxyzv1alpha1.AppBundleRoute{"web": {Port: intPtr(80)}, "metrics": {Port: intPtr(9090)}},
+			},
+			atroxyzv1alpha1.AppBundleSpec{
+				Merge: &atroxyzv1alpha1.AppBundleMerge{Delete: map[string][]string{"envs": {"DEBUG"}, "routes": {"metrics"}}},
+			},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(spec.Envs).To(Equal(map[string]string{"TZ": "UTC"}))
+				Expect(spec.Routes).To(HaveLen(1))
+				Expect(spec.Routes).To(HaveKey("web"))
+			},
+		),
+		Entry("injecting a sidecar with the app bundle adjusting it",
+			atroxyzv1alpha1.AppBundleBaseSpec{Sidecars: map[string]atroxyzv1alpha1.AppBundleSidecar{
+				"vpn": {Image: &atroxyzv1alpha1.AppBundleImage{Repository: strPtr("gluetun"), Tag: strPtr("v3")}, Envs: map[string]string{"VPN_TYPE": "wireguard"}},
+			}},
+			atroxyzv1alpha1.AppBundleSpec{Sidecars: map[string]atroxyzv1alpha1.AppBundleSidecar{
+				"vpn": {Envs: map[string]string{"SERVER_COUNTRIES": "Sweden"}},
+			}},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(*spec.Sidecars["vpn"].Image.Repository).To(Equal("gluetun"))
+				Expect(spec.Sidecars["vpn"].Envs).To(Equal(map[string]string{"VPN_TYPE": "wireguard", "SERVER_COUNTRIES": "Sweden"}))
+			},
+		),
+		Entry("inheriting the scheduling with the app bundle adjusting it",
+			atroxyzv1alpha1.AppBundleBaseSpec{Scheduling: &atroxyzv1alpha1.AppBundleScheduling{
+				PriorityClassName: strPtr("homelab-critical"),
+				Tolerations:       []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "storage"}},
+			}},
+			atroxyzv1alpha1.AppBundleSpec{Scheduling: &atroxyzv1alpha1.AppBundleScheduling{PriorityClassName: strPtr("homelab-low")}},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(*spec.Scheduling.PriorityClassName).To(Equal("homelab-low"))
+				Expect(spec.Scheduling.Tolerations).To(HaveLen(1))
+			},
+		),
+		Entry("replacing lists by default",
+			atroxyzv1alpha1.AppBundleBaseSpec{Args: []*string{strPtr("--base")}},
+			atroxyzv1alpha1.AppBundleSpec{Args: []*string{strPtr("--own")}},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(spec.Args).To(HaveLen(1))
+				Expect(*spec.Args[0]).To(Equal("--own"))
+			},
+		),
+		Entry("appending lists",
+			atroxyzv1alpha1.AppBundleBaseSpec{Args: []*string{strPtr("--base")}},
+			atroxyzv1alpha1.AppBundleSpec{
+				Args:  []*string{strPtr("--own")},
+				Merge: &atroxyzv1alpha1.AppBundleMerge{Strategies: map[string]atroxyzv1alpha1.MergeStrategy{"args": atroxyzv1alpha1.MergeStrategyAppend}},
+			},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(spec.Args).To(HaveLen(2))
+				Expect(*spec.Args[0]).To(Equal("--base"))
+				Expect(*spec.Args[1]).To(Equal("--own"))
+			},
+		),
+		Entry("filling in unset fields of objects",
+			atroxyzv1alpha1.AppBundleBaseSpec{Image: &atroxyzv1alpha1.AppBundleImage{Repository: strPtr("nginx"), Tag: strPtr("stable")}},
+			atroxyzv1alpha1.AppBundleSpec{Image: &atroxyzv1alpha1.AppBundleImage{Tag: strPtr("latest")}},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(*spec.Image.Repository).To(Equal("nginx"))
+				Expect(*spec.Image.Tag).To(Equal("latest"))
+			},
+		),
+		Entry("replacing objects",
+			atroxyzv1alpha1.AppBundleBaseSpec{Image: &atroxyzv1alpha1.AppBundleImage{Repository: strPtr("nginx"), Tag: strPtr("stable")}},
+			atroxyzv1alpha1.AppBundleSpec{
+				Image: &atroxyzv1alpha1.AppBundleImage{Tag: strPtr("latest")},
+				Merge: &atroxyzv1alpha1.AppBundleMerge{Strategies: map[string]atroxyzv1alpha1.MergeStrategy{"image": atroxyzv1alpha1.MergeStrategyReplace}},
+			},
+			func(spec *atroxyzv1alpha1.AppBundleSpec) {
+				Expect(spec.Image.Repository).To(BeNil())
+				Expect(*spec.Image.Tag).To(Equal("latest"))
+			},
+		),
+	)
+
+	It("Should let a nearer base delete what a farther one sets", func() {
+		By("Chaining two bases")
+		farName := GetRandomName()
+		far := &atroxyzv1alpha1.AppBundleBase{
+			ObjectMeta: metav1.ObjectMeta{Name: farName},
+			Spec:       atroxyzv1alpha1.AppBundleBaseSpec{Envs: map[string]string{"TZ": "UTC", "DEBUG": "1"}},
+		}
+		Expect(abRec.Create(ctx, far)).To(Succeed())
+		near := &atroxyzv1alpha1.AppBundleBase{
+			ObjectMeta: metav1.ObjectMeta{Name: GetRandomName()},
+			Spec: atroxyzv1alpha1.AppBundleBaseSpec{
+				Base:  &farName,
+				Merge: &atroxyzv1alpha1.AppBundleMerge{Delete: map[string][]string{"envs": {"DEBUG"}}},
+			},
+		}
+
+		ab := GetBasicAppBundle()
+		ab.Spec.Base = &near.Name
+		ab.Status.Provenance = map[string]string{}
+		RecordProvenance(ab, &ab.Spec, ProvenanceSelf)
+
+		err := ResolveAppBundleBase(ctx, abRec, ab, near)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ab.Spec.Envs).To(Equal(map[string]string{"TZ": "UTC"}))
+		Expect(ab.Status.Provenance).To(HaveKeyWithValue("envs[TZ]", farName))
+		Expect(ab.Status.Provenance).NotTo(HaveKey("envs[DEBUG]"))
+	})
+})
+
+var _ = Describe("Propagating changes of an AppBundleBase", func() {
+	var ctx context.Context
+	var events chan event.GenericEvent
+	var rec *AppBundleBaseReconciler
+
+	newBase := func(name string, base *string) *atroxyzv1alpha1.AppBundleBase {
+		return &atroxyzv1alpha1.AppBundleBase{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: atroxyzv1alpha1.AppBundleBaseSpec{Base: base}}
+	}
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		events = make(chan event.GenericEvent, 10)
+
+		far, near := "far", "near"
+		inheriting := GetBasicAppBundle()
+		inheriting.Spec.Base = &near
+		direct := GetBasicAppBundle()
+		direct.Spec.Base = &far
+		unrelated := GetBasicAppBundle()
+
+		c := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(newBase(far, nil), newBase(near, &far), newBase("other", nil), inheriting, direct, unrelated).
+			WithIndex(&atroxyzv1alpha1.AppBundle{}, BaseIndexField, BaseIndexFunc).
+			WithIndex(&atroxyzv1alpha1.AppBundleBase{}, BaseIndexField, BaseIndexFunc).
+			Build()
+		rec = &AppBundleBaseReconciler{Client: c, Scheme: scheme.Scheme, AppBundleEvents: events}
+	})
+
+	It("Should send every app bundle inheriting from the base through the chain", func() {
+		_, err := rec.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "far"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+	})
+
+	It("Should send only the app bundles of the nearer base", func() {
+		_, err := rec.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "near"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+	})
+
+	It("Should still send the app bundles of a deleted base", func() {
+		Expect(rec.Delete(ctx, newBase("near", nil))).To(Succeed())
+		_, err := rec.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "near"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+	})
+
+	It("Should walk cycles only once", func() {
+		a, b := "a", "b"
+		Expect(rec.Create(ctx, newBase(a, &b))).To(Succeed())
+		Expect(rec.Create(ctx, newBase(b, &a))).To(Succeed())
+		abs, err := GetDependentAppBundles(ctx, rec, "a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(abs).To(BeEmpty())
+	})
 })
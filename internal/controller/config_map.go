@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -13,6 +14,7 @@ import (
 // CreateExpectedConfigMap creates the expected config mapfrom the appbundle
 func CreateExpectedConfigMap(ab *atroxyzv1alpha1.AppBundle) (*corev1.ConfigMap, error) {
 	cm := &corev1.ConfigMap{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+	cm.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
 
 	// If no configs, return nil
 	if ab.Spec.Configs == nil {
@@ -72,31 +74,42 @@ func (r *AppBundleReconciler) ReconcileConfigMap(ctx context.Context, ab *atroxy
 		}
 
 		// Expected to have no config map but have one, delete it
-		return r.Delete(ctx, currentConfigMap)
+		return r.DeleteResource(ctx, ab, currentConfigMap, "no configs need it anymore")
 	}
 
-	if expectedConfigMap != nil && !equality.Semantic.DeepDerivative(expectedConfigMap.Data, currentConfigMap.Data) {
-		reason := "Data in the ConfigMap " + ab.Name + " has changed."
+	if er != nil && !errors.IsNotFound(er) {
+		return er
+	}
 
-		if err := UpsertResource(ctx, r, expectedConfigMap, reason, er, false); err != nil {
-			return err
-		}
+	SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+		Kind:      "ConfigMap",
+		Name:      expectedConfigMap.Name,
+		Namespace: expectedConfigMap.Namespace,
+		Healthy:   true,
+		Message:   fmt.Sprintf("%d keys", len(expectedConfigMap.Data)),
+	})
 
-		// Restart the pod after the config map has been updated.
-		podList := &corev1.PodList{}
-		if err := r.List(ctx, podList, client.MatchingLabels{AppBundleSelector: ab.Name}); err != nil {
-			return err
-		}
-		if len(podList.Items) == 0 {
-			return nil
-		} else if len(podList.Items) > 1 {
-			return errors.NewBadRequest("More than one pod found for appbundle")
-		}
+	changed, err := r.ApplyResource(ctx, ab, expectedConfigMap, false)
+	if err != nil {
+		return err
+	}
 
-		// By now we know there is only one item in the list
-		if err := r.Delete(ctx, &podList.Items[0]); err != nil {
-			return err
-		}
+	// Only a change to the data needs the pod restarted
+	if !changed || equality.Semantic.DeepEqual(expectedConfigMap.Data, currentConfigMap.Data) {
+		return nil
 	}
-	return nil
+
+	// Restart the pod after the config map has been updated.
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(ab.Namespace), client.MatchingLabels{AppBundleSelector: ab.Name}); err != nil {
+		return err
+	}
+	if len(podList.Items) == 0 {
+		return nil
+	} else if len(podList.Items) > 1 {
+		return errors.NewBadRequest("More than one pod found for appbundle")
+	}
+
+	// By now we know there is only one item in the list
+	return r.DeleteResource(ctx, ab, &podList.Items[0], "its ConfigMap changed and it has to be restarted")
 }
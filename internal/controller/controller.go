@@ -2,16 +2,30 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // +kubebuilder:rbac:groups=atro.xyz,resources=appbundles,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=atro.xyz,resources=appbundles/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=atro.xyz,resources=appbundles/finalizers,verbs=update
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=services;configmaps;persistentvolumeclaims;serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings;clusterroles;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=external-secrets.io,resources=externalsecrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=longhorn.io,resources=volumes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=longhorn.io,resources=recurringjobs,verbs=get;list;watch;create;update;patch;delete
 
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.16.0/pkg/reconcile
@@ -21,54 +35,89 @@ func (r *AppBundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	mu.Lock()
 	defer mu.Unlock()
 
-	// Get app bundle
+	// Get app bundle, gone means there is nothing left to do as the generated resources are garbage collected with it
 	ab := &atroxyzv1alpha1.AppBundle{}
 	if err := r.Get(ctx, req.NamespacedName, ab); err != nil {
-		return ctrl.Result{RequeueAfter: 120 * time.Second}, err
+		if k8serror.IsNotFound(err) {
+			releaseMutexes(req.Name, req.Namespace)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// Get (cached) state of the appbundle
-	err := RegisterStateIfNotAlreadyRegistered(ab)
-	stateAlreadyRegistered := false
-	if err != nil {
-		_, stateAlreadyRegistered = err.(StateAlreadyRegisteredError)
-		if !stateAlreadyRegistered {
-			return ctrl.Result{RequeueAfter: 120 * time.Second}, err
-		}
+	// Being deleted, clean up what garbage collection does not and let it go
+	if !ab.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.FinalizeAppBundle(ctx, ab)
 	}
 
-	stateNeedsUpdating, err := StateNeedsUpdating(ab, stateAlreadyRegistered)
-	if err != nil {
-		return ctrl.Result{RequeueAfter: 120 * time.Second}, err
+	// Still backing off from earlier failures, anything other than a spec change waits for the retry
+	if remaining, ok := GetRemainingBackoff(ab, time.Now()); ok {
+		return ctrl.Result{RequeueAfter: remaining}, nil
 	}
 
-	if !stateNeedsUpdating {
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	originalStatus := ab.Status.DeepCopy()
+	if err := r.EnsureFinalizer(ctx, ab); err != nil {
+		r.RecordEvent(ab, nil, corev1.EventTypeWarning, EventReasonReconcileFailed, "Reconcile", "Failed to add finalizer: %s", err)
+		return r.FinishReconcile(ctx, ab, originalStatus, err)
 	}
 
+	// Resources are re-collected by the reconciles below so removed ones disappear from the status
+	ab.Status.Resources = nil
+	ab.Status.Provenance = map[string]string{}
+	RecordProvenance(ab, &ab.Spec, ProvenanceSelf)
+
 	// Resolve app bundle base
-	if ab.Spec.Base != nil {
-		abb := &atroxyzv1alpha1.AppBundleBase{}
-		if err := r.Get(ctx, client.ObjectKey{Name: *ab.Spec.Base}, abb); err != nil {
-			return ctrl.Result{RequeueAfter: 120 * time.Second}, err
-		}
-		err := ResolveAppBundleBase(ctx, r, ab, abb)
-		if err != nil {
-			return ctrl.Result{RequeueAfter: 120 * time.Second}, err
-		}
+	if err := r.ResolveBase(ctx, ab); err != nil {
+		r.RecordEvent(ab, nil, corev1.EventTypeWarning, EventReasonReconcileFailed, "Reconcile", "Failed to resolve base %s: %s", *ab.Spec.Base, err)
+		return r.FinishReconcile(ctx, ab, originalStatus, err)
+	}
+
+	// Defaults are applied after merging the base so that anything the base sets wins
+	cfg, err := r.GetAtrokConfig(ctx)
+	if err != nil {
+		return r.FinishReconcile(ctx, ab, originalStatus, err)
+	}
+	ab.Default(cfg)
+	RecordProvenance(ab, &ab.Spec, ProvenanceDefault)
+	SetEffectiveSpec(ab, cfg)
+	if err := SetEffectiveSpecHash(ab); err != nil {
+		return r.FinishReconcile(ctx, ab, originalStatus, err)
 	}
 
-	if err := RunReconciles(ctx, ab,
-		r.ReconcileVolumes,
-		r.ReconcileService,
-		r.ReconcileDeployment,
-		r.ReconcileIngress,
+	err = RunReconciles(ctx, ab,
+		WithCondition(atroxyzv1alpha1.ConditionVolumesBound, r.ReconcileVolumes),
+		WithCondition(atroxyzv1alpha1.ConditionServiceReady, r.ReconcileService),
+		WithCondition(atroxyzv1alpha1.ConditionWorkloadAvailable, r.ReconcileWorkload),
+		WithCondition(atroxyzv1alpha1.ConditionIngressReady, r.ReconcileIngress),
 		r.ReconcileConfigMap,
-		r.ReconcileExternalSecret,
-	); err != nil {
-		// TODO: Given an error, we should consider running exponential backoff here.
-		return ctrl.Result{RequeueAfter: 120 * time.Second}, err
+		r.ReconcileServiceAccount,
+		WithCondition(atroxyzv1alpha1.ConditionSecretsSynced, r.ReconcileExternalSecret),
+	)
+	// Pruning only once everything expected is in place, so a failing reconcile never leaves the app bundle with less than before
+	if err == nil {
+		err = r.PruneResources(ctx, ab)
+	}
+	if err != nil {
+		r.RecordEvent(ab, nil, corev1.EventTypeWarning, EventReasonReconcileFailed, "Reconcile", "Reconcile failed: %s", err)
+	}
+
+	return r.FinishReconcile(ctx, ab, originalStatus, err)
+}
+
+// FinishReconcile records the outcome of the reconcile in the status of the app bundle and decides when to retry.
+// Failures are retried with the app bundle's own exponential backoff, which lives in its status so it survives restarts.
+// Only failing to write the status is returned as an error, leaving the retry to the controller's rate limiter.
+func (r *AppBundleReconciler) FinishReconcile(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, originalStatus *atroxyzv1alpha1.AppBundleStatus, reconcileErr error) (ctrl.Result, error) {
+	backoff := RecordReconcileResult(ab, reconcileErr, time.Now())
+
+	if err := r.UpdateAppBundleStatus(ctx, ab, originalStatus, reconcileErr); err != nil {
+		return ctrl.Result{}, errors.Join(reconcileErr, err)
+	}
+
+	if reconcileErr != nil {
+		log.FromContext(ctx).Error(reconcileErr, "Reconcile failed", "failures", ab.Status.ConsecutiveFailures, "retryIn", backoff)
+		return ctrl.Result{RequeueAfter: backoff}, nil
 	}
 
-	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	// Nothing to requeue for, changes to the app bundle and everything it refers to are watched
+	return ctrl.Result{}, nil
 }
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// CreateExpectedDaemonSet creates expected daemon set from appbundle
+func CreateExpectedDaemonSet(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (*appsv1.DaemonSet, error) {
+	daemonSet := &appsv1.DaemonSet{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+
+	// Metadata
+	daemonSet.ObjectMeta.Annotations = ab.GetAnnotations()
+	if daemonSet.ObjectMeta.Annotations == nil {
+		daemonSet.ObjectMeta.Annotations = make(map[string]string)
+	}
+	daemonSet.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+
+	template, err := CreateExpectedPodTemplate(ab, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	revHistLimit := int32(3)
+	daemonSet.Spec = appsv1.DaemonSetSpec{
+		RevisionHistoryLimit: &revHistLimit,
+		Selector:             &metav1.LabelSelector{MatchLabels: GetSelectorLabels(ab)},
+		Template:             *template,
+	}
+
+	if ab.Spec.Workload != nil && ab.Spec.Workload.DaemonSet != nil && ab.Spec.Workload.DaemonSet.UpdateStrategy != nil {
+		daemonSet.Spec.UpdateStrategy = *ab.Spec.Workload.DaemonSet.UpdateStrategy
+	}
+
+	return daemonSet, nil
+}
+
+// ReconcileDaemonSet applies the daemon set of the app bundle.
+func (r *AppBundleReconciler) ReconcileDaemonSet(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	// LOCK APPBUNDLE DAEMONSET MUTEX
+	mu := getMutex("daemonset", ab.Name, ab.Namespace)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// GET EXPECTED DAEMONSET
+	cfg, err := r.GetAtrokConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	expectedDaemonSet, err := CreateExpectedDaemonSet(ab, cfg)
+	if err != nil {
+		return err
+	}
+
+	// APPLY EXPECTED DAEMONSET
+	if _, err := r.ApplyResource(ctx, ab, expectedDaemonSet, false); err != nil {
+		return err
+	}
+
+	return r.ReportDaemonSetStatus(ctx, ab)
+}
+
+// ReportDaemonSetStatus sets the WorkloadAvailable condition and the daemon set resource status on the app bundle.
+func (r *AppBundleReconciler) ReportDaemonSetStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	daemonSet := &appsv1.DaemonSet{}
+	if err := r.Get(ctx, GetAppBundleNamespacedName(ab), daemonSet); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		// Just created and not yet visible
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, false, atroxyzv1alpha1.ReasonProgressing, "DaemonSet is being created")
+		return nil
+	}
+
+	healthy, message := GetDaemonSetHealth(daemonSet)
+	reason := atroxyzv1alpha1.ReasonAvailable
+	if !healthy {
+		reason = atroxyzv1alpha1.ReasonProgressing
+	}
+
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, healthy, reason, message)
+	SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+		Kind:      "DaemonSet",
+		Name:      daemonSet.Name,
+		Namespace: daemonSet.Namespace,
+		Healthy:   healthy,
+		Message:   message,
+	})
+
+	return nil
+}
+
+// GetDaemonSetHealth tells whether the pods on all the nodes the daemon set should run on are updated and available, along with a human readable explanation.
+func GetDaemonSetHealth(daemonSet *appsv1.DaemonSet) (bool, string) {
+	if daemonSet.Status.ObservedGeneration < daemonSet.Generation {
+		return false, "Latest daemon set spec has not been observed yet"
+	}
+
+	desired := daemonSet.Status.DesiredNumberScheduled
+	if daemonSet.Status.UpdatedNumberScheduled < desired {
+		return false, fmt.Sprintf("%d of %d nodes updated", daemonSet.Status.UpdatedNumberScheduled, desired)
+	}
+
+	if daemonSet.Status.NumberAvailable < desired {
+		return false, fmt.Sprintf("%d of %d nodes available", daemonSet.Status.NumberAvailable, desired)
+	}
+
+	return true, fmt.Sprintf("%d of %d nodes available", daemonSet.Status.NumberAvailable, desired)
+}
@@ -0,0 +1,62 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle running as a DaemonSet", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		kind := atroxyzv1alpha1.WorkloadKindDaemonSet
+		hostPath := "/var/log"
+		path := "/host/log"
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{
+			Kind:      &kind,
+			DaemonSet: &atroxyzv1alpha1.AppBundleDaemonSet{UpdateStrategy: &appsv1.DaemonSetUpdateStrategy{Type: appsv1.OnDeleteDaemonSetStrategyType}},
+		}
+		ab.Spec.NodeSelector = &map[string]string{"kubernetes.io/os": "linux"}
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"log": {HostPath: &hostPath, Path: &path}}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should make a daemon set from the same pod template", func() {
+		daemonSet := &appsv1.DaemonSet{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(daemonSet), daemonSet)).To(Succeed())
+
+		podSpec := daemonSet.Spec.Template.Spec
+		Expect(podSpec.Containers[0].Image).To(Equal("nginx:latest"))
+		Expect(podSpec.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "linux"))
+		Expect(podSpec.Volumes).To(HaveLen(1))
+		Expect(podSpec.Volumes[0].HostPath.Path).To(Equal("/var/log"))
+		Expect(podSpec.Affinity).To(BeNil())
+		Expect(daemonSet.Spec.UpdateStrategy.Type).To(Equal(appsv1.OnDeleteDaemonSetStrategyType))
+	})
+
+	It("Should report the daemon set in the app bundle status", func() {
+		Expect(ab.Status.Resources).To(ContainElement(HaveField("Kind", "DaemonSet")))
+	})
+})
@@ -3,18 +3,20 @@ package controller
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
-	equality "k8s.io/apimachinery/pkg/api/equality"
 )
 
 // CreateExpectedDeployment creates expected deployment from appbundle
-func CreateExpectedDeployment(ab *atroxyzv1alpha1.AppBundle) (*appsv1.Deployment, error) {
+func CreateExpectedDeployment(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (*appsv1.Deployment, error) {
 	deployment := &appsv1.Deployment{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
 
 	// Metadata
@@ -23,310 +25,82 @@ func CreateExpectedDeployment(ab *atroxyzv1alpha1.AppBundle) (*appsv1.Deployment
 		deployment.ObjectMeta.Annotations = make(map[string]string)
 	}
 
-	labels := SetDefaultAppBundleLabels(ab, nil)
-
-	// Ports
-	var ports []corev1.ContainerPort
-	for _, key := range getSortedKeys(ab.Spec.Routes) {
-		route := ab.Spec.Routes[key]
-		ports = append(ports, corev1.ContainerPort{Name: key, ContainerPort: int32(*route.Port), Protocol: "TCP"})
-	}
-
-	// Volume Mounts
-	var volumeMounts []corev1.VolumeMount
-	volumeKeys := getSortedKeys(ab.Spec.Volumes)
-	for _, key := range volumeKeys {
-		volumeName := key
-		if ab.Spec.Volumes[key].ExistingClaim != nil {
-			volumeName = *ab.Spec.Volumes[key].ExistingClaim
-		}
-
-		volume := ab.Spec.Volumes[key]
-		if volume.Path == nil {
-			return nil, fmt.Errorf("volume %s has no path", key)
-		}
-		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: volumeName, MountPath: *volume.Path})
-	}
-
-	// Volumes
-	var volumes []corev1.Volume
-	for _, key := range volumeKeys {
-		// If PVC we control then we get name from volume name, for hostPath we do the same.
-		name := key
-		volName := ab.Name + "-" + key
-		volume := ab.Spec.Volumes[key]
-
-		// If existing PVC then we get name from existing claim
-		if volume.ExistingClaim != nil {
-			name = *volume.ExistingClaim
-			volName = *volume.ExistingClaim
-		}
-
-		if volume.HostPath != nil {
-			pathType := corev1.HostPathDirectoryOrCreate
-			hostPath := corev1.HostPathVolumeSource{
-				Path: *volume.HostPath,
-				Type: &pathType,
-			}
-			volumes = append(volumes, corev1.Volume{
-				Name:         name,
-				VolumeSource: corev1.VolumeSource{HostPath: &hostPath},
-			})
-		} else if volume.EmptyDir != nil && *volume.EmptyDir {
-			volumes = append(volumes, corev1.Volume{
-				Name:         name,
-				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
-			})
-		} else {
-			volumes = append(volumes, corev1.Volume{
-				Name:         name,
-				VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: volName}},
-			})
-		}
+	template, err := CreateExpectedPodTemplate(ab, cfg)
+	if err != nil {
+		return nil, err
 	}
-	initContainers := make([]corev1.Container, 0)
-
-	// Attach Configs
-	if ab.Spec.Configs != nil {
-		configs := ab.Spec.Configs
-		for _, key := range getSortedKeys(configs) {
-			config := configs[key]
-			volumeName := "cm-" + key
-
-			volumeSource := corev1.VolumeSource{}
 
-			if config.Existing != nil {
-				volumeSource = corev1.VolumeSource{
-					ConfigMap: &corev1.ConfigMapVolumeSource{
-						LocalObjectReference: corev1.LocalObjectReference{Name: *config.Existing},
-						Items:                []corev1.KeyToPath{{Key: key, Path: config.FileName}},
-					},
-				}
-			} else {
-				if len(config.Secrets) == 0 {
-					volumeSource = corev1.VolumeSource{
-						ConfigMap: &corev1.ConfigMapVolumeSource{
-							LocalObjectReference: corev1.LocalObjectReference{Name: ab.Name},
-							Items:                []corev1.KeyToPath{{Key: key, Path: config.FileName}},
-						},
-					}
-				} else {
-					volumeSource = corev1.VolumeSource{
-						Secret: &corev1.SecretVolumeSource{
-							SecretName: ab.Name,
-							Items:      []corev1.KeyToPath{{Key: "cfg" + key, Path: config.FileName}},
-						},
-					}
-					volumeName = "sec-" + key
-				}
-			}
-
-			volumes = append(volumes, corev1.Volume{
-				Name:         volumeName,
-				VolumeSource: volumeSource,
-			})
-			mountPath := config.DirPath + "/" + config.FileName
-
-			if config.CopyOver != nil && *config.CopyOver {
-				tempMountPath := "/atrok" + config.DirPath + "/" + config.FileName
-				initVolumeMounts := append(volumeMounts, corev1.VolumeMount{
-					Name:      volumeName,
-					MountPath: tempMountPath,
-					SubPath:   config.FileName,
-					ReadOnly:  true,
-				},
-				)
-
-				initContainers = append(initContainers, corev1.Container{
-					Name:  "copy-over-" + key,
-					Image: "busybox:stable",
-					Command: []string{
-						"sh", "-c", // Use a shell to run multiple commands
-						"cp " + tempMountPath + " " + mountPath + " && chmod 777 " + mountPath,
-					},
-					VolumeMounts: initVolumeMounts,
-				})
-			} else {
-				volumeMounts = append(volumeMounts, corev1.VolumeMount{
-					Name:      volumeName,
-					MountPath: mountPath,
-					SubPath:   config.FileName,
-					ReadOnly:  true,
-				})
-			}
+	// Generated claims are always ReadWriteOnce, existing ones are only known once looked up by ReconcileDeployment
+	mountsGeneratedClaim := false
+	for _, volume := range ab.Spec.Volumes {
+		if IsGeneratedClaim(&volume) {
+			mountsGeneratedClaim = true
 		}
 	}
 
-	// busybox:stable
-
-	// Small bits
 	revHistLimit := int32(3)
-
-	resources := corev1.ResourceRequirements{}
-	if ab.Spec.Resources != nil {
-		resources = *ab.Spec.Resources
+	deployment.Spec = appsv1.DeploymentSpec{
+		Replicas:             ab.Spec.Replicas,
+		RevisionHistoryLimit: &revHistLimit,
+		Strategy:             GetDeploymentStrategy(ab, mountsGeneratedClaim),
+		Selector:             &metav1.LabelSelector{MatchLabels: GetSelectorLabels(ab)},
+		Template:             *template,
 	}
 
-	repository := *ab.Spec.Image.Repository
-	tag := *ab.Spec.Image.Tag
-	env := []corev1.EnvVar{}
-
-	// Have to sort keys otherwise get infinite loop of updating
-	if ab.Spec.Envs != nil {
-		sortedKeys := getSortedKeys(ab.Spec.Envs)
-		// Iterate through sorted keys
-		for _, key := range sortedKeys {
-			env = append(env, corev1.EnvVar{Name: key, Value: ab.Spec.Envs[key]})
+	if strategy := ab.Spec.Strategy; strategy != nil {
+		if strategy.RevisionHistoryLimit != nil {
+			deployment.Spec.RevisionHistoryLimit = strategy.RevisionHistoryLimit
 		}
-	}
-
-	if ab.Spec.SourcedEnvs != nil {
-		sortedKeys := getSortedKeys(ab.Spec.SourcedEnvs)
-
-		// Iterate through sorted keys
-		for _, key := range sortedKeys {
-			envVarSource := corev1.EnvVarSource{}
-			if ab.Spec.SourcedEnvs[key].Secret != "" {
-				envVarSource.SecretKeyRef = &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{Name: ab.Spec.SourcedEnvs[key].Secret},
-					Key:                  ab.Spec.SourcedEnvs[key].Key,
-				}
-			} else if ab.Spec.SourcedEnvs[key].ConfigMap != "" {
-				envVarSource.ConfigMapKeyRef = &corev1.ConfigMapKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{Name: ab.Spec.SourcedEnvs[key].ConfigMap},
-					Key:                  ab.Spec.SourcedEnvs[key].Key,
-				}
-			} else if ab.Spec.SourcedEnvs[key].ExternalSecret != "" {
-				envVarSource.SecretKeyRef = &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{Name: ab.Name},
-					Key:                  "env" + key,
-				}
-			} else {
-				return nil, fmt.Errorf("SourcedEnv %s has neither Secret nor ConfigMap", key)
-			}
-
-			env = append(env, corev1.EnvVar{Name: key, ValueFrom: &envVarSource})
+		if strategy.MinReadySeconds != nil {
+			deployment.Spec.MinReadySeconds = *strategy.MinReadySeconds
 		}
+		deployment.Spec.ProgressDeadlineSeconds = strategy.ProgressDeadlineSeconds
 	}
-	imagePullPolicy := corev1.PullAlways
-	if ab.Spec.Image.PullPolicy != nil {
-		imagePullPolicy = *ab.Spec.Image.PullPolicy
-	}
-
-	container := corev1.Container{
-		Name:            ab.Name,
-		Image:           fmt.Sprintf("%s:%s", repository, tag),
-		ImagePullPolicy: imagePullPolicy,
-		Resources:       resources,
-		Ports:           ports,
-		Env:             env,
-		VolumeMounts:    volumeMounts,
-		LivenessProbe:   ab.Spec.LivenessProbe,
-		ReadinessProbe:  ab.Spec.ReadinessProbe,
-		StartupProbe:    ab.Spec.StartupProbe,
-	}
+	deployment.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
 
-	if ab.Spec.Command != nil {
-		container.Command = []string{}
+	return deployment, nil
+}
 
-		for _, command := range ab.Spec.Command {
-			container.Command = append(container.Command, *command)
-		}
+// GetDeploymentStrategy returns the rollout strategy of the deployment of the app bundle, Recreate unless a rolling update is asked for.
+// A rolling update falls back to Recreate when a ReadWriteOnce claim is mounted, as the new pods would wait for the old ones to let go of it forever.
+func GetDeploymentStrategy(ab *atroxyzv1alpha1.AppBundle, mountsReadWriteOnceClaim bool) appsv1.DeploymentStrategy {
+	strategy := ab.Spec.Strategy
+	if strategy == nil || strategy.Type == nil || *strategy.Type != appsv1.RollingUpdateDeploymentStrategyType || mountsReadWriteOnceClaim {
+		return appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
 	}
 
-	if ab.Spec.Args != nil {
-		container.Args = []string{}
-
-		for _, arg := range ab.Spec.Args {
-			container.Args = append(container.Args, *arg)
-		}
+	return appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       strategy.MaxSurge,
+			MaxUnavailable: strategy.MaxUnavailable,
+		},
 	}
+}
 
-	if ab.Spec.UseNvidia != nil && *ab.Spec.UseNvidia {
-		envs := []corev1.EnvVar{}
-		if container.Env != nil {
-			envs = container.Env
+// MountsReadWriteOnceExistingClaim reports whether any of the existing claims the app bundle mounts can only be mounted by one node at a time.
+// A claim that can not be found is assumed to be one, so a rolling update never waits on it.
+func (r *AppBundleReconciler) MountsReadWriteOnceExistingClaim(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) (bool, error) {
+	for _, key := range getSortedKeys(ab.Spec.Volumes) {
+		volume := ab.Spec.Volumes[key]
+		if volume.ExistingClaim == nil {
+			continue
 		}
-		foundNvidiaEnv := false
 
-		for _, env := range container.Env {
-			if env.Name == "NVIDIA_VISIBLE_DEVICES" {
-				foundNvidiaEnv = true
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := r.Get(ctx, client.ObjectKey{Name: *volume.ExistingClaim, Namespace: ab.Namespace}, pvc); err != nil {
+			if errors.IsNotFound(err) {
+				return true, nil
 			}
+			return false, err
 		}
-		if !foundNvidiaEnv {
-			envs = append(envs, corev1.EnvVar{Name: "NVIDIA_VISIBLE_DEVICES", Value: "all"})
-		}
-		container.Env = envs
-	}
-
-	matchLabels := map[string]string{AppBundleSelector: ab.Name}
-	labelSelector := metav1.LabelSelector{MatchLabels: matchLabels}
-	affinity := &corev1.Affinity{
-		PodAntiAffinity: &corev1.PodAntiAffinity{
-			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
-				{
-					TopologyKey: "kubernetes.io/hostname",
-					LabelSelector: &metav1.LabelSelector{
-						MatchExpressions: []metav1.LabelSelectorRequirement{
-							{
-								Key:      AppBundleSelector,
-								Operator: metav1.LabelSelectorOpIn,
-								Values:   []string{ab.Name},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-
-	deployment.Spec = appsv1.DeploymentSpec{
-		Replicas:             ab.Spec.Replicas,
-		RevisionHistoryLimit: &revHistLimit,
-		Strategy:             appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
-		Selector:             &labelSelector,
-		Template: corev1.PodTemplateSpec{
-			ObjectMeta: metav1.ObjectMeta{
-				Labels: matchLabels,
-			},
-			Spec: corev1.PodSpec{
-				Volumes:          volumes,
-				ImagePullSecrets: image_pull_secrets,
-				InitContainers:   initContainers,
-				Affinity:         affinity,
-				Containers:       []corev1.Container{container},
-			},
-		},
-	}
-	deployment.ObjectMeta.Labels = labels
 
-	if ab.Spec.NodeSelector != nil {
-		deployment.Spec.Template.Spec.NodeSelector = *ab.Spec.NodeSelector
-	}
-
-	if ab.Spec.UseNvidia != nil && *ab.Spec.UseNvidia {
-		tolerations := []corev1.Toleration{}
-		if deployment.Spec.Template.Spec.Tolerations != nil {
-			tolerations = deployment.Spec.Template.Spec.Tolerations
-		}
-		foundNvidiaToleration := false
-		for _, toleration := range tolerations {
-			if toleration.Key == "nvidia.com/gpu" {
-				foundNvidiaToleration = true
-			}
-		}
-		if !foundNvidiaToleration {
-			tolerations = append(tolerations, corev1.Toleration{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule})
+		if slices.Contains(pvc.Spec.AccessModes, corev1.ReadWriteOnce) || slices.Contains(pvc.Spec.AccessModes, corev1.ReadWriteOncePod) {
+			return true, nil
 		}
-
-		deployment.Spec.Template.Spec.Tolerations = tolerations
-
-		nvidiaRuntimeClass := "nvidia"
-		deployment.Spec.Template.Spec.RuntimeClassName = &nvidiaRuntimeClass
 	}
 
-	return deployment, nil
+	return false, nil
 }
 
 // ReconcileDeployment checks currently existing deployment with the expected deployment and updates it if necessary. If no deployment exists, it creates one.
@@ -336,32 +110,84 @@ func (r *AppBundleReconciler) ReconcileDeployment(ctx context.Context, ab *atrox
 	mu.Lock()
 	defer mu.Unlock()
 
-	// GET CURRENT DEPLOYMENT
-	currentDeployment := &appsv1.Deployment{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
-	er := r.Get(ctx, client.ObjectKeyFromObject(currentDeployment), currentDeployment)
-
 	// GET EXPECTED DEPLOYMENT
-	expectedDeployment, err := CreateExpectedDeployment(ab)
+	cfg, err := r.GetAtrokConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	expectedDeployment, err := CreateExpectedDeployment(ab, cfg)
 	if err != nil {
 		return err
 	}
 
-	// IF CURRENT != EXPECTED THEN UPSERT
-	if !equality.Semantic.DeepDerivative(expectedDeployment.Spec, currentDeployment.Spec) {
-		reason, err := FormulateDiffMessageForSpecs(currentDeployment.Spec, expectedDeployment.Spec)
+	if expectedDeployment.Spec.Strategy.Type == appsv1.RollingUpdateDeploymentStrategyType {
+		readWriteOnce, err := r.MountsReadWriteOnceExistingClaim(ctx, ab)
 		if err != nil {
 			return err
 		}
-		return UpsertResource(ctx, r, expectedDeployment, reason, er, false)
+		if readWriteOnce {
+			log.FromContext(ctx).Info("Falling back to the Recreate strategy as a ReadWriteOnce claim is mounted.", "name", ab.Name)
+			expectedDeployment.Spec.Strategy = GetDeploymentStrategy(ab, true)
+		}
 	}
 
-	if !StringMapsMatch(expectedDeployment.ObjectMeta.Labels, currentDeployment.ObjectMeta.Labels) {
-		reason, err := FormulateDiffMessageForSpecs(currentDeployment.ObjectMeta.Labels, expectedDeployment.ObjectMeta.Labels)
-		if err != nil {
+	// APPLY EXPECTED DEPLOYMENT
+	if _, err := r.ApplyResource(ctx, ab, expectedDeployment, false); err != nil {
+		return err
+	}
+
+	return r.ReportDeploymentStatus(ctx, ab)
+}
+
+// ReportDeploymentStatus sets the WorkloadAvailable condition and the deployment resource status on the app bundle.
+func (r *AppBundleReconciler) ReportDeploymentStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, GetAppBundleNamespacedName(ab), deployment); err != nil {
+		if !errors.IsNotFound(err) {
 			return err
 		}
-		return UpsertResource(ctx, r, expectedDeployment, reason, er, false)
+		// Just created and not yet visible
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, false, atroxyzv1alpha1.ReasonProgressing, "Deployment is being created")
+		return nil
+	}
+
+	healthy, message := GetDeploymentHealth(deployment)
+	reason := atroxyzv1alpha1.ReasonAvailable
+	if !healthy {
+		reason = atroxyzv1alpha1.ReasonProgressing
 	}
 
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, healthy, reason, message)
+	SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+		Kind:      "Deployment",
+		Name:      deployment.Name,
+		Namespace: deployment.Namespace,
+		Healthy:   healthy,
+		Message:   message,
+	})
+
 	return nil
 }
+
+// GetDeploymentHealth tells whether all the replicas of the deployment are updated and available, along with a human readable explanation.
+func GetDeploymentHealth(deployment *appsv1.Deployment) (bool, string) {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false, "Latest deployment spec has not been observed yet"
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	if deployment.Status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d replicas updated", deployment.Status.UpdatedReplicas, replicas)
+	}
+
+	if deployment.Status.AvailableReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d replicas available", deployment.Status.AvailableReplicas, replicas)
+	}
+
+	return true, fmt.Sprintf("%d of %d replicas available", deployment.Status.AvailableReplicas, replicas)
+}
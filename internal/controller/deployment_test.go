@@ -8,7 +8,11 @@ import (
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -59,6 +63,23 @@ var _ = Describe("Correctly populated AppBundle for just deplyoment", func() {
 		Expect(containers[0].VolumeMounts).To(HaveLen(0))
 	})
 
+	It("Should report the deployment in the app bundle status", func() {
+		By("Reconciling deployment using app bundle")
+		// CHECK the status, nothing runs pods in the test environment so it can't become available
+		condition := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionWorkloadAvailable)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(atroxyzv1alpha1.ReasonProgressing))
+
+		Expect(ab.Status.Resources).To(ContainElement(atroxyzv1alpha1.AppBundleResourceStatus{
+			Kind:      "Deployment",
+			Name:      ab.Name,
+			Namespace: ab.Namespace,
+			Healthy:   false,
+			Message:   condition.Message,
+		}))
+	})
+
 	It("Should update the deployment when the app bundle is updated with new image tag", func() {
 		By("Changing image tag and reconciling deployment using app bundle")
 		// GET the resource
@@ -93,6 +114,70 @@ var _ = Describe("Correctly populated AppBundle for just deplyoment", func() {
 		Expect(afterContainers[0].Image).To(Equal(*ab.Spec.Image.Repository + ":" + *ab.Spec.Image.Tag))
 	})
 
+	It("Should roll out with the strategy of the app bundle", func() {
+		By("Asking for a rolling update")
+		rollingUpdate := appsv1.RollingUpdateDeploymentStrategyType
+		maxUnavailable := intstr.FromInt32(0)
+		maxSurge := intstr.FromString("50%")
+		minReadySeconds := int32(10)
+		revisionHistoryLimit := int32(5)
+		ab.Spec.Strategy = &atroxyzv1alpha1.AppBundleStrategy{
+			Type:                 &rollingUpdate,
+			MaxSurge:             &maxSurge,
+			MaxUnavailable:       &maxUnavailable,
+			MinReadySeconds:      &minReadySeconds,
+			RevisionHistoryLimit: &revisionHistoryLimit,
+		}
+		Expect(rec.ReconcileDeployment(ctx, ab)).To(Succeed())
+
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+		Expect(deployment.Spec.Strategy.Type).To(Equal(rollingUpdate))
+		Expect(*deployment.Spec.Strategy.RollingUpdate.MaxSurge).To(Equal(maxSurge))
+		Expect(*deployment.Spec.Strategy.RollingUpdate.MaxUnavailable).To(Equal(maxUnavailable))
+		Expect(deployment.Spec.MinReadySeconds).To(Equal(minReadySeconds))
+		Expect(*deployment.Spec.RevisionHistoryLimit).To(Equal(revisionHistoryLimit))
+	})
+
+	It("Should fall back to recreating the pods when a ReadWriteOnce claim is mounted", func() {
+		By("Mounting an existing ReadWriteOnce claim")
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: ab.Name + "-media", Namespace: ab.Namespace},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources:   corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}},
+			},
+		}
+		Expect(rec.Create(ctx, pvc)).To(Succeed())
+
+		path := "/media"
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"media": {ExistingClaim: &pvc.Name, Path: &path}}
+		rollingUpdate := appsv1.RollingUpdateDeploymentStrategyType
+		ab.Spec.Strategy = &atroxyzv1alpha1.AppBundleStrategy{Type: &rollingUpdate}
+		Expect(rec.ReconcileDeployment(ctx, ab)).To(Succeed())
+
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+		Expect(deployment.Spec.Strategy.Type).To(Equal(appsv1.RecreateDeploymentStrategyType))
+		Expect(deployment.Spec.Strategy.RollingUpdate).To(BeNil())
+	})
+
+	It("Should apply only the fields it sets", func() {
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		deployment, err := CreateExpectedDeployment(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		applied, err := ToApplyConfiguration(scheme.Scheme, deployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(BeAssignableToTypeOf(&appsv1ac.DeploymentApplyConfiguration{}))
+
+		// Zero values the deployment only has as they are not behind a pointer are left to the api server
+		spec := applied.(*appsv1ac.DeploymentApplyConfiguration).Spec
+		Expect(spec.MinReadySeconds).To(BeNil())
+		Expect(spec.Template.Spec.Containers[0].Resources).To(BeNil())
+		Expect(*spec.Template.Spec.Containers[0].Image).To(Equal(*ab.Spec.Image.Repository + ":" + *ab.Spec.Image.Tag))
+	})
+
 	Describe("Changing the app bundle to a more complex one with volumes and envs and ports", func() {
 		Context("And reconciling deployment", func() {
 			BeforeEach(func() {
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+
+// Reasons of the events recorded on AppBundles and AppBundleBases
+const (
+	EventReasonCreated         = "Created"
+	EventReasonUpdated         = "Updated"
+	EventReasonRecreated       = "Recreated"
+	EventReasonDeleted         = "Deleted"
+	EventReasonReleased        = "Released"
+	EventReasonCreateFailed    = "CreateFailed"
+	EventReasonUpdateFailed    = "UpdateFailed"
+	EventReasonRecreateFailed  = "RecreateFailed"
+	EventReasonDeleteFailed    = "DeleteFailed"
+	EventReasonReconcileFailed = "ReconcileFailed"
+	EventReasonBaseChanged     = "BaseChanged"
+)
+
+// maxEventNoteLength is the longest note the events API accepts.
+const maxEventNoteLength = 1024
+
+// RecordEvent records an event on the app bundle about a resource generated for it. Does nothing if the reconciler has no recorder (e.g. in tests).
+func (r *AppBundleReconciler) RecordEvent(ab *atroxyzv1alpha1.AppBundle, related client.Object, eventtype, reason, action, note string, args ...any) {
+	recordEvent(r.Recorder, ab, related, eventtype, reason, action, note, args...)
+}
+
+// RecordEvent records an event on the given object. Does nothing if the reconciler has no recorder (e.g. in tests).
+func (r *AppBundleBaseReconciler) RecordEvent(regarding, related runtime.Object, eventtype, reason, action, note string, args ...any) {
+	recordEvent(r.Recorder, regarding, related, eventtype, reason, action, note, args...)
+}
+
+func recordEvent(recorder events.EventRecorder, regarding, related runtime.Object, eventtype, reason, action, note string, args ...any) {
+	if recorder == nil {
+		return
+	}
+
+	message := fmt.Sprintf(note, args...)
+	if len(message) > maxEventNoteLength {
+		message = message[:maxEventNoteLength-3] + "..."
+	}
+
+	recorder.Eventf(regarding, related, eventtype, reason, action, "%s", message)
+}
+
+// GetKind returns the kind of the object, falling back to the go type name as typed objects usually have no TypeMeta set.
+func GetKind(obj runtime.Object) string {
+	if kind := obj.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+
+	return reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+}
@@ -0,0 +1,73 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Events recorded while reconciling service", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var recorder *events.FakeRecorder
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		recorder = events.NewFakeRecorder(10)
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: recorder}
+
+		// ADD ROUTE
+		port := 80
+		ab.Spec.Routes = map[string]atroxyzv1alpha1.AppBundleRoute{"test": {Port: &port}}
+
+		// CREATE APPBUNDLE
+		er := rec.Create(ctx, ab)
+		Expect(er).NotTo(HaveOccurred())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+	})
+
+	It("Should record the service being created and deleted", func() {
+		By("Reconciling service using app bundle")
+		err := rec.ReconcileService(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(Equal("Normal Created Created Service " + ab.Name)))
+
+		By("Removing the routes and reconciling again")
+		ab.Spec.Routes = nil
+		err = rec.ReconcileService(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(Equal("Normal Deleted Deleted Service " + ab.Name + " as there are no routes anymore")))
+	})
+
+	It("Should record the paths of the fields that changed", func() {
+		By("Reconciling service using app bundle")
+		err := rec.ReconcileService(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(Equal("Normal Created Created Service " + ab.Name)))
+
+		By("Reconciling again without any change")
+		err = rec.ReconcileService(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).NotTo(Receive())
+
+		By("Changing the port and reconciling again")
+		port := 81
+		ab.Spec.Routes = map[string]atroxyzv1alpha1.AppBundleRoute{"test": {Port: &port}}
+		err = rec.ReconcileService(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(And(
+			HavePrefix("Normal Updated Updated Service "+ab.Name+", namely the paths: "),
+			ContainSubstring("spec.ports.0.port"),
+		)))
+	})
+})
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// AppBundleFinalizer holds the deletion of an app bundle until what its owner references do not cover has been cleaned up:
+// resources in other namespaces (the longhorn recurring job) or none at all (cluster roles and their bindings) and the labels put on claims it uses but did not create.
+const AppBundleFinalizer = "atro.xyz/cleanup"
+
+// EnsureFinalizer adds AppBundleFinalizer to the app bundle if it does not have it yet.
+// Only the finalizers are patched, so the rest of the app bundle (e.g. defaults applied in memory) is never written back.
+func (r *AppBundleReconciler) EnsureFinalizer(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	patch := client.MergeFromWithOptions(ab.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	if !controllerutil.AddFinalizer(ab, AppBundleFinalizer) {
+		return nil
+	}
+
+	return r.Patch(ctx, ab, patch)
+}
+
+// FinalizeAppBundle cleans up after an app bundle being deleted and then lets the deletion go ahead by removing AppBundleFinalizer.
+func (r *AppBundleReconciler) FinalizeAppBundle(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	if !controllerutil.ContainsFinalizer(ab, AppBundleFinalizer) {
+		return nil
+	}
+
+	if err := r.DeleteRecurringBackupJob(ctx, ab, "its app bundle is being deleted"); err != nil {
+		return err
+	}
+
+	if err := r.ReleaseExistingPVCs(ctx, ab); err != nil {
+		return err
+	}
+
+	if err := r.DeleteClusterResources(ctx, ab, nil, "its app bundle is being deleted"); err != nil {
+		return err
+	}
+
+	patch := client.MergeFromWithOptions(ab.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(ab, AppBundleFinalizer)
+	return r.Patch(ctx, ab, patch)
+}
+
+// ReleaseExistingPVCs removes the labels applied by ReconcileExistingPVC from every claim the app bundle labelled but does not own,
+// and releases the claims it owns that are to be retained so they are not garbage collected with it.
+// The claims are found by label rather than from the spec, so claims dropped from the spec since are released too.
+func (r *AppBundleReconciler) ReleaseExistingPVCs(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcList, client.InNamespace(ab.Namespace), client.MatchingLabels{AppBundleSelector: ab.Name}); err != nil {
+		return err
+	}
+
+	for _, pvc := range pvcList.Items {
+		if IsOwnedBy(&pvc, ab) {
+			if pvc.Annotations[RetainAnnotation] == "true" {
+				if err := r.ReleasePVC(ctx, ab, &pvc); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := r.RemovePVCLabels(ctx, ab, &pvc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemovePVCLabels removes the labels ReconcileExistingPVC may have applied from a claim the app bundle does not own.
+// The keys are removed explicitly rather than by applying none, as earlier versions wrote them under a different field manager.
+// Labels with a value other than the one atrok would set were not applied by it, so they are left alone.
+func (r *AppBundleReconciler) RemovePVCLabels(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, pvc *corev1.PersistentVolumeClaim) error {
+	patch := client.MergeFrom(pvc.DeepCopy())
+
+	applied := SetDefaultAppBundleLabels(ab, GetPVCBackupLabels(ab))
+	for key, value := range applied {
+		if current, ok := pvc.Labels[key]; ok && current == value {
+			delete(pvc.Labels, key)
+		}
+	}
+
+	log.FromContext(ctx).Info("Removing labels from claim.", "name", pvc.Name)
+	if err := r.Patch(ctx, pvc, patch); err != nil {
+		r.RecordEvent(ab, pvc, corev1.EventTypeWarning, EventReasonUpdateFailed, "Release", "Failed to remove labels from PersistentVolumeClaim %s: %s", pvc.Name, err)
+		return err
+	}
+
+	r.RecordEvent(ab, pvc, corev1.EventTypeNormal, EventReasonReleased, "Release", "Removed the app bundle labels from PersistentVolumeClaim %s", pvc.Name)
+	return nil
+}
+
+// IsOwnedBy reports whether the object has an owner reference to the app bundle.
+func IsOwnedBy(obj client.Object, ab *atroxyzv1alpha1.AppBundle) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == ab.UID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Cleaning up after a deleted AppBundle", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+	var existingClaim *corev1.PersistentVolumeClaim
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		// CREATE A CLAIM THE APP BUNDLE DOES NOT OWN
+		existingClaim = &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: GetRandomName(), Namespace: ab.Namespace, Labels: map[string]string{"team": "media"}},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources:   corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}},
+			},
+		}
+		Expect(rec.Create(ctx, existingClaim)).To(Succeed())
+
+		// CREATE APPBUNDLE USING IT WITH BACKUPS
+		path := "/data"
+		frequency := "0 3 * * *"
+		retain := 3
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {Path: &path, ExistingClaim: &existingClaim.Name}}
+		ab.Spec.Backup = &atroxyzv1alpha1.AppBundleVolumeLonghornBackup{Frequency: &frequency, Retain: &retain}
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		Expect(rec.EnsureFinalizer(ctx, ab)).To(Succeed())
+		volume := ab.Spec.Volumes["data"]
+		Expect(rec.ReconcileExistingPVC(ctx, ab, &volume)).To(Succeed())
+	})
+
+	It("Should add the finalizer only once", func() {
+		Expect(rec.EnsureFinalizer(ctx, ab)).To(Succeed())
+		Expect(ab.Finalizers).To(Equal([]string{AppBundleFinalizer}))
+	})
+
+	It("Should add the finalizer without writing back the rest of the app bundle", func() {
+		stored := GetBasicAppBundle()
+		Expect(rec.Create(ctx, stored)).To(Succeed())
+
+		By("Changing the spec in memory only")
+		replicas := int32(7)
+		stored.Spec.Replicas = &replicas
+		Expect(rec.EnsureFinalizer(ctx, stored)).To(Succeed())
+
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(stored), stored)).To(Succeed())
+		Expect(stored.Finalizers).To(Equal([]string{AppBundleFinalizer}))
+		Expect(stored.Spec.Replicas).NotTo(Equal(&replicas))
+	})
+
+	It("Should strip its labels from claims it does not own", func() {
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(existingClaim), existingClaim)).To(Succeed())
+		Expect(existingClaim.Labels).To(HaveKeyWithValue("recurring-job.longhorn.io/"+GetRecurringJobName(ab), "enabled"))
+
+		By("Finalizing the app bundle")
+		Expect(rec.FinalizeAppBundle(ctx, ab)).To(Succeed())
+		Expect(controllerutil.ContainsFinalizer(ab, AppBundleFinalizer)).To(BeFalse())
+
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(existingClaim), existingClaim)).To(Succeed())
+		Expect(existingClaim.Labels).To(Equal(map[string]string{"team": "media"}))
+	})
+
+	It("Should strip labels written by an earlier version from claims it does not own", func() {
+		By("Labelling a claim client-side as earlier versions did")
+		labels := SetDefaultAppBundleLabels(ab, GetPVCBackupLabels(ab))
+		labels["team"] = "media"
+		labels["app.kubernetes.io/instance"] = "someone-else"
+		legacyClaim := existingClaim.DeepCopy()
+		legacyClaim.ObjectMeta = metav1.ObjectMeta{Name: GetRandomName(), Namespace: ab.Namespace, Labels: labels}
+		Expect(rec.Create(ctx, legacyClaim, client.FieldOwner("manager"))).To(Succeed())
+
+		By("Finalizing the app bundle")
+		Expect(rec.FinalizeAppBundle(ctx, ab)).To(Succeed())
+
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(legacyClaim), legacyClaim)).To(Succeed())
+		Expect(legacyClaim.Labels).To(Equal(map[string]string{"team": "media", "app.kubernetes.io/instance": "someone-else"}))
+	})
+
+	It("Should strip the backup labels once backups are turned off", func() {
+		ab.Spec.Backup = nil
+		volume := ab.Spec.Volumes["data"]
+		Expect(rec.ReconcileExistingPVC(ctx, ab, &volume)).To(Succeed())
+
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(existingClaim), existingClaim)).To(Succeed())
+		Expect(existingClaim.Labels).NotTo(HaveKey("recurring-job.longhorn.io/" + GetRecurringJobName(ab)))
+		Expect(existingClaim.Labels).To(HaveKeyWithValue(AppBundleSelector, ab.Name))
+	})
+})
@@ -4,30 +4,36 @@ import (
 	"fmt"
 	"sync"
 
+	extsec "github.com/external-secrets/external-secrets/apis/externalsecrets/v1"
+	longhornv1beta2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 )
 
-// Need to abstract this away into operator install (helm chart install)
-// TESTING ONLY !!!
-var (
-	image_pull_secrets     []corev1.LocalObjectReference = []corev1.LocalObjectReference{{Name: "regcred"}}
-	auth_middleware        string                        = "auth-authelia@kubernetescrd"
-	entry_point            string                        = "websecure"
-	cluster_issuer         string                        = "letsencrypt"
-	base_homepage_instance string                        = "atro"
-)
-
-// TESTING ONLY !!!
-
 // AppBundleReconciler reconciles a AppBundle object
 type AppBundleReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// ConfigName is the name of the cluster-scoped AtrokConfig to read, defaults to atroxyzv1alpha1.DefaultAtrokConfigName.
+	ConfigName string
+	// Recorder records events on the app bundles about the resources generated for them.
+	Recorder events.EventRecorder
+	// BaseEvents receives the app bundles whose chain of bases changed, sent by the app bundle base controller.
+	BaseEvents <-chan event.GenericEvent
 }
 
 type ResourceMutexes struct {
@@ -57,9 +63,57 @@ func getMutex(resourceType, name, namespace string) *sync.Mutex {
 	return mu
 }
 
+// releaseMutexes forgets the mutexes of every resource type for the named app bundle once it is gone, so they do not pile up.
+// Only safe to call while holding its "appBundle" mutex, as no other reconcile of the app bundle can then be using them.
+func releaseMutexes(name, namespace string) {
+	resourceMutexes.Lock()
+	defer resourceMutexes.Unlock()
+	fullName := fmt.Sprintf("%s-%s", name, namespace)
+
+	for _, mutexes := range resourceMutexes.m {
+		delete(mutexes, fullName)
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
+// Changes to the generated resources and to anything an app bundle refers to are watched, so drift is corrected as soon as it happens rather than on a timer.
 func (r *AppBundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&atroxyzv1alpha1.AppBundle{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		// Status updates bump neither the generation nor labels/annotations, so the reconciler writing status does not retrigger itself
+		For(&atroxyzv1alpha1.AppBundle{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.LabelChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+			// Deletion has to reach the reconciler so the finalizer gets removed
+			predicate.Funcs{UpdateFunc: func(e event.UpdateEvent) bool { return !e.ObjectNew.GetDeletionTimestamp().IsZero() }},
+		))).
+		// The owner references set on generated resources are not controller references
+		Owns(&appsv1.Deployment{}, builder.MatchEveryOwner).
+		Owns(&appsv1.StatefulSet{}, builder.MatchEveryOwner).
+		Owns(&appsv1.DaemonSet{}, builder.MatchEveryOwner).
+		Owns(&batchv1.Job{}, builder.MatchEveryOwner).
+		Owns(&batchv1.CronJob{}, builder.MatchEveryOwner).
+		Owns(&corev1.Service{}, builder.MatchEveryOwner).
+		Owns(&netv1.Ingress{}, builder.MatchEveryOwner).
+		Owns(&corev1.ConfigMap{}, builder.MatchEveryOwner).
+		Owns(&corev1.PersistentVolumeClaim{}, builder.MatchEveryOwner).
+		Owns(&extsec.ExternalSecret{}, builder.MatchEveryOwner).
+		Owns(&corev1.ServiceAccount{}, builder.MatchEveryOwner).
+		Owns(&rbacv1.Role{}, builder.MatchEveryOwner).
+		Owns(&rbacv1.RoleBinding{}, builder.MatchEveryOwner).
+		Watches(&atroxyzv1alpha1.AtrokConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapAtrokConfigToAppBundles)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigMapToAppBundles)).
+		// Only the metadata of secrets is cached, their content is never read
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapSecretToAppBundles), builder.OnlyMetadata)
+
+	if r.BaseEvents != nil {
+		b = b.WatchesRawSource(source.Channel(r.BaseEvents, &handler.EnqueueRequestForObject{}))
+	}
+
+	// Longhorn is only needed for backups, so its volumes are only watched if it is installed
+	if _, err := mgr.GetRESTMapper().RESTMapping(longhornv1beta2.SchemeGroupVersion.WithKind("Volume").GroupKind(), longhornv1beta2.SchemeGroupVersion.Version); err == nil {
+		b = b.Watches(&longhornv1beta2.Volume{}, handler.EnqueueRequestsFromMapFunc(r.mapLonghornVolumeToAppBundles))
+	}
+
+	return b.Complete(r)
 }
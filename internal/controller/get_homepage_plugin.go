@@ -6,7 +6,7 @@ import (
 
 // TODO: Remove the gethomepage.dev stuff once moved away from gethomepage.
 
-func GetHomePageAnnotations(annotations map[string]string, ab *atroxyzv1alpha1.AppBundle) map[string]string {
+func GetHomePageAnnotations(annotations map[string]string, ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) map[string]string {
 	newAnnotations := make(map[string]string)
 
 	for key, value := range annotations {
@@ -15,6 +15,10 @@ func GetHomePageAnnotations(annotations map[string]string, ab *atroxyzv1alpha1.A
 
 	newAnnotations["atro.xyz/homepage.enabled"] = "true"
 
+	if cfg.HomepageInstance != nil {
+		newAnnotations["atro.xyz/homepage.instance"] = *cfg.HomepageInstance
+	}
+
 	if ab.Spec.Homepage.Description != nil {
 		newAnnotations["atro.xyz/homepage.description"] = *ab.Spec.Homepage.Description
 	}
@@ -2,98 +2,199 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 	"github.com/r3labs/diff/v3"
 	"golang.org/x/sync/errgroup"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	k8serror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-type ReaderWriter interface {
-	client.Reader
-	client.Writer
-}
+// FieldManager is the field manager the generated resources are applied under, leaving fields set by anyone else (e.g. an HPA scaling the replicas) alone.
+const FieldManager = "atrok"
+
+// LegacyFieldManagers are the field managers the resources were written under by versions of atrok that created and updated them client-side,
+// named after the binary: manager when built by the Makefile or the Dockerfile, main when run with go run.
+var LegacyFieldManagers = sets.New("manager", "main")
 
-func GetDiffPaths(oldObj, newObj interface{}) (string, error) {
-	changes, err := diff.Diff(oldObj, newObj)
+// ApplyResource server-side applies the resource as generated for the app bundle, recording an event on the app bundle if it was created or changed.
+// Only the fields set on obj are owned by atrok, fields defaulted by the api server or set by other controllers are left as they are.
+// Unless neverDelete is set, a resource whose immutable fields changed is deleted and created again, a stateful set once the pods it leaves behind are orphaned.
+// Returns whether anything changed.
+func (r *AppBundleReconciler) ApplyResource(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, obj client.Object, neverDelete bool) (bool, error) {
+	kind := GetKind(obj)
+
+	current, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return false, fmt.Errorf("%s is not a client object", kind)
+	}
+	er := r.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	if er != nil && !k8serror.IsNotFound(er) {
+		return false, er
+	}
+	if er == nil {
+		if err := r.UpgradeManagedFields(ctx, current); err != nil {
+			return false, err
+		}
+	}
+
+	applied, err := ToApplyConfiguration(r.Client.Scheme(), obj)
 	if err != nil {
-		return "", err
+		return false, err
 	}
 
-	paths := []string{}
-	for _, change := range changes {
-		path := ""
-		for _, p := range change.Path {
-			path += p + "/"
+	if err := r.Apply(ctx, applied, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		if k8serror.IsNotFound(er) {
+			r.RecordEvent(ab, obj, corev1.EventTypeWarning, EventReasonCreateFailed, "Create", "Failed to create %s %s: %s", kind, obj.GetName(), err)
+			return false, err
 		}
-		paths = append(paths, path)
+		if !ShouldRecreateResource(err) || neverDelete {
+			r.RecordEvent(ab, obj, corev1.EventTypeWarning, EventReasonUpdateFailed, "Update", "Failed to update %s %s: %s", kind, obj.GetName(), err)
+			return false, err
+		}
+
+		// A stateful set is deleted without its pods, which the recreated one adopts, instead of taking every replica down at once
+		propagation := metav1.DeletePropagationBackground
+		if _, ok := obj.(*appsv1.StatefulSet); ok {
+			propagation = metav1.DeletePropagationOrphan
+		}
+		if derr := r.Delete(ctx, current, client.PropagationPolicy(propagation)); derr != nil {
+			r.RecordEvent(ab, obj, corev1.EventTypeWarning, EventReasonRecreateFailed, "Delete", "Failed to delete %s %s for recreation: %s", kind, obj.GetName(), derr)
+			return false, derr
+		}
+		// Orphaning keeps the resource around until the garbage collector has released its dependents, its deletion then triggers the reconcile recreating it
+		if propagation == metav1.DeletePropagationOrphan {
+			if gerr := r.Get(ctx, client.ObjectKeyFromObject(obj), current); gerr == nil {
+				r.RecordEvent(ab, obj, corev1.EventTypeNormal, EventReasonDeleted, "Recreate", "Deleted %s %s for recreation as an immutable field changed, keeping its pods", kind, obj.GetName())
+				return true, nil
+			} else if !k8serror.IsNotFound(gerr) {
+				return false, gerr
+			}
+		}
+		if applied, err = ToApplyConfiguration(r.Client.Scheme(), obj); err != nil {
+			return false, err
+		}
+		if cerr := r.Apply(ctx, applied, client.FieldOwner(FieldManager), client.ForceOwnership); cerr != nil {
+			r.RecordEvent(ab, obj, corev1.EventTypeWarning, EventReasonRecreateFailed, "Create", "Failed to recreate %s %s: %s", kind, obj.GetName(), cerr)
+			return false, cerr
+		}
+		r.RecordEvent(ab, obj, corev1.EventTypeNormal, EventReasonRecreated, "Recreate", "Recreated %s %s as an immutable field changed", kind, obj.GetName())
+		return true, nil
 	}
 
-	output := "\n"
-	for _, path := range paths {
-		output += path + "\n"
+	result, err := FromApplyConfiguration(applied, obj)
+	if err != nil {
+		return false, err
 	}
 
-	return output, nil
-}
+	if k8serror.IsNotFound(er) {
+		log.FromContext(ctx).Info("Created resource.", "type", reflect.TypeOf(obj).String(), "name", obj.GetName())
+		r.RecordEvent(ab, obj, corev1.EventTypeNormal, EventReasonCreated, "Create", "Created %s %s", kind, obj.GetName())
+		return true, nil
+	}
 
-func FormulateDiffMessageForSpecs(oldObjSpec, newObjSpec interface{}) (string, error) {
-	diff, err := GetDiffPaths(oldObjSpec, newObjSpec)
+	paths, err := GetChangedFieldPaths(current, result)
 	if err != nil {
-		return "", err
+		return false, err
 	}
-	reason := "Spec changed, namely the paths: " + diff
-	return reason, nil
+	if len(paths) == 0 {
+		return false, nil
+	}
+
+	log.FromContext(ctx).Info("Applied changes to resource.", "type", reflect.TypeOf(obj).String(), "name", obj.GetName(), "paths", paths)
+	r.RecordEvent(ab, obj, corev1.EventTypeNormal, EventReasonUpdated, "Update", "Updated %s %s, namely the paths: %s", kind, obj.GetName(), strings.Join(paths, ", "))
+	return true, nil
 }
 
-func FormulateDiffMessageForLabels(oldObjLabels, newObjLabels interface{}) (string, error) {
-	diff, err := GetDiffPaths(oldObjLabels, newObjLabels)
-	if err != nil {
-		return "", err
+// UpgradeManagedFields hands the fields written client-side under LegacyFieldManagers over to FieldManager, doing nothing once they have been.
+// Otherwise they would stay co-owned by the old manager, and fields dropped from the app bundle (an env, a port, a label) would never be removed by the apply.
+func (r *AppBundleReconciler) UpgradeManagedFields(ctx context.Context, obj client.Object) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(obj, LegacyFieldManagers, FieldManager)
+	if err != nil || patch == nil {
+		return err
 	}
-	reason := "Labels changed, namely the paths: " + diff
-	return reason, nil
+
+	log.FromContext(ctx).Info("Upgrading managed fields of resource to server-side apply.", "type", reflect.TypeOf(obj).String(), "name", obj.GetName())
+	return r.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, patch))
 }
 
-// UpsertResource creates or updates a resource with nice logging indicating what is happening.
-func UpsertResource(ctx context.Context, r ReaderWriter, newObj client.Object, reason string, er error, neverDelete bool) error {
-	l := log.FromContext(ctx)
+// GetChangedFieldPaths returns the paths of the fields that differ between the object before and after it was applied, e.g. spec.replicas.
+// Of the metadata only the labels, annotations and owner references are compared, the rest of it changes with every write.
+func GetChangedFieldPaths(before, after client.Object) ([]string, error) {
+	beforeFields, err := getComparedFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := getComparedFields(after)
+	if err != nil {
+		return nil, err
+	}
 
-	if er != nil && !k8serror.IsNotFound(er) {
-		return er
+	changes, err := diff.Diff(beforeFields, afterFields)
+	if err != nil {
+		return nil, err
 	}
 
-	if reason != "" {
-		l.Info("Upserting reason because: " + reason)
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, strings.Join(change.Path, "."))
 	}
+	slices.Sort(paths)
 
-	if k8serror.IsNotFound(er) {
-		l.Info("Creating resource.", "type", reflect.TypeOf(newObj).String(), "object", newObj)
-		if err := r.Create(ctx, newObj); err != nil {
-			return err
-		}
-	} else {
-		l.Info("Resource exists but changes were found.", "type", reflect.TypeOf(newObj).String(), "object", newObj)
-		if err := r.Update(ctx, newObj); err != nil {
-			if ShouldRecreateResource(err) && !neverDelete {
-				if derr := r.Delete(ctx, newObj); derr != nil {
-					return derr
-				}
-				if cerr := r.Create(ctx, newObj); cerr != nil {
-					return cerr
-				}
+	return slices.Compact(paths), nil
+}
+
+// getComparedFields returns the fields of the object GetChangedFieldPaths compares.
+func getComparedFields(obj client.Object) (map[string]any, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]any{}
+	if current, ok := content["metadata"].(map[string]any); ok {
+		for _, key := range []string{"labels", "annotations", "ownerReferences"} {
+			if value, ok := current[key]; ok {
+				metadata[key] = value
 			}
-			return err
 		}
 	}
+	content["metadata"] = metadata
+	delete(content, "apiVersion")
+	delete(content, "kind")
+	delete(content, "status")
+
+	return content, nil
+}
+
+// DeleteResource deletes a resource generated for the app bundle that is no longer expected, recording an event on the app bundle for the outcome.
+func (r *AppBundleReconciler) DeleteResource(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, obj client.Object, reason string) error {
+	kind := GetKind(obj)
+	log.FromContext(ctx).Info("Deleting resource.", "type", reflect.TypeOf(obj).String(), "name", obj.GetName(), "reason", reason)
+
+	// Jobs orphan their pods unless told otherwise
+	if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil
+		}
+		r.RecordEvent(ab, obj, corev1.EventTypeWarning, EventReasonDeleteFailed, "Delete", "Failed to delete %s %s: %s", kind, obj.GetName(), err)
+		return err
+	}
 
+	r.RecordEvent(ab, obj, corev1.EventTypeNormal, EventReasonDeleted, "Delete", "Deleted %s %s as %s", kind, obj.GetName(), reason)
 	return nil
 }
 
@@ -103,6 +204,14 @@ func ShouldRecreateResource(err error) bool {
 	if strings.Contains(err.Error(), "is invalid: spec.selector: Invalid value:") && strings.Contains(err.Error(), "field is immutable") {
 		return true
 	}
+	// Most of the spec of a stateful set, e.g. its volume claim templates, can not be changed at all.
+	if strings.Contains(err.Error(), "updates to statefulset spec for fields other than") {
+		return true
+	}
+	// The pod template of a job can not be changed, a job that changed is run again instead.
+	if strings.Contains(err.Error(), "spec.template: Invalid value:") && strings.Contains(err.Error(), "field is immutable") {
+		return true
+	}
 	return false
 }
 
@@ -176,21 +285,4 @@ func SetDefaultAppBundleLabels(ab *atroxyzv1alpha1.AppBundle, labels map[string]
 	return labels
 }
 
-func StringMapsMatch(map1, map2 map[string]string) bool {
-	// Check if the lengths are equal
-	if len(map1) != len(map2) {
-		return false
-	}
-
-	// Iterate through the first map
-	for key, value := range map1 {
-		// Check if the key exists in the second map
-		if val, ok := map2[key]; !ok || val != value {
-			return false
-		}
-	}
-
-	return true
-}
-
 var AppBundleSelector = "appbundle"
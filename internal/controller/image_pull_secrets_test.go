@@ -0,0 +1,93 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle with image pull secrets", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		secretStoreRef := "vault"
+		ab.Spec.SecretStoreRef = &secretStoreRef
+		ab.Spec.Image.PullSecrets = []string{"ghcr"}
+		ab.Spec.Image.Registry = &atroxyzv1alpha1.AppBundleImageRegistry{
+			Server:   "registry.atro.xyz",
+			Username: "registry/username",
+			Password: "registry/password",
+		}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should pull with the secrets of the app bundle instead of those of the config", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		Expect(deployment.Spec.Template.Spec.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "ghcr"}, {Name: GetRegistrySecretName(ab)}}))
+	})
+
+	It("Should keep pulling with the secrets of the config when the app bundle has none", func() {
+		ab.Spec.Image.PullSecrets = nil
+		ab.Spec.Image.Registry = nil
+
+		cfg := atroxyzv1alpha1.AtrokConfigSpec{ImagePullSecrets: []string{"regcred"}}
+		Expect(GetImagePullSecrets(ab, &cfg)).To(Equal([]corev1.LocalObjectReference{{Name: "regcred"}}))
+	})
+
+	It("Should generate a docker config secret from the registry credentials", func() {
+		externalSecret, err := CreateExpectedRegistryExternalSecret(ab)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(externalSecret.Name).To(Equal(GetRegistrySecretName(ab)))
+		Expect(externalSecret.Spec.SecretStoreRef.Name).To(Equal("vault"))
+		Expect(externalSecret.Spec.Data).To(HaveLen(2))
+		Expect(externalSecret.Spec.Data[0].SecretKey).To(Equal("password"))
+		Expect(externalSecret.Spec.Data[0].RemoteRef.Key).To(Equal("registry/password"))
+		Expect(externalSecret.Spec.Data[1].SecretKey).To(Equal("username"))
+
+		template := externalSecret.Spec.Target.Template
+		Expect(template.Type).To(Equal(corev1.SecretTypeDockerConfigJson))
+		Expect(template.Data).To(HaveKey(corev1.DockerConfigJsonKey))
+		Expect(template.Data[corev1.DockerConfigJsonKey]).To(HavePrefix(`{"auths":{"registry.atro.xyz":{`))
+
+		// The external secret of the envs and configs is left to what they reference
+		externalSecrets, err := CreateExpectedExternalSecrets(ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(externalSecrets).To(HaveKeyWithValue(ab.Name, BeNil()))
+	})
+
+	It("Should inherit the pull secrets from a base", func() {
+		tag := "v2"
+		inherited := &atroxyzv1alpha1.AppBundleSpec{Image: ab.Spec.Image.DeepCopy()}
+		spec := &atroxyzv1alpha1.AppBundleSpec{Image: &atroxyzv1alpha1.AppBundleImage{Tag: &tag}}
+
+		merged, err := atroxyzv1alpha1.MergeAppBundleSpecs(inherited, spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*merged.Image.Tag).To(Equal("v2"))
+		Expect(merged.Image.PullSecrets).To(Equal([]string{"ghcr"}))
+		Expect(merged.Image.Registry.Server).To(Equal("registry.atro.xyz"))
+	})
+})
@@ -3,27 +3,34 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 	netv1 "k8s.io/api/networking/v1"
-	equality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // CreateExpectedIngress creates the expected ingress from the appbundle and the name given
-func CreateExpectedIngress(ab *atroxyzv1alpha1.AppBundle, name string, route *atroxyzv1alpha1.AppBundleRoute) (*netv1.Ingress, error) {
+func CreateExpectedIngress(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec, name string, route *atroxyzv1alpha1.AppBundleRoute) (*netv1.Ingress, error) {
+	if route.Port == nil || route.Ingress == nil || route.Ingress.Domain == nil {
+		return nil, fmt.Errorf("route for ingress %s has no port or domain", name)
+	}
+
 	ingress := &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{
 		Name:            name,
 		Namespace:       ab.Namespace,
 		OwnerReferences: []metav1.OwnerReference{ab.OwnerReference()},
-		Annotations:     ab.ObjectMeta.Annotations,
+		Annotations:     make(map[string]string),
 	}}
 
-	// If no annotation, add it
-	if ingress.Annotations == nil {
-		ingress.Annotations = make(map[string]string)
+	// Operator-wide annotations first so the ones set on the app bundle win
+	for key, value := range cfg.IngressAnnotations {
+		ingress.Annotations[key] = value
+	}
+	for key, value := range ab.ObjectMeta.Annotations {
+		ingress.Annotations[key] = value
 	}
 	if ingress.Labels == nil {
 		ingress.Labels = make(map[string]string)
@@ -34,11 +41,11 @@ func CreateExpectedIngress(ab *atroxyzv1alpha1.AppBundle, name string, route *at
 
 	// CHECK and BUILD the resource
 	ingress.Labels = SetDefaultAppBundleLabels(ab, ingress.Labels)
-	ingress.Annotations["traefik.ingress.kubernetes.io/router.entryPoints"] = entry_point
+	ingress.Annotations["traefik.ingress.kubernetes.io/router.entryPoints"] = *cfg.EntryPoint
 	ingress.Annotations["traefik.ingress.kubernetes.io/router.tls"] = "true"
-	ingress.Annotations["cert-manager.io/cluster-issuer"] = cluster_issuer
-	if auth_middleware != "" && *route.Ingress.Auth {
-		ingress.Annotations["traefik.ingress.kubernetes.io/router.middlewares"] = auth_middleware
+	ingress.Annotations["cert-manager.io/cluster-issuer"] = *cfg.ClusterIssuer
+	if *cfg.AuthMiddleware != "" && route.Ingress.Auth != nil && *route.Ingress.Auth {
+		ingress.Annotations["traefik.ingress.kubernetes.io/router.middlewares"] = *cfg.AuthMiddleware
 	}
 
 	// BUILD the resource
@@ -83,15 +90,14 @@ func CreateExpectedIngress(ab *atroxyzv1alpha1.AppBundle, name string, route *at
 
 	// check if ingress.Name ends on "web" and if ab.Spec.Homepage is not nil
 	if len(ingress.Name) > 3 && ingress.Name[len(ingress.Name)-3:] == "web" && ab.Spec.Homepage != nil {
-		ingress.SetAnnotations(GetHomePageAnnotations(ingress.Annotations, ab))
+		ingress.SetAnnotations(GetHomePageAnnotations(ingress.Annotations, ab, cfg))
 	}
 
 	return ingress, nil
 }
 
+// ReconcileIngress applies an ingress for every route that asks for one. Ingresses of routes that no longer do are deleted by PruneResources.
 func (r *AppBundleReconciler) ReconcileIngress(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
-	l := log.FromContext(ctx)
-
 	// LOCK THE APP BUNDLE INGRESS MUTEX
 	mu := getMutex("ingresses", ab.Name, ab.Namespace)
 	mu.Lock()
@@ -108,31 +114,17 @@ func (r *AppBundleReconciler) ReconcileIngress(ctx context.Context, ab *atroxyzv
 		}
 	}
 
-	// GET CURRENT INGRESSES
-	ingresses := &netv1.IngressList{}
-	if err := r.List(ctx, ingresses, client.InNamespace(ab.Namespace), client.MatchingLabels{AppBundleSelector: ab.Name}); err != nil {
-		return err
-	}
-
-	if ab.Spec.Routes == nil && (ingresses.Items == nil || len(ingresses.Items) == 0) {
-		return nil
-	}
-
-	// DELETE CURRENT INGRESSES THAT ARE NOT IN THE EXPECTED NAMES LIST
-	for _, ingress := range ingresses.Items {
-		if !contains(names, ingress.Name) {
-			l.Info("Deleting ingress " + ingress.Name)
-			if err := r.Delete(ctx, &ingress); err != nil {
-				return err
-			}
-		}
-	}
-
 	// IF EXPECTED NUMBER OF INGRESSES IS 0 THEN RETURN
 	if len(names) == 0 {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionIngressReady, true, atroxyzv1alpha1.ReasonNotRequired, "No routes with ingress defined")
 		return nil
 	}
 
+	cfg, err := r.GetAtrokConfig(ctx)
+	if err != nil {
+		return err
+	}
+
 	// ITERATE OVER THE EXPECTED INGRESSES
 	for _, key := range getSortedKeys(ab.Spec.Routes) {
 		route := ab.Spec.Routes[key]
@@ -144,32 +136,50 @@ func (r *AppBundleReconciler) ReconcileIngress(ctx context.Context, ab *atroxyzv
 		ingressName := ab.Name + "-" + key
 
 		// GET THE EXPECTED INGRESS
-		expectedIngress, err := CreateExpectedIngress(ab, ingressName, &route)
+		expectedIngress, err := CreateExpectedIngress(ab, cfg, ingressName, &route)
 		if err != nil {
 			return err
 		}
 
-		// GET THE CURRENT INGRESS
-		currentIngress := &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{
-			Name:            ingressName,
-			Namespace:       ab.Namespace,
-			OwnerReferences: []metav1.OwnerReference{ab.OwnerReference()},
-		}}
-		er := r.Get(ctx, client.ObjectKeyFromObject(currentIngress), currentIngress)
-
-		// IF CURRENT != EXPECTED THEN UPSERT
-		if !equality.Semantic.DeepDerivative(expectedIngress.Spec, currentIngress.Spec) {
-			reason, err := FormulateDiffMessageForSpecs(currentIngress.Spec, expectedIngress.Spec)
-			if err != nil {
-				return err
-			}
+		// APPLY THE EXPECTED INGRESS
+		if _, err := r.ApplyResource(ctx, ab, expectedIngress, false); err != nil {
+			return err
+		}
+	}
+
+	return r.ReportIngressStatus(ctx, ab, names)
+}
 
-			if err := UpsertResource(ctx, r, expectedIngress, reason, er, false); err != nil {
+// ReportIngressStatus sets the IngressReady condition and the ingress resource statuses on the app bundle.
+func (r *AppBundleReconciler) ReportIngressStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, names []string) error {
+	missing := []string{}
+	for _, name := range names {
+		ingress := &netv1.Ingress{}
+		healthy, message := true, "Ingress exists"
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: ab.Namespace}, ingress); err != nil {
+			if !errors.IsNotFound(err) {
 				return err
 			}
+			// Just created and not yet visible
+			healthy, message = false, "Ingress is being created"
+			missing = append(missing, name)
 		}
+
+		SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+			Kind:      "Ingress",
+			Name:      name,
+			Namespace: ab.Namespace,
+			Healthy:   healthy,
+			Message:   message,
+		})
+	}
+
+	if len(missing) != 0 {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionIngressReady, false, atroxyzv1alpha1.ReasonProgressing, "Ingresses being created: "+strings.Join(missing, ", "))
+		return nil
 	}
 
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionIngressReady, true, atroxyzv1alpha1.ReasonAvailable, fmt.Sprintf("%d ingresses exist", len(names)))
 	return nil
 }
 
@@ -115,8 +115,8 @@ var _ = Describe("Correctly populated AppBundle with no routes reconcilling ingr
 						Expect(err).NotTo(HaveOccurred())
 						Expect(ingressBefore.Spec.Rules).To(HaveLen(1))
 
-						// RECONCILE ingress
-						err = rec.ReconcileIngress(ctx, ab)
+						// PRUNE ingress
+						err = rec.PruneResources(ctx, ab)
 						Expect(err).NotTo(HaveOccurred())
 
 						// GET ingress
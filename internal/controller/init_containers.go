@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// CreateExpectedInitContainers creates the init containers of the appbundle in the order they are listed.
+// Each mounts what the container of the app bundle mounts and gets its envs, the envs of the init container taking precedence over those of the same name.
+func CreateExpectedInitContainers(ab *atroxyzv1alpha1.AppBundle, container *corev1.Container) ([]corev1.Container, error) {
+	initContainers := []corev1.Container{}
+	for _, initContainer := range ab.Spec.InitContainers {
+		image := container.Image
+		imagePullPolicy := container.ImagePullPolicy
+		if initContainer.Image != nil {
+			if initContainer.Image.Repository == nil || initContainer.Image.Tag == nil {
+				return nil, fmt.Errorf("init container %s has no image repository or tag", initContainer.Name)
+			}
+			image = fmt.Sprintf("%s:%s", *initContainer.Image.Repository, *initContainer.Image.Tag)
+			imagePullPolicy = corev1.PullAlways
+			if initContainer.Image.PullPolicy != nil {
+				imagePullPolicy = *initContainer.Image.PullPolicy
+			}
+		}
+
+		// An env is either plain or sourced, so the one of the init container replaces the one of the app bundle whichever it is
+		envs := maps.Clone(ab.Spec.Envs)
+		sourcedEnvs := maps.Clone(ab.Spec.SourcedEnvs)
+		for key, value := range initContainer.Envs {
+			delete(sourcedEnvs, key)
+			if envs == nil {
+				envs = map[string]string{}
+			}
+			envs[key] = value
+		}
+		for key, value := range initContainer.SourcedEnvs {
+			delete(envs, key)
+			if sourcedEnvs == nil {
+				sourcedEnvs = map[string]atroxyzv1alpha1.AppBundleSourcedEnv{}
+			}
+			sourcedEnvs[key] = value
+		}
+
+		env, err := GetContainerEnv(ab, envs, sourcedEnvs)
+		if err != nil {
+			return nil, fmt.Errorf("init container %s: %w", initContainer.Name, err)
+		}
+
+		resources := corev1.ResourceRequirements{}
+		if initContainer.Resources != nil {
+			resources = *initContainer.Resources
+		}
+
+		c := corev1.Container{
+			Name:            initContainer.Name,
+			Image:           image,
+			ImagePullPolicy: imagePullPolicy,
+			Resources:       resources,
+			Env:             env,
+			VolumeMounts:    container.VolumeMounts,
+		}
+
+		for _, command := range initContainer.Command {
+			c.Command = append(c.Command, *command)
+		}
+		for _, arg := range initContainer.Args {
+			c.Args = append(c.Args, *arg)
+		}
+
+		initContainers = append(initContainers, c)
+	}
+
+	return initContainers, nil
+}
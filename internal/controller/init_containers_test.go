@@ -0,0 +1,74 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle with init containers", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		path := "/config"
+		emptyDir := true
+		copyOver := true
+		busybox := "busybox"
+		stable := "stable"
+		chown := "chown -R 1000:1000 /config"
+		migrate := "migrate"
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"config": {EmptyDir: &emptyDir, Path: &path}}
+		ab.Spec.Configs = map[string]atroxyzv1alpha1.AppBundleConfig{"app": {FileName: "app.yaml", Content: "debug: true", DirPath: "/config", CopyOver: &copyOver}}
+		ab.Spec.Envs = map[string]string{"DB_HOST": "postgres", "LOG_LEVEL": "info"}
+		ab.Spec.InitContainers = []atroxyzv1alpha1.AppBundleInitContainer{
+			{Name: "fix-permissions", Image: &atroxyzv1alpha1.AppBundleImage{Repository: &busybox, Tag: &stable}, Command: []*string{&chown}},
+			{Name: "migrate", Args: []*string{&migrate}, Envs: map[string]string{"LOG_LEVEL": "debug"}},
+		}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileConfigMap(ctx, ab)).To(Succeed())
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should run the init containers in order after copying over the configs", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		initContainers := deployment.Spec.Template.Spec.InitContainers
+		Expect(initContainers).To(HaveLen(3))
+		Expect(initContainers[0].Name).To(Equal("copy-over-app"))
+		Expect(initContainers[1].Name).To(Equal("fix-permissions"))
+		Expect(initContainers[1].Image).To(Equal("busybox:stable"))
+		Expect(initContainers[2].Name).To(Equal("migrate"))
+	})
+
+	It("Should give the init containers the volumes and envs of the app bundle", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		container := deployment.Spec.Template.Spec.Containers[0]
+		migrate := deployment.Spec.Template.Spec.InitContainers[2]
+		Expect(migrate.Image).To(Equal(container.Image))
+		Expect(migrate.VolumeMounts).To(Equal(container.VolumeMounts))
+		Expect(migrate.Env).To(Equal([]corev1.EnvVar{{Name: "DB_HOST", Value: "postgres"}, {Name: "LOG_LEVEL", Value: "debug"}}))
+	})
+})
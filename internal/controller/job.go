@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// CreateExpectedJobSpec creates the spec of the jobs run for the appbundle, the one job of the Job kind and those started by the CronJob kind alike.
+func CreateExpectedJobSpec(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (*batchv1.JobSpec, error) {
+	template, err := CreateExpectedPodTemplate(ab, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// A job runs to completion, retrying in place on failure
+	template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+
+	// Sidecars run as native sidecars, stopped once the container of the app bundle is done, otherwise the job would never complete
+	always := corev1.ContainerRestartPolicyAlways
+	for _, sidecar := range template.Spec.Containers[1:] {
+		sidecar.RestartPolicy = &always
+		template.Spec.InitContainers = append(template.Spec.InitContainers, sidecar)
+	}
+	template.Spec.Containers = template.Spec.Containers[:1]
+
+	jobSpec := &batchv1.JobSpec{Template: *template}
+	if ab.Spec.Workload != nil && ab.Spec.Workload.Job != nil {
+		jobSpec.BackoffLimit = ab.Spec.Workload.Job.BackoffLimit
+		jobSpec.ActiveDeadlineSeconds = ab.Spec.Workload.Job.ActiveDeadlineSeconds
+		jobSpec.TTLSecondsAfterFinished = ab.Spec.Workload.Job.TTLSecondsAfterFinished
+	}
+
+	return jobSpec, nil
+}
+
+// CreateExpectedJob creates expected job from appbundle
+func CreateExpectedJob(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (*batchv1.Job, error) {
+	job := &batchv1.Job{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+
+	// Metadata
+	job.ObjectMeta.Annotations = ab.GetAnnotations()
+	if job.ObjectMeta.Annotations == nil {
+		job.ObjectMeta.Annotations = make(map[string]string)
+	}
+	job.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+
+	jobSpec, err := CreateExpectedJobSpec(ab, cfg)
+	if err != nil {
+		return nil, err
+	}
+	job.Spec = *jobSpec
+
+	return job, nil
+}
+
+// CreateExpectedCronJob creates expected cron job from appbundle
+func CreateExpectedCronJob(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (*batchv1.CronJob, error) {
+	if ab.Spec.Workload == nil || ab.Spec.Workload.CronJob == nil || ab.Spec.Workload.CronJob.Schedule == nil {
+		return nil, fmt.Errorf("app bundle %s has no cron job schedule", ab.Name)
+	}
+	settings := ab.Spec.Workload.CronJob
+
+	cronJob := &batchv1.CronJob{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+
+	// Metadata
+	cronJob.ObjectMeta.Annotations = ab.GetAnnotations()
+	if cronJob.ObjectMeta.Annotations == nil {
+		cronJob.ObjectMeta.Annotations = make(map[string]string)
+	}
+	cronJob.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+
+	jobSpec, err := CreateExpectedJobSpec(ab, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cronJob.Spec = batchv1.CronJobSpec{
+		Schedule:                   *settings.Schedule,
+		TimeZone:                   settings.TimeZone,
+		StartingDeadlineSeconds:    settings.StartingDeadlineSeconds,
+		SuccessfulJobsHistoryLimit: settings.SuccessfulJobsHistoryLimit,
+		FailedJobsHistoryLimit:     settings.FailedJobsHistoryLimit,
+		Suspend:                    settings.Suspend,
+		JobTemplate: batchv1.JobTemplateSpec{
+			// Labelled so the jobs it starts can be found, they are owned by the cron job rather than the app bundle
+			ObjectMeta: metav1.ObjectMeta{Labels: SetDefaultAppBundleLabels(ab, nil)},
+			Spec:       *jobSpec,
+		},
+	}
+	if settings.ConcurrencyPolicy != nil {
+		cronJob.Spec.ConcurrencyPolicy = *settings.ConcurrencyPolicy
+	}
+
+	return cronJob, nil
+}
+
+// ReconcileJob applies the job of the app bundle. The job is run again whenever it changes, as it is then created anew.
+func (r *AppBundleReconciler) ReconcileJob(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	// LOCK APPBUNDLE JOB MUTEX
+	mu := getMutex("job", ab.Name, ab.Namespace)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// GET EXPECTED JOB
+	cfg, err := r.GetAtrokConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	expectedJob, err := CreateExpectedJob(ab, cfg)
+	if err != nil {
+		return err
+	}
+
+	// APPLY EXPECTED JOB
+	if _, err := r.ApplyResource(ctx, ab, expectedJob, false); err != nil {
+		return err
+	}
+
+	return r.ReportJobStatus(ctx, ab)
+}
+
+// ReconcileCronJob applies the cron job of the app bundle.
+func (r *AppBundleReconciler) ReconcileCronJob(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	// LOCK APPBUNDLE CRONJOB MUTEX
+	mu := getMutex("cronjob", ab.Name, ab.Namespace)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// GET EXPECTED CRONJOB
+	cfg, err := r.GetAtrokConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	expectedCronJob, err := CreateExpectedCronJob(ab, cfg)
+	if err != nil {
+		return err
+	}
+
+	// APPLY EXPECTED CRONJOB
+	if _, err := r.ApplyResource(ctx, ab, expectedCronJob, false); err != nil {
+		return err
+	}
+
+	return r.ReportCronJobStatus(ctx, ab)
+}
+
+// ReportJobStatus sets the WorkloadAvailable condition, the last run and the job resource status on the app bundle.
+func (r *AppBundleReconciler) ReportJobStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, GetAppBundleNamespacedName(ab), job); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		// Just created and not yet visible
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, false, atroxyzv1alpha1.ReasonProgressing, "Job is being created")
+		return nil
+	}
+
+	run := GetJobRun(job)
+	ab.Status.LastRun = &run
+
+	healthy, reason, message := false, atroxyzv1alpha1.ReasonProgressing, "Job is running"
+	switch run.Result {
+	case atroxyzv1alpha1.RunResultSucceeded:
+		healthy, reason, message = true, atroxyzv1alpha1.ReasonCompleted, "Job succeeded"
+	case atroxyzv1alpha1.RunResultFailed:
+		reason, message = atroxyzv1alpha1.ReasonFailed, "Job failed: "+run.Message
+	}
+
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, healthy, reason, message)
+	SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+		Kind:      "Job",
+		Name:      job.Name,
+		Namespace: job.Namespace,
+		Healthy:   healthy,
+		Message:   message,
+	})
+
+	return nil
+}
+
+// ReportCronJobStatus sets the WorkloadAvailable condition, the last run and the cron job resource status on the app bundle.
+// A cron job is healthy as long as the job it started last did not fail.
+func (r *AppBundleReconciler) ReportCronJobStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	cronJob := &batchv1.CronJob{}
+	if err := r.Get(ctx, GetAppBundleNamespacedName(ab), cronJob); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		// Just created and not yet visible
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, false, atroxyzv1alpha1.ReasonProgressing, "CronJob is being created")
+		return nil
+	}
+	ab.Status.LastScheduleTime = cronJob.Status.LastScheduleTime
+
+	// FIND THE LATEST JOB IT STARTED
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(ab.Namespace), client.MatchingLabels{AppBundleSelector: ab.Name}); err != nil {
+		return err
+	}
+
+	var latest *batchv1.Job
+	for i, job := range jobs.Items {
+		if !metav1.IsControlledBy(&job, cronJob) {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&job.CreationTimestamp) {
+			latest = &jobs.Items[i]
+		}
+	}
+
+	healthy, reason, message := true, atroxyzv1alpha1.ReasonAvailable, "Waiting for the first scheduled run"
+	if latest != nil {
+		run := GetJobRun(latest)
+		ab.Status.LastRun = &run
+
+		message = fmt.Sprintf("Last run %s %s", run.JobName, run.Result)
+		if run.Result == atroxyzv1alpha1.RunResultFailed {
+			healthy, reason, message = false, atroxyzv1alpha1.ReasonFailed, fmt.Sprintf("Last run %s failed: %s", run.JobName, run.Message)
+		}
+	}
+	if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+		message += ", suspended"
+	}
+
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, healthy, reason, message)
+	SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+		Kind:      "CronJob",
+		Name:      cronJob.Name,
+		Namespace: cronJob.Namespace,
+		Healthy:   healthy,
+		Message:   message,
+	})
+
+	return nil
+}
+
+// GetJobRun describes the run of the job from its conditions, it is running until it either completed or failed.
+func GetJobRun(job *batchv1.Job) atroxyzv1alpha1.AppBundleRunStatus {
+	run := atroxyzv1alpha1.AppBundleRunStatus{
+		JobName:        job.Name,
+		Result:         atroxyzv1alpha1.RunResultRunning,
+		StartTime:      job.Status.StartTime,
+		CompletionTime: job.Status.CompletionTime,
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			run.Result = atroxyzv1alpha1.RunResultSucceeded
+		case batchv1.JobFailed:
+			run.Result = atroxyzv1alpha1.RunResultFailed
+			run.Message = condition.Message
+		}
+	}
+
+	return run
+}
@@ -0,0 +1,214 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle running as a CronJob", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		kind := atroxyzv1alpha1.WorkloadKindCronJob
+		schedule := "0 3 * * *"
+		concurrencyPolicy := batchv1.ForbidConcurrent
+		historyLimit := int32(1)
+		backoffLimit := int32(2)
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{
+			Kind: &kind,
+			CronJob: &atroxyzv1alpha1.AppBundleCronJob{
+				Schedule:                   &schedule,
+				ConcurrencyPolicy:          &concurrencyPolicy,
+				SuccessfulJobsHistoryLimit: &historyLimit,
+			},
+			Job: &atroxyzv1alpha1.AppBundleJob{BackoffLimit: &backoffLimit},
+		}
+		ab.Spec.Envs = map[string]string{"TARGET": "s3://backups"}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should make a cron job running the app bundle container on the schedule", func() {
+		cronJob := &batchv1.CronJob{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), cronJob)).To(Succeed())
+
+		Expect(cronJob.Spec.Schedule).To(Equal("0 3 * * *"))
+		Expect(cronJob.Spec.ConcurrencyPolicy).To(Equal(batchv1.ForbidConcurrent))
+		Expect(*cronJob.Spec.SuccessfulJobsHistoryLimit).To(Equal(int32(1)))
+		Expect(*cronJob.Spec.JobTemplate.Spec.BackoffLimit).To(Equal(int32(2)))
+		Expect(cronJob.Spec.JobTemplate.Labels).To(HaveKeyWithValue(AppBundleSelector, ab.Name))
+
+		podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+		Expect(podSpec.RestartPolicy).To(Equal(corev1.RestartPolicyOnFailure))
+		Expect(podSpec.Containers[0].Image).To(Equal(*ab.Spec.Image.Repository + ":" + *ab.Spec.Image.Tag))
+		Expect(podSpec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "TARGET", Value: "s3://backups"}))
+	})
+
+	It("Should report the cron job as available before its first run", func() {
+		Expect(ab.Status.LastRun).To(BeNil())
+
+		condition := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionWorkloadAvailable)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("Should report the result of the last run", func() {
+		cronJob := &batchv1.CronJob{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), cronJob)).To(Succeed())
+
+		By("Having the cron job start a job that fails")
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ab.Name + "-29000000",
+				Namespace: ab.Namespace,
+				Labels:    cronJob.Spec.JobTemplate.Labels,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(cronJob, batchv1.SchemeGroupVersion.WithKind("CronJob")),
+				},
+			},
+			Spec: cronJob.Spec.JobTemplate.Spec,
+		}
+		Expect(rec.Create(ctx, job)).To(Succeed())
+
+		now := metav1.Now()
+		job.Status.StartTime = &now
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobFailureTarget, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonBackoffLimitExceeded, Message: "Job has reached the specified backoff limit"},
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonBackoffLimitExceeded, Message: "Job has reached the specified backoff limit"},
+		}
+		Expect(rec.Status().Update(ctx, job)).To(Succeed())
+
+		By("Reconciling again")
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+
+		Expect(ab.Status.LastRun).NotTo(BeNil())
+		Expect(ab.Status.LastRun.JobName).To(Equal(job.Name))
+		Expect(ab.Status.LastRun.Result).To(Equal(atroxyzv1alpha1.RunResultFailed))
+
+		condition := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionWorkloadAvailable)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(atroxyzv1alpha1.ReasonFailed))
+	})
+
+	It("Should prune the deployment once switched to a cron job", func() {
+		By("Running it as a deployment first")
+		deploymentKind := atroxyzv1alpha1.WorkloadKindDeployment
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Kind: &deploymentKind}
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+
+		By("Switching back to a cron job")
+		cronJobKind := atroxyzv1alpha1.WorkloadKindCronJob
+		schedule := "@hourly"
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Kind: &cronJobKind, CronJob: &atroxyzv1alpha1.AppBundleCronJob{Schedule: &schedule}}
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+		Expect(rec.PruneResources(ctx, ab)).To(Succeed())
+
+		deployment := &appsv1.Deployment{}
+		err := rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Correctly populated AppBundle running as a Job", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		kind := atroxyzv1alpha1.WorkloadKindJob
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Kind: &kind}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should report the job as running until it completes", func() {
+		job := &batchv1.Job{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), job)).To(Succeed())
+
+		Expect(ab.Status.LastRun).NotTo(BeNil())
+		Expect(ab.Status.LastRun.Result).To(Equal(atroxyzv1alpha1.RunResultRunning))
+
+		By("Having the job complete")
+		now := metav1.Now()
+		job.Status.StartTime = &now
+		job.Status.CompletionTime = &now
+		job.Status.Succeeded = 1
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobSuccessCriteriaMet, Status: corev1.ConditionTrue},
+			{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+		}
+		Expect(rec.Status().Update(ctx, job)).To(Succeed())
+
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+		Expect(ab.Status.LastRun.Result).To(Equal(atroxyzv1alpha1.RunResultSucceeded))
+
+		condition := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionWorkloadAvailable)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(atroxyzv1alpha1.ReasonCompleted))
+	})
+
+	It("Should run the job again once its container changes", func() {
+		job := &batchv1.Job{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), job)).To(Succeed())
+		firstUID := job.UID
+
+		tag := "v2"
+		ab.Spec.Image.Tag = &tag
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+
+		Eventually(func() bool {
+			job := &batchv1.Job{}
+			if err := rec.Get(ctx, GetAppBundleNamespacedName(ab), job); err != nil {
+				return false
+			}
+			return job.UID != firstUID && job.Spec.Template.Spec.Containers[0].Image == *ab.Spec.Image.Repository+":v2"
+		}).Should(BeTrue())
+	})
+
+	It("Should make the job from the same container as a deployment", func() {
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		job, err := CreateExpectedJob(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+		deployment, err := CreateExpectedDeployment(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(job.Spec.Template.Spec.Containers).To(Equal(deployment.Spec.Template.Spec.Containers))
+		Expect(job.Spec.Template.Spec.Affinity).To(BeNil())
+	})
+
+})
@@ -6,83 +6,68 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 	longhornv1beta2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
-	rxhash "github.com/rxwycdh/rxhash"
 )
 
-func (r *AppBundleReconciler) ReconcileRecurringBackupJob(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
-	if ab.Spec.Backup == nil {
-		return nil
-	}
-
-	if ab.Spec.Volumes == nil || len(ab.Spec.Volumes) == 0 {
-		return nil
-	}
+// LonghornNamespace is where longhorn and its recurring jobs live.
+const LonghornNamespace = "longhorn-system"
 
-	reccuringJobName := fmt.Sprintf("%s-%s", ab.Name, ab.Namespace)
+// GetRecurringJobName returns the name of the longhorn recurring job backing up the volumes of the app bundle.
+// It includes the namespace as the job lives in LonghornNamespace alongside those of every other app bundle.
+func GetRecurringJobName(ab *atroxyzv1alpha1.AppBundle) string {
+	return fmt.Sprintf("%s-%s", ab.Name, ab.Namespace)
+}
 
-	// GET the resource
-	// Can't use app bundle as owner reference because it would be instantly GC'd as it's in a different namespace
-	recurringJob := &longhornv1beta2.RecurringJob{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      reccuringJobName,
-			Namespace: "longhorn-system",
-		},
+// ReconcileRecurringBackupJob applies the longhorn recurring job backing up the volumes of the app bundle, deleting it once backups are turned off.
+func (r *AppBundleReconciler) ReconcileRecurringBackupJob(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	if ab.Spec.Backup == nil || len(ab.Spec.Volumes) == 0 {
+		return r.DeleteRecurringBackupJob(ctx, ab, "backups are turned off")
 	}
 
-	er := r.Get(ctx, client.ObjectKeyFromObject(recurringJob), recurringJob)
-
-	if er != nil && !errors.IsNotFound(er) {
-		return er
-	}
+	reccuringJobName := GetRecurringJobName(ab)
 
-	rjBeforeHash, err := rxhash.HashStruct(recurringJob.Spec)
-	if err != nil {
+	// GET the resource, only to keep its owner while the claim is not bound yet
+	// Can't use app bundle as owner reference because it would be instantly GC'd as it's in a different namespace
+	currentRecurringJob := &longhornv1beta2.RecurringJob{}
+	if err := r.Get(ctx, client.ObjectKey{Name: reccuringJobName, Namespace: LonghornNamespace}, currentRecurringJob); err != nil && !errors.IsNotFound(err) {
 		return err
 	}
 
 	// Recurring JOB
-	recurringJob.Spec = longhornv1beta2.RecurringJobSpec{
-		Name:        reccuringJobName,
-		Groups:      []string{},
-		Task:        longhornv1beta2.RecurringJobTypeBackup,
-		Cron:        *ab.Spec.Backup.Frequency,
-		Retain:      *ab.Spec.Backup.Retain,
-		Concurrency: 1,
+	recurringJob := &longhornv1beta2.RecurringJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            reccuringJobName,
+			Namespace:       LonghornNamespace,
+			OwnerReferences: currentRecurringJob.OwnerReferences,
+		},
+		Spec: longhornv1beta2.RecurringJobSpec{
+			Name:        reccuringJobName,
+			Groups:      []string{},
+			Task:        longhornv1beta2.RecurringJobTypeBackup,
+			Cron:        *ab.Spec.Backup.Frequency,
+			Retain:      *ab.Spec.Backup.Retain,
+			Concurrency: 1,
+			Labels:      SetDefaultAppBundleLabels(ab, nil),
+		},
 	}
-	recurringJob.Spec.Labels = SetDefaultAppBundleLabels(ab, nil)
-
-	pvc := &corev1.PersistentVolumeClaim{}
-	volumeKeys := getSortedKeys(ab.Spec.Volumes)
-	for _, key := range volumeKeys {
-		abVol := ab.Spec.Volumes[key]
-
-		if abVol.HostPath != nil {
-			continue
-		}
-
-		if abVol.EmptyDir != nil {
-			continue
-		}
-
-		volName := ab.Name + "-" + key
-		if abVol.ExistingClaim != nil {
-			volName = *abVol.ExistingClaim
-		}
-
-		// GET pvc so we can get underlying volume name
-		pvc = &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: volName, Namespace: ab.Namespace}}
 
+	for _, claimName := range GetClaimNames(ab) {
+		// GET pvc so we can get underlying volume name, claims of a stateful set only appear once its replicas do
+		pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: claimName, Namespace: ab.Namespace}}
 		if err := r.Get(ctx, client.ObjectKeyFromObject(pvc), pvc); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
 			return err
 		}
 
 		if pvc.Status.Phase == corev1.ClaimBound {
-			vol := &longhornv1beta2.Volume{ObjectMeta: metav1.ObjectMeta{Name: pvc.Spec.VolumeName, Namespace: "longhorn-system"}}
+			vol := &longhornv1beta2.Volume{ObjectMeta: metav1.ObjectMeta{Name: pvc.Spec.VolumeName, Namespace: LonghornNamespace}}
 			if err := r.Get(ctx, client.ObjectKeyFromObject(vol), vol); err != nil {
 				return err
 			}
@@ -91,19 +76,22 @@ func (r *AppBundleReconciler) ReconcileRecurringBackupJob(ctx context.Context, a
 		}
 	}
 
-	rjAfterHash, err := rxhash.HashStruct(recurringJob.Spec)
-	if err != nil {
-		return err
-	}
-
-	if rjBeforeHash == rjAfterHash {
-		return nil
-	}
+	// APPLY the resource
+	_, err := r.ApplyResource(ctx, ab, recurringJob, false)
+	return err
+}
 
-	// UPSERT the resource
-	if err := UpsertResource(ctx, r, recurringJob, "", er, false); err != nil {
+// DeleteRecurringBackupJob deletes the longhorn recurring job of the app bundle if there is one.
+// As it lives in another namespace it can not be owned by the app bundle, so it has to be deleted explicitly.
+func (r *AppBundleReconciler) DeleteRecurringBackupJob(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, reason string) error {
+	recurringJob := &longhornv1beta2.RecurringJob{}
+	if err := r.Get(ctx, client.ObjectKey{Name: GetRecurringJobName(ab), Namespace: LonghornNamespace}, recurringJob); err != nil {
+		// Without longhorn installed there is nothing to clean up
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return nil
+		}
 		return err
 	}
 
-	return nil
+	return r.DeleteResource(ctx, ab, recurringJob, reason)
 }
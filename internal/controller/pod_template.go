@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// CopyOverContainerPrefix prefixes the name of the init containers copying a config over to where it is expected, followed by the key of the config.
+const CopyOverContainerPrefix = "copy-over-"
+
+// GetSelectorLabels returns the labels selecting the pods of the app bundle, those of its workload and service alike.
+func GetSelectorLabels(ab *atroxyzv1alpha1.AppBundle) map[string]string {
+	return map[string]string{AppBundleSelector: ab.Name}
+}
+
+// CreateExpectedPodTemplate creates the pod template shared by every kind of workload from the appbundle.
+// Generated claims are mounted by name, workloads making claims of their own (e.g. a stateful set) swap those volumes out.
+func CreateExpectedPodTemplate(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (*corev1.PodTemplateSpec, error) {
+	// Ports
+	var ports []corev1.ContainerPort
+	for _, key := range getSortedKeys(ab.Spec.Routes) {
+		route := ab.Spec.Routes[key]
+		if route.Port == nil {
+			return nil, fmt.Errorf("route %s has no port", key)
+		}
+		ports = append(ports, corev1.ContainerPort{Name: key, ContainerPort: int32(*route.Port), Protocol: "TCP"})
+	}
+
+	// Volume Mounts
+	var volumeMounts []corev1.VolumeMount
+	volumeKeys := getSortedKeys(ab.Spec.Volumes)
+	for _, key := range volumeKeys {
+		volumeMount, err := GetVolumeMount(ab, key)
+		if err != nil {
+			return nil, err
+		}
+		volumeMounts = append(volumeMounts, *volumeMount)
+	}
+
+	// Volumes
+	var volumes []corev1.Volume
+	for _, key := range volumeKeys {
+		// If PVC we control then we get name from volume name, for hostPath we do the same.
+		name := key
+		volName := ab.Name + "-" + key
+		volume := ab.Spec.Volumes[key]
+
+		// If existing PVC then we get name from existing claim
+		if volume.ExistingClaim != nil {
+			name = *volume.ExistingClaim
+			volName = *volume.ExistingClaim
+		}
+
+		if volume.HostPath != nil {
+			pathType := corev1.HostPathDirectoryOrCreate
+			hostPath := corev1.HostPathVolumeSource{
+				Path: *volume.HostPath,
+				Type: &pathType,
+			}
+			volumes = append(volumes, corev1.Volume{
+				Name:         name,
+				VolumeSource: corev1.VolumeSource{HostPath: &hostPath},
+			})
+		} else if volume.EmptyDir != nil && *volume.EmptyDir {
+			volumes = append(volumes, corev1.Volume{
+				Name:         name,
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			})
+		} else {
+			volumes = append(volumes, corev1.Volume{
+				Name:         name,
+				VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: volName}},
+			})
+		}
+	}
+	initContainers := make([]corev1.Container, 0)
+
+	// Attach Configs
+	if ab.Spec.Configs != nil {
+		configs := ab.Spec.Configs
+		for _, key := range getSortedKeys(configs) {
+			config := configs[key]
+			volumeName := GetConfigVolumeName(ab, key)
+
+			volumeSource := corev1.VolumeSource{}
+
+			if config.Existing != nil {
+				volumeSource = corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: *config.Existing},
+						Items:                []corev1.KeyToPath{{Key: key, Path: config.FileName}},
+					},
+				}
+			} else {
+				if len(config.Secrets) == 0 {
+					volumeSource = corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: ab.Name},
+							Items:                []corev1.KeyToPath{{Key: key, Path: config.FileName}},
+						},
+					}
+				} else {
+					volumeSource = corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: ab.Name,
+							Items:      []corev1.KeyToPath{{Key: "cfg" + key, Path: config.FileName}},
+						},
+					}
+				}
+			}
+
+			volumes = append(volumes, corev1.Volume{
+				Name:         volumeName,
+				VolumeSource: volumeSource,
+			})
+			mountPath := config.DirPath + "/" + config.FileName
+
+			if config.CopyOver != nil && *config.CopyOver {
+				tempMountPath := "/atrok" + config.DirPath + "/" + config.FileName
+				initVolumeMounts := append(volumeMounts, corev1.VolumeMount{
+					Name:      volumeName,
+					MountPath: tempMountPath,
+					SubPath:   config.FileName,
+					ReadOnly:  true,
+				},
+				)
+
+				initContainers = append(initContainers, corev1.Container{
+					Name:  CopyOverContainerPrefix + key,
+					Image: "busybox:stable",
+					Command: []string{
+						"sh", "-c", // Use a shell to run multiple commands
+						"cp " + tempMountPath + " " + mountPath + " && chmod 777 " + mountPath,
+					},
+					VolumeMounts: initVolumeMounts,
+				})
+			} else {
+				volumeMounts = append(volumeMounts, GetConfigVolumeMount(ab, key))
+			}
+		}
+	}
+
+	resources := corev1.ResourceRequirements{}
+	if ab.Spec.Resources != nil {
+		resources = *ab.Spec.Resources
+	}
+
+	if ab.Spec.Image == nil || ab.Spec.Image.Repository == nil || ab.Spec.Image.Tag == nil {
+		return nil, fmt.Errorf("app bundle %s has no image repository or tag", ab.Name)
+	}
+	repository := *ab.Spec.Image.Repository
+	tag := *ab.Spec.Image.Tag
+	env, err := GetContainerEnv(ab, ab.Spec.Envs, ab.Spec.SourcedEnvs)
+	if err != nil {
+		return nil, err
+	}
+
+	imagePullPolicy := corev1.PullAlways
+	if ab.Spec.Image.PullPolicy != nil {
+		imagePullPolicy = *ab.Spec.Image.PullPolicy
+	}
+
+	container := corev1.Container{
+		Name:            ab.Name,
+		Image:           fmt.Sprintf("%s:%s", repository, tag),
+		ImagePullPolicy: imagePullPolicy,
+		Resources:       resources,
+		Ports:           ports,
+		Env:             env,
+		VolumeMounts:    volumeMounts,
+		LivenessProbe:   ab.Spec.LivenessProbe,
+		ReadinessProbe:  ab.Spec.ReadinessProbe,
+		StartupProbe:    ab.Spec.StartupProbe,
+	}
+
+	if ab.Spec.Command != nil {
+		container.Command = []string{}
+
+		for _, command := range ab.Spec.Command {
+			container.Command = append(container.Command, *command)
+		}
+	}
+
+	if ab.Spec.Args != nil {
+		container.Args = []string{}
+
+		for _, arg := range ab.Spec.Args {
+			container.Args = append(container.Args, *arg)
+		}
+	}
+
+	// Run after the configs are copied over, so they find them in place
+	userInitContainers, err := CreateExpectedInitContainers(ab, &container)
+	if err != nil {
+		return nil, err
+	}
+	initContainers = append(initContainers, userInitContainers...)
+
+	template := &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: GetSelectorLabels(ab),
+		},
+		Spec: corev1.PodSpec{
+			Volumes:          volumes,
+			ImagePullSecrets: GetImagePullSecrets(ab, cfg),
+			InitContainers:   initContainers,
+			Containers:       []corev1.Container{container},
+		},
+	}
+
+	sidecars, err := CreateExpectedSidecars(ab)
+	if err != nil {
+		return nil, err
+	}
+	template.Spec.Containers = append(template.Spec.Containers, sidecars...)
+
+	SetPodScheduling(ab, &template.Spec)
+
+	SetServiceAccount(ab, &template.Spec)
+
+	SetAccelerators(ab, cfg, &template.Spec)
+
+	SetSecurityContexts(ab, &template.Spec)
+
+	return template, nil
+}
+
+// GetVolumeMount returns the mount of the volume of the app bundle under the given key, those of the container of the app bundle and of its sidecars alike.
+func GetVolumeMount(ab *atroxyzv1alpha1.AppBundle, key string) (*corev1.VolumeMount, error) {
+	volume, ok := ab.Spec.Volumes[key]
+	if !ok {
+		return nil, fmt.Errorf("volume %s does not exist", key)
+	}
+	if volume.Path == nil {
+		return nil, fmt.Errorf("volume %s has no path", key)
+	}
+
+	// Existing claims are mounted under the name of the claim
+	volumeName := key
+	if volume.ExistingClaim != nil {
+		volumeName = *volume.ExistingClaim
+	}
+
+	return &corev1.VolumeMount{Name: volumeName, MountPath: *volume.Path}, nil
+}
+
+// GetConfigVolumeName returns the name of the volume the config of the app bundle under the given key is mounted from,
+// a secret rather than a config map once secrets are templated into it.
+func GetConfigVolumeName(ab *atroxyzv1alpha1.AppBundle, key string) string {
+	config := ab.Spec.Configs[key]
+	if config.Existing == nil && len(config.Secrets) != 0 {
+		return "sec-" + key
+	}
+	return "cm-" + key
+}
+
+// GetConfigVolumeMount returns the read only mount of the config of the app bundle under the given key as a single file.
+func GetConfigVolumeMount(ab *atroxyzv1alpha1.AppBundle, key string) corev1.VolumeMount {
+	config := ab.Spec.Configs[key]
+	return corev1.VolumeMount{
+		Name:      GetConfigVolumeName(ab, key),
+		MountPath: config.DirPath + "/" + config.FileName,
+		SubPath:   config.FileName,
+		ReadOnly:  true,
+	}
+}
+
+// GetContainerEnv returns the env of a container of the app bundle made of the plain and sourced envs given, sorted by name.
+// Envs sourced from external secrets are read from the secret of the app bundle.
+func GetContainerEnv(ab *atroxyzv1alpha1.AppBundle, envs map[string]string, sourcedEnvs map[string]atroxyzv1alpha1.AppBundleSourcedEnv) ([]corev1.EnvVar, error) {
+	env := []corev1.EnvVar{}
+
+	// Have to sort keys otherwise get infinite loop of updating
+	for _, key := range getSortedKeys(envs) {
+		env = append(env, corev1.EnvVar{Name: key, Value: envs[key]})
+	}
+
+	for _, key := range getSortedKeys(sourcedEnvs) {
+		sourcedEnv := sourcedEnvs[key]
+		envVarSource := corev1.EnvVarSource{}
+		if sourcedEnv.Secret != "" {
+			envVarSource.SecretKeyRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: sourcedEnv.Secret},
+				Key:                  sourcedEnv.Key,
+			}
+		} else if sourcedEnv.ConfigMap != "" {
+			envVarSource.ConfigMapKeyRef = &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: sourcedEnv.ConfigMap},
+				Key:                  sourcedEnv.Key,
+			}
+		} else if sourcedEnv.ExternalSecret != "" {
+			envVarSource.SecretKeyRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: ab.Name},
+				Key:                  "env" + key,
+			}
+		} else {
+			return nil, fmt.Errorf("SourcedEnv %s has neither Secret nor ConfigMap", key)
+		}
+
+		env = append(env, corev1.EnvVar{Name: key, ValueFrom: &envVarSource})
+	}
+
+	return env, nil
+}
+
+// GetImagePullSecrets returns the image pull secrets of the pods of the app bundle.
+// Those of its image, the one generated from its registry credentials included, replace those of the config.
+func GetImagePullSecrets(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) []corev1.LocalObjectReference {
+	image := ab.Spec.Image
+	if image == nil || (len(image.PullSecrets) == 0 && image.Registry == nil) {
+		return cfg.GetImagePullSecrets()
+	}
+
+	pullSecrets := []corev1.LocalObjectReference{}
+	for _, name := range image.PullSecrets {
+		pullSecrets = append(pullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+	if image.Registry != nil {
+		pullSecrets = append(pullSecrets, corev1.LocalObjectReference{Name: GetRegistrySecretName(ab)})
+	}
+
+	return pullSecrets
+}
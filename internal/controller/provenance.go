@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	"github.com/rxwycdh/rxhash"
+)
+
+// Sources recorded in the provenance of fields that did not come from a base.
+const (
+	// ProvenanceSelf marks fields set on the app bundle itself.
+	ProvenanceSelf = "self"
+	// ProvenanceDefault marks fields filled in by the defaults.
+	ProvenanceDefault = "default"
+)
+
+// RecordProvenance attributes every field set in spec to source, unless an earlier (i.e. nearer) source already set it.
+// Maps are attributed per key, e.g. "envs[TZ]", everything else per top level field, e.g. "image".
+// Does nothing unless the provenance of the app bundle has been initialised, so resolving a base outside of a reconcile records nothing.
+func RecordProvenance(ab *atroxyzv1alpha1.AppBundle, spec *atroxyzv1alpha1.AppBundleSpec, source string) {
+	if ab.Status.Provenance == nil || spec == nil {
+		return
+	}
+
+	for _, path := range getProvenancePaths(spec) {
+		if _, ok := ab.Status.Provenance[path]; !ok {
+			ab.Status.Provenance[path] = source
+		}
+	}
+}
+
+// PruneProvenance drops the provenance of fields no longer set in the spec, e.g. map entries deleted or replaced by a nearer spec.
+func PruneProvenance(ab *atroxyzv1alpha1.AppBundle) {
+	if ab.Status.Provenance == nil {
+		return
+	}
+
+	paths := getProvenancePaths(&ab.Spec)
+	for path := range ab.Status.Provenance {
+		if !slices.Contains(paths, path) {
+			delete(ab.Status.Provenance, path)
+		}
+	}
+}
+
+// getProvenancePaths returns the paths of every field set in the spec as used in the provenance.
+func getProvenancePaths(spec *atroxyzv1alpha1.AppBundleSpec) []string {
+	paths := []string{}
+	value := reflect.ValueOf(*spec)
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		field := value.Field(i)
+
+		// The base and merge section are how the chain is built, not something it contributes
+		if name == "base" || name == "merge" || field.IsZero() {
+			continue
+		}
+
+		if field.Kind() == reflect.Pointer && field.Elem().Kind() == reflect.Map {
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Map && field.Type().Key().Kind() == reflect.String {
+			for _, key := range field.MapKeys() {
+				paths = append(paths, fmt.Sprintf("%s[%s]", name, key.String()))
+			}
+			continue
+		}
+
+		paths = append(paths, name)
+	}
+
+	return paths
+}
+
+// SetEffectiveSpecHash records the hash of the spec the resources are built from, so a change coming from any base in the chain is visible on the app bundle.
+func SetEffectiveSpecHash(ab *atroxyzv1alpha1.AppBundle) error {
+	hash, err := rxhash.HashStruct(ab.Spec)
+	if err != nil {
+		return err
+	}
+
+	ab.Status.EffectiveSpecHash = hash
+	return nil
+}
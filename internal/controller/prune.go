@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	extsec "github.com/external-secrets/external-secrets/apis/externalsecrets/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// GetManagedResourceLists returns an empty list for every namespaced kind atrok generates for app bundles, those the prune pass looks through.
+func GetManagedResourceLists() []client.ObjectList {
+	return []client.ObjectList{
+		&appsv1.DeploymentList{},
+		&appsv1.StatefulSetList{},
+		&appsv1.DaemonSetList{},
+		&batchv1.JobList{},
+		&batchv1.CronJobList{},
+		&corev1.ServiceList{},
+		&netv1.IngressList{},
+		&corev1.ConfigMapList{},
+		&corev1.PersistentVolumeClaimList{},
+		&extsec.ExternalSecretList{},
+		&corev1.ServiceAccountList{},
+		&rbacv1.RoleList{},
+		&rbacv1.RoleBindingList{},
+	}
+}
+
+// GetExpectedResourceNames returns the names of the resources the spec of the app bundle produces, keyed by kind.
+func GetExpectedResourceNames(ab *atroxyzv1alpha1.AppBundle) (map[string][]string, error) {
+	expected := map[string][]string{string(ab.Spec.GetWorkloadKind()): {ab.Name}}
+
+	if ab.Spec.Routes != nil {
+		expected["Service"] = []string{ab.Name}
+	}
+	if ab.Spec.GetWorkloadKind() == atroxyzv1alpha1.WorkloadKindStatefulSet {
+		expected["Service"] = append(expected["Service"], GetHeadlessServiceName(ab))
+	}
+	for _, key := range getSortedKeys(ab.Spec.Routes) {
+		if ab.Spec.Routes[key].Ingress != nil {
+			expected["Ingress"] = append(expected["Ingress"], ab.Name+"-"+key)
+		}
+	}
+
+	// Claims a deployment used are kept under a stateful set too so switching kinds never loses data,
+	// those the stateful set makes itself are not owned by the app bundle and so never pruned either
+	for _, key := range getSortedKeys(ab.Spec.Volumes) {
+		volume := ab.Spec.Volumes[key]
+		if IsGeneratedClaim(&volume) {
+			expected["PersistentVolumeClaim"] = append(expected["PersistentVolumeClaim"], ab.Name+"-"+key)
+		}
+	}
+
+	cm, err := CreateExpectedConfigMap(ab)
+	if err != nil {
+		return nil, err
+	}
+	if cm != nil {
+		expected["ConfigMap"] = []string{cm.Name}
+	}
+
+	externalSecrets, err := CreateExpectedExternalSecrets(ab)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range getSortedKeys(externalSecrets) {
+		if externalSecrets[name] != nil {
+			expected["ExternalSecret"] = append(expected["ExternalSecret"], name)
+		}
+	}
+
+	if sa := CreateExpectedServiceAccount(ab); sa != nil {
+		expected["ServiceAccount"] = []string{sa.Name}
+	}
+	if role := CreateExpectedRole(ab); role != nil {
+		expected["Role"] = []string{role.Name}
+	}
+	for _, roleBinding := range CreateExpectedRoleBindings(ab) {
+		expected["RoleBinding"] = append(expected["RoleBinding"], roleBinding.Name)
+	}
+	if clusterRole := CreateExpectedClusterRole(ab); clusterRole != nil {
+		expected["ClusterRole"] = []string{clusterRole.Name}
+	}
+	for _, clusterRoleBinding := range CreateExpectedClusterRoleBindings(ab) {
+		expected["ClusterRoleBinding"] = append(expected["ClusterRoleBinding"], clusterRoleBinding.Name)
+	}
+
+	return expected, nil
+}
+
+// PruneResources deletes the resources generated for the app bundle that its spec no longer produces, e.g. the claim of a volume that was removed or renamed.
+// Only resources carrying the app bundle label and owned by it are considered, so nothing created by anyone else is ever touched.
+// Claims marked with RetainAnnotation are released instead of deleted, keeping their data.
+func (r *AppBundleReconciler) PruneResources(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	expected, err := GetExpectedResourceNames(ab)
+	if err != nil {
+		return err
+	}
+
+	for _, list := range GetManagedResourceLists() {
+		if err := r.List(ctx, list, client.InNamespace(ab.Namespace), client.MatchingLabels{AppBundleSelector: ab.Name}); err != nil {
+			// The CRD of an optional kind (e.g. ExternalSecret) is not installed, so there is nothing of it to prune
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return err
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok || !IsOwnedBy(obj, ab) || contains(expected[GetKind(obj)], obj.GetName()) {
+				continue
+			}
+
+			if pvc, ok := obj.(*corev1.PersistentVolumeClaim); ok && pvc.Annotations[RetainAnnotation] == "true" {
+				if err := r.ReleasePVC(ctx, ab, pvc); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := r.DeleteResource(ctx, ab, obj, "the app bundle no longer produces it"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return r.DeleteClusterResources(ctx, ab, expected, "the app bundle no longer produces it")
+}
+
+// ReleasePVC hands a claim generated for the app bundle over to nobody in particular: the owner reference and the app bundle label are removed,
+// so it is neither garbage collected with the app bundle nor found by it again, along with atrok's field ownership so mounting it later as an existing claim starts afresh.
+func (r *AppBundleReconciler) ReleasePVC(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, pvc *corev1.PersistentVolumeClaim) error {
+	patch := client.MergeFrom(pvc.DeepCopy())
+
+	ownerReferences := []metav1.OwnerReference{}
+	for _, ref := range pvc.OwnerReferences {
+		if ref.UID != ab.UID {
+			ownerReferences = append(ownerReferences, ref)
+		}
+	}
+	pvc.OwnerReferences = ownerReferences
+	delete(pvc.Labels, AppBundleSelector)
+	delete(pvc.Annotations, RetainAnnotation)
+
+	managedFields := []metav1.ManagedFieldsEntry{}
+	for _, entry := range pvc.ManagedFields {
+		if entry.Manager != FieldManager {
+			managedFields = append(managedFields, entry)
+		}
+	}
+	if len(managedFields) == 0 {
+		// An empty list leaves the managed fields as they are, a single empty entry clears them
+		managedFields = []metav1.ManagedFieldsEntry{{}}
+	}
+	pvc.ManagedFields = managedFields
+
+	log.FromContext(ctx).Info("Releasing retained claim.", "name", pvc.Name)
+	if err := r.Patch(ctx, pvc, patch); err != nil {
+		r.RecordEvent(ab, pvc, corev1.EventTypeWarning, EventReasonUpdateFailed, "Release", "Failed to release PersistentVolumeClaim %s: %s", pvc.Name, err)
+		return err
+	}
+
+	r.RecordEvent(ab, pvc, corev1.EventTypeNormal, EventReasonReleased, "Release", "Released PersistentVolumeClaim %s as it is to be retained", pvc.Name)
+	return nil
+}
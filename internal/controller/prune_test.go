@@ -0,0 +1,88 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Pruning resources the AppBundle no longer produces", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	// Claims protected by the pvc-protection finalizer linger until nothing uses them, being deleted is good enough
+	expectGone := func(obj client.Object) {
+		err := rec.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		if err == nil {
+			Expect(obj.GetDeletionTimestamp()).NotTo(BeNil())
+			return
+		}
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	}
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		// CREATE APPBUNDLE WITH TWO CLAIMS AND A CONFIG
+		size := "1Gi"
+		path1 := "/data"
+		path2 := "/cache"
+		retain := true
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{
+			"data":  {Size: &size, Path: &path1, Retain: &retain},
+			"cache": {Size: &size, Path: &path2},
+		}
+		ab.Spec.Configs = map[string]atroxyzv1alpha1.AppBundleConfig{"config.yaml": {Content: "key: value"}}
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		Expect(rec.ReconcileVolumes(ctx, ab)).To(Succeed())
+		Expect(rec.ReconcileConfigMap(ctx, ab)).To(Succeed())
+	})
+
+	It("Should leave everything the spec produces alone", func() {
+		Expect(rec.PruneResources(ctx, ab)).To(Succeed())
+
+		for _, name := range []string{ab.Name + "-data", ab.Name + "-cache"} {
+			pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ab.Namespace}}
+			Expect(rec.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)).To(Succeed())
+			Expect(pvc.DeletionTimestamp).To(BeNil())
+		}
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(ab), &corev1.ConfigMap{})).To(Succeed())
+	})
+
+	It("Should delete the claim of a removed volume and the config map of removed configs", func() {
+		delete(ab.Spec.Volumes, "cache")
+		ab.Spec.Configs = nil
+		Expect(rec.PruneResources(ctx, ab)).To(Succeed())
+
+		expectGone(&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: ab.Name + "-cache", Namespace: ab.Namespace}})
+		expectGone(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ab.Name, Namespace: ab.Namespace}})
+	})
+
+	It("Should release a retained claim instead of deleting it", func() {
+		delete(ab.Spec.Volumes, "data")
+		Expect(rec.PruneResources(ctx, ab)).To(Succeed())
+
+		pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: ab.Name + "-data", Namespace: ab.Namespace}}
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)).To(Succeed())
+		Expect(pvc.DeletionTimestamp).To(BeNil())
+		Expect(IsOwnedBy(pvc, ab)).To(BeFalse())
+		Expect(pvc.Labels).NotTo(HaveKey(AppBundleSelector))
+		Expect(pvc.Annotations).NotTo(HaveKey(RetainAnnotation))
+	})
+})
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// GetPodAntiAffinity returns the pod anti-affinity keeping the replicas of the app bundle off the same node as strictly as its preset asks, nil for none.
+func GetPodAntiAffinity(ab *atroxyzv1alpha1.AppBundle) *corev1.PodAntiAffinity {
+	term := corev1.PodAffinityTerm{
+		TopologyKey: "kubernetes.io/hostname",
+		LabelSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{
+					Key:      AppBundleSelector,
+					Operator: metav1.LabelSelectorOpIn,
+					Values:   []string{ab.Name},
+				},
+			},
+		},
+	}
+
+	switch ab.Spec.GetAntiAffinity() {
+	case atroxyzv1alpha1.AntiAffinityRequired:
+		return &corev1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term}}
+	case atroxyzv1alpha1.AntiAffinityPreferred:
+		return &corev1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: term}}}
+	default:
+		return nil
+	}
+}
+
+// GetAffinity returns the affinity of the pods of the app bundle, the one set in its scheduling with the anti-affinity preset added.
+// The preset only applies to workloads with replicas, a daemon set has one pod per node already and a job only the one pod.
+func GetAffinity(ab *atroxyzv1alpha1.AppBundle) *corev1.Affinity {
+	affinity := &corev1.Affinity{}
+	if ab.Spec.Scheduling != nil && ab.Spec.Scheduling.Affinity != nil {
+		affinity = ab.Spec.Scheduling.Affinity.DeepCopy()
+	}
+
+	kind := ab.Spec.GetWorkloadKind()
+	if affinity.PodAntiAffinity == nil && (kind == atroxyzv1alpha1.WorkloadKindDeployment || kind == atroxyzv1alpha1.WorkloadKindStatefulSet) {
+		affinity.PodAntiAffinity = GetPodAntiAffinity(ab)
+	}
+
+	if *affinity == (corev1.Affinity{}) {
+		return nil
+	}
+	return affinity
+}
+
+// SetPodScheduling sets where the pods of the app bundle run on the pod spec, as asked for by the scheduling of the app bundle.
+func SetPodScheduling(ab *atroxyzv1alpha1.AppBundle, podSpec *corev1.PodSpec) {
+	podSpec.Affinity = GetAffinity(ab)
+
+	if ab.Spec.NodeSelector != nil {
+		podSpec.NodeSelector = *ab.Spec.NodeSelector
+	}
+
+	scheduling := ab.Spec.Scheduling
+	if scheduling == nil {
+		return
+	}
+
+	// Cloned as more tolerations may be added, e.g. those of the accelerator profiles
+	podSpec.Tolerations = slices.Clone(scheduling.Tolerations)
+
+	for _, constraint := range scheduling.TopologySpreadConstraints {
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = &metav1.LabelSelector{MatchLabels: GetSelectorLabels(ab)}
+		}
+		podSpec.TopologySpreadConstraints = append(podSpec.TopologySpreadConstraints, constraint)
+	}
+
+	if scheduling.PriorityClassName != nil {
+		podSpec.PriorityClassName = *scheduling.PriorityClassName
+	}
+	podSpec.RuntimeClassName = scheduling.RuntimeClassName
+}
@@ -0,0 +1,97 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle with scheduling", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		replicas := int32(3)
+		preferred := atroxyzv1alpha1.AntiAffinityPreferred
+		priorityClassName := "system-cluster-critical"
+		ab.Spec.Replicas = &replicas
+		ab.Spec.Scheduling = &atroxyzv1alpha1.AppBundleScheduling{
+			AntiAffinity: &preferred,
+			Tolerations:  []corev1.Toleration{{Key: "node-role.kubernetes.io/control-plane", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+			TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+				{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.ScheduleAnyway},
+			},
+			PriorityClassName: &priorityClassName,
+		}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should only prefer keeping the replicas off the same node", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		antiAffinity := deployment.Spec.Template.Spec.Affinity.PodAntiAffinity
+		Expect(antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution).To(BeEmpty())
+		Expect(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution).To(HaveLen(1))
+		Expect(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].PodAffinityTerm.TopologyKey).To(Equal("kubernetes.io/hostname"))
+	})
+
+	It("Should set the tolerations, spread and priority of the pods", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		podSpec := deployment.Spec.Template.Spec
+		Expect(podSpec.Tolerations).To(Equal(ab.Spec.Scheduling.Tolerations))
+		Expect(podSpec.PriorityClassName).To(Equal("system-cluster-critical"))
+
+		// The constraint spreads the pods of the app bundle as it does not say which pods to spread
+		Expect(podSpec.TopologySpreadConstraints).To(HaveLen(1))
+		Expect(podSpec.TopologySpreadConstraints[0].LabelSelector).To(Equal(&metav1.LabelSelector{MatchLabels: GetSelectorLabels(ab)}))
+	})
+
+	It("Should leave the anti-affinity out when asked for none", func() {
+		none := atroxyzv1alpha1.AntiAffinityNone
+		ab.Spec.Scheduling.AntiAffinity = &none
+		Expect(GetAffinity(ab)).To(BeNil())
+	})
+
+	It("Should keep the nvidia toleration next to those of the scheduling and a runtime class set there", func() {
+		useNvidia := true
+		runtimeClassName := "nvidia-cdi"
+		ab.Spec.UseNvidia = &useNvidia
+		ab.Spec.Scheduling.RuntimeClassName = &runtimeClassName
+
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		deployment, err := CreateExpectedDeployment(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		podSpec := deployment.Spec.Template.Spec
+		Expect(podSpec.Tolerations).To(HaveLen(2))
+		Expect(podSpec.Tolerations[1].Key).To(Equal("nvidia.com/gpu"))
+		Expect(*podSpec.RuntimeClassName).To(Equal("nvidia-cdi"))
+
+		// Building the pods never changes the app bundle itself
+		Expect(ab.Spec.Scheduling.Tolerations).To(HaveLen(1))
+	})
+})
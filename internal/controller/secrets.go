@@ -2,12 +2,14 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 	"github.com/atropos112/gocore/utils"
 	extsec "github.com/external-secrets/external-secrets/apis/externalsecrets/v1"
-	equality "k8s.io/apimachinery/pkg/api/equality"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -20,15 +22,16 @@ import (
 
 // CreateExpectedExternalSecret creates the expected external secret from the appbundle or returns nil if no secret is needed
 func CreateExpectedExternalSecret(ab *atroxyzv1alpha1.AppBundle) (*extsec.ExternalSecret, error) {
-	expectedExternalSecret := &extsec.ExternalSecret{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
-
 	// GATHERING ALL SECRETS NEEDED
 	// Key is secret key, value is the remote ref.
 	secretsToGet := make(map[string]string)
 
-	for key, value := range ab.Spec.SourcedEnvs {
-		if value.ExternalSecret != "" {
-			secretsToGet[key] = value.ExternalSecret
+	// Sidecars share the envs sourced from external secrets with the container of the app bundle, by key
+	for _, sourcedEnvs := range GetContainerSourcedEnvs(ab) {
+		for key, value := range sourcedEnvs {
+			if value.ExternalSecret != "" {
+				secretsToGet[key] = value.ExternalSecret
+			}
 		}
 	}
 
@@ -43,10 +46,60 @@ func CreateExpectedExternalSecret(ab *atroxyzv1alpha1.AppBundle) (*extsec.Extern
 		return nil, nil
 	}
 
+	templates := map[string]string{}
+	for _, sourcedEnvs := range GetContainerSourcedEnvs(ab) {
+		for _, key := range getSortedKeys(sourcedEnvs) {
+			if sourcedEnvs[key].ExternalSecret != "" {
+				templates["env"+key] = "{{ ." + key + " }}"
+			}
+		}
+	}
+
+	for key, cfg := range ab.Spec.Configs {
+		if len(cfg.Secrets) != 0 {
+			templates["cfg"+key] = cfg.Content
+		}
+	}
+
+	return newExternalSecret(ab, ab.Name, secretsToGet, templates, "")
+}
+
+// GetRegistrySecretName returns the name of the pull secret generated from the registry credentials of the appbundle, that of its external secret too.
+func GetRegistrySecretName(ab *atroxyzv1alpha1.AppBundle) string {
+	return ab.Name + "-registry"
+}
+
+// CreateExpectedRegistryExternalSecret creates the expected external secret generating the pull secret from the registry credentials of the appbundle, nil if it has none.
+func CreateExpectedRegistryExternalSecret(ab *atroxyzv1alpha1.AppBundle) (*extsec.ExternalSecret, error) {
+	if ab.Spec.Image == nil || ab.Spec.Image.Registry == nil {
+		return nil, nil
+	}
+	registry := ab.Spec.Image.Registry
+
+	server, err := json.Marshal(registry.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	secretsToGet := map[string]string{"username": registry.Username, "password": registry.Password}
+	templates := map[string]string{
+		corev1.DockerConfigJsonKey: `{"auths":{` + string(server) + `:{"username":{{ .username | toJson }},"password":{{ .password | toJson }},"auth":{{ printf "%s:%s" .username .password | b64enc | toJson }}}}}`,
+	}
+
+	return newExternalSecret(ab, GetRegistrySecretName(ab), secretsToGet, templates, corev1.SecretTypeDockerConfigJson)
+}
+
+// newExternalSecret creates an external secret of the appbundle fetching the secrets, keyed by secret key with their remote ref as value,
+// from the secret store of the appbundle into a secret of the same name and type built from the templates.
+func newExternalSecret(ab *atroxyzv1alpha1.AppBundle, name string, secretsToGet map[string]string, templates map[string]string, secretType corev1.SecretType) (*extsec.ExternalSecret, error) {
 	if ab.Spec.SecretStoreRef == nil {
 		return nil, &utils.DeveloperError{Message: "SecretStoreRef is nil"}
 	}
 
+	expectedExternalSecret := &extsec.ExternalSecret{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+	expectedExternalSecret.ObjectMeta.Name = name
+	expectedExternalSecret.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+
 	data := make([]extsec.ExternalSecretData, 0, len(secretsToGet))
 
 	for _, key := range getSortedKeys(secretsToGet) {
@@ -61,22 +114,10 @@ func CreateExpectedExternalSecret(ab *atroxyzv1alpha1.AppBundle) (*extsec.Extern
 		})
 	}
 
-	templates := map[string]string{}
-	for _, key := range getSortedKeys(ab.Spec.SourcedEnvs) {
-		if ab.Spec.SourcedEnvs[key].ExternalSecret != "" {
-			templates["env"+key] = "{{ ." + key + " }}"
-		}
-	}
-
-	for key, cfg := range ab.Spec.Configs {
-		if len(cfg.Secrets) != 0 {
-			templates["cfg"+key] = cfg.Content
-		}
-	}
-
 	target := extsec.ExternalSecretTarget{
-		Name: ab.Name,
+		Name: name,
 		Template: &extsec.ExternalSecretTemplate{
+			Type:          secretType,
 			EngineVersion: "v2",
 			Data:          templates,
 			MergePolicy:   extsec.MergePolicyReplace,
@@ -99,30 +140,58 @@ func CreateExpectedExternalSecret(ab *atroxyzv1alpha1.AppBundle) (*extsec.Extern
 	return expectedExternalSecret, nil
 }
 
-// ReconcileExternalSecret reconciles the service for the appbundle
+// CreateExpectedExternalSecrets creates all the external secrets expected for the appbundle, keyed by name.
+// The value is nil for those the appbundle may have had but needs no more.
+func CreateExpectedExternalSecrets(ab *atroxyzv1alpha1.AppBundle) (map[string]*extsec.ExternalSecret, error) {
+	externalSecret, err := CreateExpectedExternalSecret(ab)
+	if err != nil {
+		return nil, err
+	}
+
+	registryExternalSecret, err := CreateExpectedRegistryExternalSecret(ab)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]*extsec.ExternalSecret{
+		ab.Name:                   externalSecret,
+		GetRegistrySecretName(ab): registryExternalSecret,
+	}, nil
+}
+
+// ReconcileExternalSecret reconciles the external secrets for the appbundle, that of its envs and configs and that of its registry credentials
 func (r *AppBundleReconciler) ReconcileExternalSecret(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
 	// LOCK the resource
 	mu := getMutex("extsec", ab.Name, ab.Namespace)
 	mu.Lock()
 	defer mu.Unlock()
 
-	// GET THE CURRENT EXTERNALSECRET
-	currentExternalSecret := &extsec.ExternalSecret{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
-	er := r.Get(ctx, client.ObjectKeyFromObject(currentExternalSecret), currentExternalSecret)
-
-	// GET THE EXPECTED EXTERNALSECRET
-	expectedExternalSecret, err := CreateExpectedExternalSecret(ab)
+	// GET THE EXPECTED EXTERNALSECRETS
+	expectedExternalSecrets, err := CreateExpectedExternalSecrets(ab)
 	if err != nil {
 		return err
 	}
 
-	// There is no exterernal secret and no need for one, leave now
-	if errors.IsNotFound(er) && expectedExternalSecret == nil {
-		return nil
-	}
+	applied := []string{}
+	for _, name := range getSortedKeys(expectedExternalSecrets) {
+		expectedExternalSecret := expectedExternalSecrets[name]
+		if expectedExternalSecret != nil {
+			if _, err := r.ApplyResource(ctx, ab, expectedExternalSecret, false); err != nil {
+				return err
+			}
+			applied = append(applied, name)
+			continue
+		}
 
-	// There is external secret but no need for one, delete it
-	if expectedExternalSecret == nil {
+		// GET THE CURRENT EXTERNALSECRET
+		currentExternalSecret := &extsec.ExternalSecret{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+		currentExternalSecret.Name = name
+		er := r.Get(ctx, client.ObjectKeyFromObject(currentExternalSecret), currentExternalSecret)
+
+		// There is no exterernal secret and no need for one
+		if errors.IsNotFound(er) {
+			continue
+		}
 		// IN case a different error happened by now and wasn't accounted for yet
 		if er != nil {
 			return er
@@ -130,22 +199,71 @@ func (r *AppBundleReconciler) ReconcileExternalSecret(ctx context.Context, ab *a
 
 		// By now we know there was no error getting current ext secret (so there is one)
 		// And the expected one, is expected to not be there so we delete
-		return r.Delete(ctx, currentExternalSecret)
+		if err := r.DeleteResource(ctx, ab, currentExternalSecret, "no external secrets are referenced anymore"); err != nil {
+			return err
+		}
 	}
 
-	if !equality.Semantic.DeepDerivative(expectedExternalSecret.Spec, currentExternalSecret.Spec) {
-		reason, err := FormulateDiffMessageForSpecs(currentExternalSecret.Spec, expectedExternalSecret.Spec)
-		if err != nil {
-			return err
+	if len(applied) == 0 {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionSecretsSynced, true, atroxyzv1alpha1.ReasonNotRequired, "No external secrets referenced")
+		return nil
+	}
+
+	return r.ReportExternalSecretStatus(ctx, ab, applied...)
+}
+
+// ReportExternalSecretStatus sets the SecretsSynced condition and the external secret resource statuses on the app bundle.
+// The secrets are only synced once all the named external secrets are, the one named after the app bundle if none are named.
+func (r *AppBundleReconciler) ReportExternalSecretStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, names ...string) error {
+	if len(names) == 0 {
+		names = []string{ab.Name}
+	}
+
+	allHealthy, firstReason, firstMessage := true, atroxyzv1alpha1.ReasonSynced, ""
+	for _, name := range names {
+		externalSecret := &extsec.ExternalSecret{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: ab.Namespace}, externalSecret); err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			// Just created and not yet visible
+			SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionSecretsSynced, false, atroxyzv1alpha1.ReasonProgressing, "ExternalSecret is being created")
+			return nil
 		}
 
-		// Delete first (as ExternalSecrets is not so happy about mutations)
-		if err := r.Delete(ctx, currentExternalSecret); err != nil && !errors.IsNotFound(err) {
-			return err
+		healthy, reason, message := false, atroxyzv1alpha1.ReasonNotSynced, "ExternalSecret has not synced yet"
+		for _, condition := range externalSecret.Status.Conditions {
+			if condition.Type != extsec.ExternalSecretReady {
+				continue
+			}
+
+			healthy = condition.Status == corev1.ConditionTrue
+			if healthy {
+				reason, message = atroxyzv1alpha1.ReasonSynced, "ExternalSecret has synced"
+			}
+			if condition.Message != "" {
+				message = condition.Message
+			}
+		}
+
+		// The condition tells of the first external secret not synced yet, if any
+		if allHealthy {
+			allHealthy, firstReason, firstMessage = healthy, reason, message
 		}
 
-		return UpsertResource(ctx, r, expectedExternalSecret, reason, er, false)
+		SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+			Kind:      "ExternalSecret",
+			Name:      externalSecret.Name,
+			Namespace: externalSecret.Namespace,
+			Healthy:   healthy,
+			Message:   message,
+		})
+	}
+
+	if allHealthy && len(names) > 1 {
+		firstMessage = fmt.Sprintf("All %d ExternalSecrets have synced", len(names))
 	}
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionSecretsSynced, allHealthy, firstReason, firstMessage)
 
 	return nil
 }
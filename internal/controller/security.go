@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// GetPodSecurityContext returns the security context of the pods of the app bundle, nil if it has no security set.
+func GetPodSecurityContext(ab *atroxyzv1alpha1.AppBundle) *corev1.PodSecurityContext {
+	security := ab.Spec.Security
+	if security == nil {
+		return nil
+	}
+
+	podSecurityContext := &corev1.PodSecurityContext{}
+	switch getSecurityPreset(security) {
+	case atroxyzv1alpha1.SecurityPresetBaseline:
+		podSecurityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	case atroxyzv1alpha1.SecurityPresetRestricted:
+		runAsNonRoot := true
+		podSecurityContext.RunAsNonRoot = &runAsNonRoot
+		podSecurityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	}
+
+	if security.RunAsUser != nil {
+		runAsUser := *security.RunAsUser
+		podSecurityContext.RunAsUser = &runAsUser
+	}
+	if security.RunAsGroup != nil {
+		runAsGroup := *security.RunAsGroup
+		podSecurityContext.RunAsGroup = &runAsGroup
+	}
+	if security.FSGroup != nil {
+		fsGroup := *security.FSGroup
+		podSecurityContext.FSGroup = &fsGroup
+	}
+	if security.SeccompProfile != nil {
+		podSecurityContext.SeccompProfile = security.SeccompProfile.DeepCopy()
+	}
+
+	return podSecurityContext
+}
+
+// GetContainerSecurityContext returns the security context of every container of the app bundle, nil if it has no security set.
+// A new one is returned on every call, so each container can be given its own.
+func GetContainerSecurityContext(ab *atroxyzv1alpha1.AppBundle) *corev1.SecurityContext {
+	security := ab.Spec.Security
+	if security == nil {
+		return nil
+	}
+
+	securityContext := &corev1.SecurityContext{}
+	switch getSecurityPreset(security) {
+	case atroxyzv1alpha1.SecurityPresetPrivileged:
+		privileged := true
+		securityContext.Privileged = &privileged
+	case atroxyzv1alpha1.SecurityPresetBaseline:
+		privileged := false
+		securityContext.Privileged = &privileged
+	case atroxyzv1alpha1.SecurityPresetRestricted:
+		privileged, allowPrivilegeEscalation := false, false
+		securityContext.Privileged = &privileged
+		securityContext.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+		securityContext.Capabilities = &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}
+	}
+
+	if security.Capabilities != nil {
+		if securityContext.Capabilities == nil {
+			securityContext.Capabilities = &corev1.Capabilities{}
+		}
+		for _, capability := range security.Capabilities.Add {
+			if !slices.Contains(securityContext.Capabilities.Add, capability) {
+				securityContext.Capabilities.Add = append(securityContext.Capabilities.Add, capability)
+			}
+		}
+		for _, capability := range security.Capabilities.Drop {
+			if !slices.Contains(securityContext.Capabilities.Drop, capability) {
+				securityContext.Capabilities.Drop = append(securityContext.Capabilities.Drop, capability)
+			}
+		}
+	}
+
+	if security.ReadOnlyRootFilesystem != nil {
+		readOnlyRootFilesystem := *security.ReadOnlyRootFilesystem
+		securityContext.ReadOnlyRootFilesystem = &readOnlyRootFilesystem
+	}
+	if security.AllowPrivilegeEscalation != nil {
+		allowPrivilegeEscalation := *security.AllowPrivilegeEscalation
+		securityContext.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+	}
+
+	return securityContext
+}
+
+// CopyOverUser is the user the busybox containers copying configs over run as with the Restricted preset: nobody, as the image runs as root.
+const CopyOverUser int64 = 65534
+
+// SetSecurityContexts sets the security contexts of the app bundle on the pod spec and every one of its containers, init containers included.
+// The pods only meet a Pod Security Standard if all of their containers do, the copy-over ones too.
+func SetSecurityContexts(ab *atroxyzv1alpha1.AppBundle, podSpec *corev1.PodSpec) {
+	podSpec.SecurityContext = GetPodSecurityContext(ab)
+
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].SecurityContext = GetContainerSecurityContext(ab)
+		if strings.HasPrefix(podSpec.InitContainers[i].Name, CopyOverContainerPrefix) && getSecurityPreset(ab.Spec.Security) == atroxyzv1alpha1.SecurityPresetRestricted {
+			copyOverUser := CopyOverUser
+			podSpec.InitContainers[i].SecurityContext.RunAsUser = &copyOverUser
+		}
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].SecurityContext = GetContainerSecurityContext(ab)
+	}
+}
+
+// getSecurityPreset returns the preset of the security, an empty one if it has none or there is no security at all.
+func getSecurityPreset(security *atroxyzv1alpha1.AppBundleSecurity) atroxyzv1alpha1.AppBundleSecurityPreset {
+	if security == nil || security.Preset == nil {
+		return ""
+	}
+	return *security.Preset
+}
@@ -0,0 +1,155 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	psaapi "k8s.io/pod-security-admission/api"
+	"k8s.io/pod-security-admission/policy"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+// evaluatePodSecurity checks the pod template against the latest version of the Pod Security Standard of the given level.
+func evaluatePodSecurity(template *corev1.PodTemplateSpec, level psaapi.Level) policy.AggregateCheckResult {
+	evaluator, err := policy.NewEvaluator(policy.DefaultChecks(), nil)
+	Expect(err).NotTo(HaveOccurred())
+
+	return policy.AggregateCheckResults(evaluator.EvaluatePod(psaapi.LevelVersion{Level: level, Version: psaapi.LatestVersion()}, &template.ObjectMeta, &template.Spec))
+}
+
+var _ = Describe("Correctly populated AppBundle with security", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		repository := "quay.io/oauth2-proxy/oauth2-proxy"
+		tag := "v7.6.0"
+		copyOver := true
+		migrate := "migrate"
+		restricted := atroxyzv1alpha1.SecurityPresetRestricted
+		user := int64(1000)
+		readOnly := true
+		ab.Spec.Configs = map[string]atroxyzv1alpha1.AppBundleConfig{"app": {FileName: "app.yaml", Content: "debug: true", DirPath: "/config", CopyOver: &copyOver}}
+		ab.Spec.Sidecars = map[string]atroxyzv1alpha1.AppBundleSidecar{
+			"oauth": {Image: &atroxyzv1alpha1.AppBundleImage{Repository: &repository, Tag: &tag}, Ports: map[string]int{"oauth": 4180}},
+		}
+		ab.Spec.InitContainers = []atroxyzv1alpha1.AppBundleInitContainer{{Name: "migrate", Args: []*string{&migrate}}}
+		ab.Spec.Security = &atroxyzv1alpha1.AppBundleSecurity{
+			Preset:                 &restricted,
+			RunAsUser:              &user,
+			FSGroup:                &user,
+			ReadOnlyRootFilesystem: &readOnly,
+		}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileConfigMap(ctx, ab)).To(Succeed())
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should apply the security to the pods and every one of their containers", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		podSpec := deployment.Spec.Template.Spec
+		Expect(*podSpec.SecurityContext.RunAsUser).To(Equal(int64(1000)))
+		Expect(*podSpec.SecurityContext.FSGroup).To(Equal(int64(1000)))
+
+		containers := append(podSpec.InitContainers, podSpec.Containers...)
+		Expect(containers).To(HaveLen(4))
+		for _, container := range containers {
+			Expect(container.SecurityContext).NotTo(BeNil(), container.Name)
+			Expect(*container.SecurityContext.ReadOnlyRootFilesystem).To(BeTrue(), container.Name)
+			Expect(container.SecurityContext.Capabilities.Drop).To(ConsistOf(corev1.Capability("ALL")), container.Name)
+		}
+	})
+
+	It("Should run every container as a non-root user with the Restricted preset", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		podSpec := deployment.Spec.Template.Spec
+		for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+			user := podSpec.SecurityContext.RunAsUser
+			if container.SecurityContext.RunAsUser != nil {
+				user = container.SecurityContext.RunAsUser
+			}
+			Expect(user).NotTo(BeNil(), container.Name)
+			Expect(*user).NotTo(BeZero(), container.Name)
+		}
+
+		Expect(podSpec.InitContainers[0].Name).To(Equal(CopyOverContainerPrefix + "app"))
+		Expect(*podSpec.InitContainers[0].SecurityContext.RunAsUser).To(Equal(CopyOverUser))
+	})
+
+	It("Should meet the Restricted Pod Security Standard with the Restricted preset", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		result := evaluatePodSecurity(&deployment.Spec.Template, psaapi.LevelRestricted)
+		Expect(result.Allowed).To(BeTrue(), result.ForbiddenReasons)
+	})
+
+	It("Should meet the Restricted Pod Security Standard as a job, with the sidecars run as native ones", func() {
+		kind := atroxyzv1alpha1.WorkloadKindJob
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Kind: &kind}
+
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		job, err := CreateExpectedJob(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		result := evaluatePodSecurity(&job.Spec.Template, psaapi.LevelRestricted)
+		Expect(result.Allowed).To(BeTrue(), result.ForbiddenReasons)
+	})
+
+	It("Should meet only the Baseline Pod Security Standard with the Baseline preset", func() {
+		baseline := atroxyzv1alpha1.SecurityPresetBaseline
+		ab.Spec.Security = &atroxyzv1alpha1.AppBundleSecurity{Preset: &baseline}
+
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		deployment, err := CreateExpectedDeployment(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		result := evaluatePodSecurity(&deployment.Spec.Template, psaapi.LevelBaseline)
+		Expect(result.Allowed).To(BeTrue(), result.ForbiddenReasons)
+		Expect(evaluatePodSecurity(&deployment.Spec.Template, psaapi.LevelRestricted).Allowed).To(BeFalse())
+	})
+
+	It("Should leave the security context out without any security", func() {
+		ab.Spec.Security = nil
+
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		deployment, err := CreateExpectedDeployment(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(deployment.Spec.Template.Spec.SecurityContext).To(BeNil())
+		Expect(deployment.Spec.Template.Spec.Containers[0].SecurityContext).To(BeNil())
+	})
+
+	It("Should copy configs over without any security", func() {
+		ab.Spec.Security = nil
+
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		template, err := CreateExpectedPodTemplate(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(template.Spec.InitContainers[0].Name).To(Equal(CopyOverContainerPrefix + "app"))
+		Expect(template.Spec.InitContainers[0].SecurityContext).To(BeNil())
+	})
+})
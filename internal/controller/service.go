@@ -2,72 +2,27 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
-	equality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// GeneratedServiceSpecData is data that is generated by k8s API and hence cannot be "expected" as such is passed into expected function.
-type GeneratedServiceSpecData struct {
-	clusterIP             string
-	clusterIPs            []string
-	SessionAffinity       corev1.ServiceAffinity
-	IPFamilies            []corev1.IPFamily
-	IPFamilyPolicy        *corev1.IPFamilyPolicy
-	InternalTrafficPolicy *corev1.ServiceInternalTrafficPolicy
-}
-
-func MergeIntoServiceSpec(service *corev1.Service, data *GeneratedServiceSpecData) {
-	service.Spec.ClusterIP = data.clusterIP
-	service.Spec.ClusterIPs = data.clusterIPs
-	service.Spec.SessionAffinity = data.SessionAffinity
-	service.Spec.IPFamilies = data.IPFamilies
-	service.Spec.IPFamilyPolicy = data.IPFamilyPolicy
-	service.Spec.InternalTrafficPolicy = data.InternalTrafficPolicy
-}
-
-func GetGeneratedServiceSpecData(svc *corev1.Service) *GeneratedServiceSpecData {
-	return &GeneratedServiceSpecData{
-		clusterIP:             svc.Spec.ClusterIP,
-		clusterIPs:            svc.Spec.ClusterIPs,
-		SessionAffinity:       svc.Spec.SessionAffinity,
-		IPFamilies:            svc.Spec.IPFamilies,
-		IPFamilyPolicy:        svc.Spec.IPFamilyPolicy,
-		InternalTrafficPolicy: svc.Spec.InternalTrafficPolicy,
-	}
-}
-
 // CreateExpectedService creates the expected service from the appbundle
-func CreateExpectedService(ab *atroxyzv1alpha1.AppBundle, generatedSpecData *GeneratedServiceSpecData) (*corev1.Service, error) {
+func CreateExpectedService(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (*corev1.Service, error) {
 	service := &corev1.Service{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
-	// Ports
-	var ports []corev1.ServicePort
-	routeKeys := getSortedKeys(ab.Spec.Routes)
-	for _, key := range routeKeys {
-		route := ab.Spec.Routes[key]
-
-		tPort := int32(*route.Port)
-		if route.TargetPort != nil {
-			tPort = int32(*route.TargetPort)
-		}
-
-		port := corev1.ServicePort{Name: key, Port: int32(*route.Port), TargetPort: intstr.IntOrString{IntVal: tPort}, Protocol: "TCP"}
-
-		if route.Protocol != nil {
-			port.Protocol = *route.Protocol
-		}
-
-		ports = append(ports, port)
+	ports, err := GetServicePorts(ab)
+	if err != nil {
+		return nil, err
 	}
 
-	// Defaults to ClusterIP
-	if ab.Spec.ServiceType == nil {
-		ab.Spec.ServiceType = new(corev1.ServiceType)
-		*ab.Spec.ServiceType = corev1.ServiceTypeClusterIP
+	// Defaults to the operator-wide service type
+	serviceType := *cfg.ServiceType
+	if ab.Spec.ServiceType != nil {
+		serviceType = *ab.Spec.ServiceType
 	}
 
 	// Labeling to match the deployment
@@ -84,7 +39,7 @@ func CreateExpectedService(ab *atroxyzv1alpha1.AppBundle, generatedSpecData *Gen
 
 		if ab.Spec.Homepage != nil {
 			// See if we need to add homepage annotations
-			annotations = GetHomePageAnnotations(annotations, ab)
+			annotations = GetHomePageAnnotations(annotations, ab, cfg)
 		}
 	}
 
@@ -92,14 +47,40 @@ func CreateExpectedService(ab *atroxyzv1alpha1.AppBundle, generatedSpecData *Gen
 
 	service.Spec = corev1.ServiceSpec{
 		Ports:    ports,
-		Type:     *ab.Spec.ServiceType,
+		Type:     serviceType,
 		Selector: map[string]string{AppBundleSelector: ab.Name},
 	}
 
-	MergeIntoServiceSpec(service, generatedSpecData)
 	return service, nil
 }
 
+// GetServicePorts returns a service port for every route of the appbundle.
+func GetServicePorts(ab *atroxyzv1alpha1.AppBundle) ([]corev1.ServicePort, error) {
+	var ports []corev1.ServicePort
+	routeKeys := getSortedKeys(ab.Spec.Routes)
+	for _, key := range routeKeys {
+		route := ab.Spec.Routes[key]
+		if route.Port == nil {
+			return nil, fmt.Errorf("route %s has no port", key)
+		}
+
+		tPort := int32(*route.Port)
+		if route.TargetPort != nil {
+			tPort = int32(*route.TargetPort)
+		}
+
+		port := corev1.ServicePort{Name: key, Port: int32(*route.Port), TargetPort: intstr.IntOrString{IntVal: tPort}, Protocol: "TCP"}
+
+		if route.Protocol != nil {
+			port.Protocol = *route.Protocol
+		}
+
+		ports = append(ports, port)
+	}
+
+	return ports, nil
+}
+
 // ReconcileService reconciles the service for the appbundle
 func (r *AppBundleReconciler) ReconcileService(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
 	// LOCK the resource
@@ -112,38 +93,61 @@ func (r *AppBundleReconciler) ReconcileService(ctx context.Context, ab *atroxyzv
 	er := r.Get(ctx, client.ObjectKeyFromObject(currentService), currentService)
 
 	if ab.Spec.Routes == nil {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionServiceReady, true, atroxyzv1alpha1.ReasonNotRequired, "No routes defined")
+
 		// If there is no service and no routes on app bundle, leave now
 		if errors.IsNotFound(er) {
 			return nil
 		}
 
 		// If no routes, but service exists, delete it
-		return r.Delete(ctx, currentService)
+		return r.DeleteResource(ctx, ab, currentService, "there are no routes anymore")
 	}
 
 	// GET THE EXPECTED SERVICE
-	expectedService, err := CreateExpectedService(ab, GetGeneratedServiceSpecData(currentService))
+	cfg, err := r.GetAtrokConfig(ctx)
 	if err != nil {
 		return err
 	}
 
-	if expectedService != nil && !equality.Semantic.DeepDerivative(expectedService.Spec, currentService.Spec) {
-		reason, err := FormulateDiffMessageForSpecs(currentService.Spec, expectedService.Spec)
-		if err != nil {
-			return err
-		}
+	// Fields the api server fills in (e.g. the cluster IP) are left out and so kept as they are
+	expectedService, err := CreateExpectedService(ab, cfg)
+	if err != nil {
+		return err
+	}
 
-		return UpsertResource(ctx, r, expectedService, reason, er, false)
+	if _, err := r.ApplyResource(ctx, ab, expectedService, false); err != nil {
+		return err
 	}
 
-	if expectedService != nil && !StringMapsMatch(expectedService.ObjectMeta.Labels, currentService.ObjectMeta.Labels) {
-		reason, err := FormulateDiffMessageForLabels(currentService.ObjectMeta.Labels, expectedService.ObjectMeta.Labels)
-		if err != nil {
+	return r.ReportServiceStatus(ctx, ab)
+}
+
+// ReportServiceStatus sets the ServiceReady condition and the service resource status on the app bundle.
+func (r *AppBundleReconciler) ReportServiceStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	service := &corev1.Service{}
+	if err := r.Get(ctx, GetAppBundleNamespacedName(ab), service); err != nil {
+		if !errors.IsNotFound(err) {
 			return err
 		}
+		// Just created and not yet visible
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionServiceReady, false, atroxyzv1alpha1.ReasonProgressing, "Service is being created")
+		return nil
+	}
 
-		return UpsertResource(ctx, r, expectedService, reason, er, false)
+	healthy, reason, message := true, atroxyzv1alpha1.ReasonAvailable, "Service exists"
+	if service.Spec.Type == corev1.ServiceTypeLoadBalancer && len(service.Status.LoadBalancer.Ingress) == 0 {
+		healthy, reason, message = false, atroxyzv1alpha1.ReasonProgressing, "Waiting for a load balancer address"
 	}
 
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionServiceReady, healthy, reason, message)
+	SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+		Kind:      "Service",
+		Name:      service.Name,
+		Namespace: service.Namespace,
+		Healthy:   healthy,
+		Message:   message,
+	})
+
 	return nil
 }
@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AppBundleNamespaceLabel is put on the cluster roles and cluster role bindings of an app bundle next to AppBundleSelector,
+// as they have no namespace of their own to tell the app bundles of the same name apart by.
+const AppBundleNamespaceLabel = "atro.xyz/app-bundle-namespace"
+
+// GetClusterRBACName returns the name of the cluster role and cluster role binding generated for the app bundle, unique across namespaces.
+// The namespace is hashed along with the name rather than appended to it, as e.g. a-b in namespace c and a in namespace b-c would otherwise share a name.
+func GetClusterRBACName(ab *atroxyzv1alpha1.AppBundle) string {
+	sum := sha256.Sum256([]byte(ab.Namespace + "/" + ab.Name))
+	return fmt.Sprintf("%s-%s", ab.Name, hex.EncodeToString(sum[:])[:10])
+}
+
+// GetRoleBindingName returns the name of the role binding granting the service account of the app bundle the existing role.
+func GetRoleBindingName(ab *atroxyzv1alpha1.AppBundle, role atroxyzv1alpha1.AppBundleRoleRef) string {
+	return fmt.Sprintf("%s-%s-%s", ab.Name, strings.ToLower(role.Kind), role.Name)
+}
+
+// GetClusterRoleBindingName returns the name of the cluster role binding granting the service account of the app bundle the existing cluster role across the cluster.
+func GetClusterRoleBindingName(ab *atroxyzv1alpha1.AppBundle, role atroxyzv1alpha1.AppBundleRoleRef) string {
+	return fmt.Sprintf("%s-%s", GetClusterRBACName(ab), role.Name)
+}
+
+// GetClusterRBACObjectMeta returns the metadata of a cluster-scoped resource of the app bundle.
+// It can not be owned by the app bundle as that is namespaced, so it is found by its labels instead.
+func GetClusterRBACObjectMeta(ab *atroxyzv1alpha1.AppBundle, name string) metav1.ObjectMeta {
+	labels := SetDefaultAppBundleLabels(ab, nil)
+	labels[AppBundleNamespaceLabel] = ab.Namespace
+
+	return metav1.ObjectMeta{Name: name, Labels: labels}
+}
+
+// getServiceAccountSubjects returns the service account of the app bundle as the subject of a binding.
+func getServiceAccountSubjects(ab *atroxyzv1alpha1.AppBundle) []rbacv1.Subject {
+	return []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: ab.Name, Namespace: ab.Namespace}}
+}
+
+// isClusterWide reports whether the existing role is granted across the cluster.
+func isClusterWide(role atroxyzv1alpha1.AppBundleRoleRef) bool {
+	return role.ClusterWide != nil && *role.ClusterWide
+}
+
+// CreateExpectedServiceAccount creates expected service account from appbundle, nil if it asks for none.
+func CreateExpectedServiceAccount(ab *atroxyzv1alpha1.AppBundle) *corev1.ServiceAccount {
+	settings := ab.Spec.ServiceAccount
+	if settings == nil {
+		return nil
+	}
+
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+	serviceAccount.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+	serviceAccount.AutomountServiceAccountToken = settings.AutomountServiceAccountToken
+	for _, name := range settings.ImagePullSecrets {
+		serviceAccount.ImagePullSecrets = append(serviceAccount.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+
+	return serviceAccount
+}
+
+// CreateExpectedRole creates the role granting the rules of the service account of the appbundle, nil if it has none.
+func CreateExpectedRole(ab *atroxyzv1alpha1.AppBundle) *rbacv1.Role {
+	if ab.Spec.ServiceAccount == nil || len(ab.Spec.ServiceAccount.Rules) == 0 {
+		return nil
+	}
+
+	role := &rbacv1.Role{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+	role.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+	role.Rules = ab.Spec.ServiceAccount.Rules
+
+	return role
+}
+
+// CreateExpectedRoleBindings creates the role bindings granting the service account of the appbundle its own role and the existing roles it lists.
+func CreateExpectedRoleBindings(ab *atroxyzv1alpha1.AppBundle) []*rbacv1.RoleBinding {
+	if ab.Spec.ServiceAccount == nil {
+		return nil
+	}
+
+	roleBindings := []*rbacv1.RoleBinding{}
+	newRoleBinding := func(name string, roleRef rbacv1.RoleRef) *rbacv1.RoleBinding {
+		roleBinding := &rbacv1.RoleBinding{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+		roleBinding.ObjectMeta.Name = name
+		roleBinding.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+		roleBinding.Subjects = getServiceAccountSubjects(ab)
+		roleBinding.RoleRef = roleRef
+		return roleBinding
+	}
+
+	if len(ab.Spec.ServiceAccount.Rules) != 0 {
+		roleBindings = append(roleBindings, newRoleBinding(ab.Name, rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: ab.Name}))
+	}
+	for _, role := range ab.Spec.ServiceAccount.Roles {
+		if isClusterWide(role) {
+			continue
+		}
+		roleBindings = append(roleBindings, newRoleBinding(GetRoleBindingName(ab, role), rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: role.Kind, Name: role.Name}))
+	}
+
+	return roleBindings
+}
+
+// CreateExpectedClusterRole creates the cluster role granting the cluster rules of the service account of the appbundle, nil if it has none.
+func CreateExpectedClusterRole(ab *atroxyzv1alpha1.AppBundle) *rbacv1.ClusterRole {
+	if ab.Spec.ServiceAccount == nil || len(ab.Spec.ServiceAccount.ClusterRules) == 0 {
+		return nil
+	}
+
+	return &rbacv1.ClusterRole{
+		ObjectMeta: GetClusterRBACObjectMeta(ab, GetClusterRBACName(ab)),
+		Rules:      ab.Spec.ServiceAccount.ClusterRules,
+	}
+}
+
+// CreateExpectedClusterRoleBindings creates the cluster role bindings granting the service account of the appbundle its own cluster role and the existing cluster roles it lists as cluster wide.
+func CreateExpectedClusterRoleBindings(ab *atroxyzv1alpha1.AppBundle) []*rbacv1.ClusterRoleBinding {
+	if ab.Spec.ServiceAccount == nil {
+		return nil
+	}
+
+	clusterRoleBindings := []*rbacv1.ClusterRoleBinding{}
+	newClusterRoleBinding := func(name, roleName string) *rbacv1.ClusterRoleBinding {
+		return &rbacv1.ClusterRoleBinding{
+			ObjectMeta: GetClusterRBACObjectMeta(ab, name),
+			Subjects:   getServiceAccountSubjects(ab),
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: roleName},
+		}
+	}
+
+	if len(ab.Spec.ServiceAccount.ClusterRules) != 0 {
+		clusterRoleBindings = append(clusterRoleBindings, newClusterRoleBinding(GetClusterRBACName(ab), GetClusterRBACName(ab)))
+	}
+	for _, role := range ab.Spec.ServiceAccount.Roles {
+		if isClusterWide(role) {
+			clusterRoleBindings = append(clusterRoleBindings, newClusterRoleBinding(GetClusterRoleBindingName(ab, role), role.Name))
+		}
+	}
+
+	return clusterRoleBindings
+}
+
+// SetServiceAccount makes the pods run under the service account of the app bundle, if it has one.
+func SetServiceAccount(ab *atroxyzv1alpha1.AppBundle, podSpec *corev1.PodSpec) {
+	settings := ab.Spec.ServiceAccount
+	if settings == nil {
+		return
+	}
+
+	podSpec.ServiceAccountName = ab.Name
+	podSpec.AutomountServiceAccountToken = settings.AutomountServiceAccountToken
+
+	for _, name := range settings.ImagePullSecrets {
+		if !slices.Contains(podSpec.ImagePullSecrets, corev1.LocalObjectReference{Name: name}) {
+			podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+		}
+	}
+}
+
+// ReconcileServiceAccount applies the service account of the app bundle along with its roles and bindings.
+// Those no longer expected are removed by PruneResources, the cluster-scoped ones included.
+func (r *AppBundleReconciler) ReconcileServiceAccount(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	// LOCK the resource
+	mu := getMutex("serviceaccount", ab.Name, ab.Namespace)
+	mu.Lock()
+	defer mu.Unlock()
+
+	serviceAccount := CreateExpectedServiceAccount(ab)
+	if serviceAccount == nil {
+		return nil
+	}
+
+	// Checked by the webhook too, this keeps an app bundle admitted without it from granting cluster access or roles that are not bindable.
+	// Its rules are left to the api server, which only lets the operator grant what it holds itself as it may not escalate.
+	cfg, err := r.GetAtrokConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if ab.Spec.ServiceAccount.HasClusterRBAC() && !*cfg.AllowClusterRBAC {
+		return fmt.Errorf("app bundle %s grants its service account cluster access, which the AtrokConfig does not allow", ab.Name)
+	}
+	for _, role := range ab.Spec.ServiceAccount.Roles {
+		if !slices.Contains(cfg.BindableRoles, role.Name) {
+			return fmt.Errorf("app bundle %s grants its service account %s %s, which is not among the bindableRoles of the AtrokConfig", ab.Name, role.Kind, role.Name)
+		}
+	}
+
+	objs := []client.Object{serviceAccount}
+	if role := CreateExpectedRole(ab); role != nil {
+		objs = append(objs, role)
+	}
+	for _, roleBinding := range CreateExpectedRoleBindings(ab) {
+		objs = append(objs, roleBinding)
+	}
+	if clusterRole := CreateExpectedClusterRole(ab); clusterRole != nil {
+		objs = append(objs, clusterRole)
+	}
+	for _, clusterRoleBinding := range CreateExpectedClusterRoleBindings(ab) {
+		objs = append(objs, clusterRoleBinding)
+	}
+
+	// The roles go before their bindings, so the service account is never bound to a role that is not there yet
+	for _, obj := range objs {
+		if _, err := r.ApplyResource(ctx, ab, obj, false); err != nil {
+			return err
+		}
+	}
+
+	SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+		Kind:      "ServiceAccount",
+		Name:      serviceAccount.Name,
+		Namespace: serviceAccount.Namespace,
+		Healthy:   true,
+		Message:   fmt.Sprintf("%d roles and bindings", len(objs)-1),
+	})
+
+	return nil
+}
+
+// GetClusterResourceLists returns an empty list for every cluster-scoped kind atrok generates for app bundles, those the prune pass looks through by label.
+func GetClusterResourceLists() []client.ObjectList {
+	return []client.ObjectList{
+		&rbacv1.ClusterRoleList{},
+		&rbacv1.ClusterRoleBindingList{},
+	}
+}
+
+// DeleteClusterResources deletes the cluster-scoped resources of the app bundle whose names are not expected, all of them if nothing is.
+// They are found by the labels of the app bundle as they can not be owned by it.
+func (r *AppBundleReconciler) DeleteClusterResources(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, expected map[string][]string, reason string) error {
+	for _, list := range GetClusterResourceLists() {
+		if err := r.List(ctx, list, client.MatchingLabels{AppBundleSelector: ab.Name, AppBundleNamespaceLabel: ab.Namespace}); err != nil {
+			return err
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok || contains(expected[GetKind(obj)], obj.GetName()) {
+				continue
+			}
+
+			if err := r.DeleteResource(ctx, ab, obj, reason); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
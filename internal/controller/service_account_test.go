@@ -0,0 +1,145 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle with a service account", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme, ConfigName: GetRandomName()}
+
+		allowClusterRBAC := true
+		atrokConfig := &atroxyzv1alpha1.AtrokConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: rec.ConfigName},
+			Spec:       atroxyzv1alpha1.AtrokConfigSpec{AllowClusterRBAC: &allowClusterRBAC, BindableRoles: []string{"view", "system:auth-delegator"}},
+		}
+		Expect(rec.Create(ctx, atrokConfig)).To(Succeed())
+
+		automount := false
+		clusterWide := true
+		ab.Spec.ServiceAccount = &atroxyzv1alpha1.AppBundleServiceAccount{
+			AutomountServiceAccountToken: &automount,
+			ImagePullSecrets:             []string{"ghcr"},
+			Rules:                        []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch"}}},
+			ClusterRules:                 []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list"}}},
+			Roles: []atroxyzv1alpha1.AppBundleRoleRef{
+				{Kind: "ClusterRole", Name: "view"},
+				{Kind: "ClusterRole", Name: "system:auth-delegator", ClusterWide: &clusterWide},
+			},
+		}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileServiceAccount(ctx, ab)).To(Succeed())
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should run the pods under a service account of their own", func() {
+		serviceAccount := &corev1.ServiceAccount{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), serviceAccount)).To(Succeed())
+		Expect(*serviceAccount.AutomountServiceAccountToken).To(BeFalse())
+		Expect(serviceAccount.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "ghcr"}}))
+
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		podSpec := deployment.Spec.Template.Spec
+		Expect(podSpec.ServiceAccountName).To(Equal(ab.Name))
+		Expect(*podSpec.AutomountServiceAccountToken).To(BeFalse())
+		Expect(podSpec.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "regcred"}, {Name: "ghcr"}}))
+	})
+
+	It("Should grant the service account its rules and the roles it lists", func() {
+		role := &rbacv1.Role{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), role)).To(Succeed())
+		Expect(role.Rules).To(Equal(ab.Spec.ServiceAccount.Rules))
+
+		subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: ab.Name, Namespace: ab.Namespace}}
+		for name, roleRef := range map[string]rbacv1.RoleRef{
+			ab.Name:                       {APIGroup: rbacv1.GroupName, Kind: "Role", Name: ab.Name},
+			ab.Name + "-clusterrole-view": {APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+		} {
+			roleBinding := &rbacv1.RoleBinding{}
+			Expect(rec.Get(ctx, client.ObjectKey{Name: name, Namespace: ab.Namespace}, roleBinding)).To(Succeed())
+			Expect(roleBinding.RoleRef).To(Equal(roleRef))
+			Expect(roleBinding.Subjects).To(Equal(subjects))
+		}
+
+		clusterRole := &rbacv1.ClusterRole{}
+		Expect(rec.Get(ctx, client.ObjectKey{Name: GetClusterRBACName(ab)}, clusterRole)).To(Succeed())
+		Expect(clusterRole.Labels).To(HaveKeyWithValue(AppBundleNamespaceLabel, ab.Namespace))
+
+		clusterRoleBinding := &rbacv1.ClusterRoleBinding{}
+		Expect(rec.Get(ctx, client.ObjectKey{Name: GetClusterRBACName(ab) + "-system:auth-delegator"}, clusterRoleBinding)).To(Succeed())
+		Expect(clusterRoleBinding.Subjects).To(Equal(subjects))
+	})
+
+	It("Should delete the cluster roles and bindings no longer asked for", func() {
+		ab.Spec.ServiceAccount.ClusterRules = nil
+		ab.Spec.ServiceAccount.Roles = nil
+		Expect(rec.PruneResources(ctx, ab)).To(Succeed())
+
+		err := rec.Get(ctx, client.ObjectKey{Name: GetClusterRBACName(ab)}, &rbacv1.ClusterRole{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		err = rec.Get(ctx, client.ObjectKey{Name: GetClusterRBACName(ab) + "-system:auth-delegator"}, &rbacv1.ClusterRoleBinding{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		err = rec.Get(ctx, client.ObjectKey{Name: ab.Name + "-clusterrole-view", Namespace: ab.Namespace}, &rbacv1.RoleBinding{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), &rbacv1.Role{})).To(Succeed())
+	})
+
+	It("Should name the cluster roles of app bundles apart when their names and namespaces join up the same", func() {
+		first := &atroxyzv1alpha1.AppBundle{ObjectMeta: metav1.ObjectMeta{Name: "a-b", Namespace: "c"}}
+		second := &atroxyzv1alpha1.AppBundle{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "b-c"}}
+		Expect(GetClusterRBACName(first)).NotTo(Equal(GetClusterRBACName(second)))
+	})
+
+	It("Should delete cluster roles of the app bundle found by label under names no longer generated", func() {
+		legacy := &rbacv1.ClusterRole{ObjectMeta: GetClusterRBACObjectMeta(ab, ab.Name+"-"+ab.Namespace)}
+		Expect(rec.Create(ctx, legacy)).To(Succeed())
+
+		Expect(rec.PruneResources(ctx, ab)).To(Succeed())
+
+		err := rec.Get(ctx, client.ObjectKeyFromObject(legacy), &rbacv1.ClusterRole{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(rec.Get(ctx, client.ObjectKey{Name: GetClusterRBACName(ab)}, &rbacv1.ClusterRole{})).To(Succeed())
+	})
+
+	It("Should refuse roles the AtrokConfig does not list as bindable", func() {
+		ab.Spec.ServiceAccount.Roles = append(ab.Spec.ServiceAccount.Roles, atroxyzv1alpha1.AppBundleRoleRef{Kind: "ClusterRole", Name: "cluster-admin"})
+		Expect(rec.ReconcileServiceAccount(ctx, ab)).NotTo(Succeed())
+
+		err := rec.Get(ctx, client.ObjectKey{Name: ab.Name + "-clusterrole-cluster-admin", Namespace: ab.Namespace}, &rbacv1.RoleBinding{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should refuse cluster access the AtrokConfig does not allow", func() {
+		rec.ConfigName = GetRandomName()
+		Expect(rec.ReconcileServiceAccount(ctx, ab)).NotTo(Succeed())
+	})
+})
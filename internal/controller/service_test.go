@@ -43,6 +43,27 @@ var _ = Describe("Correctly populated AppBundle with no routes reconcilling serv
 		Expect(errors.IsNotFound(err)).To(BeTrue())
 	})
 
+	It("Should take over a service written client-side by an earlier version", func() {
+		By("Creating the service under the field manager of earlier versions")
+		port := 80
+		ab.Spec.Routes = map[string]atroxyzv1alpha1.AppBundleRoute{"test": {Port: &port}}
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		service, err := CreateExpectedService(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+		service.Labels["stale"] = "yes"
+		Expect(rec.Create(ctx, service, client.FieldOwner("manager"))).To(Succeed())
+
+		// RECONCILE service
+		Expect(rec.ReconcileService(ctx, ab)).To(Succeed())
+
+		// CHECK the label atrok no longer sets is gone along with the old manager
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(service), service)).To(Succeed())
+		Expect(service.Labels).NotTo(HaveKey("stale"))
+		for _, entry := range service.ManagedFields {
+			Expect(entry.Manager).NotTo(Equal("manager"))
+		}
+	})
+
 	Describe("Adding a single route to AppBundle", func() {
 		Context("And updating", func() {
 			BeforeEach(func() {
@@ -109,6 +130,27 @@ var _ = Describe("Correctly populated AppBundle with no routes reconcilling serv
 						Expect(serviceBefore).To(Equal(serviceAfter))
 					})
 
+					It("Should leave fields set by others alone", func() {
+						By("Setting a field atrok does not manage")
+						service := &corev1.Service{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+						err := rec.Get(ctx, client.ObjectKeyFromObject(service), service)
+						Expect(err).NotTo(HaveOccurred())
+						clusterIP := service.Spec.ClusterIP
+						service.Annotations = map[string]string{"example.com/owner": "someone-else"}
+						err = rec.Update(ctx, service)
+						Expect(err).NotTo(HaveOccurred())
+
+						// RECONCILE service
+						err = rec.ReconcileService(ctx, ab)
+						Expect(err).NotTo(HaveOccurred())
+
+						// CHECK service
+						err = rec.Get(ctx, client.ObjectKeyFromObject(service), service)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(service.Annotations).To(HaveKeyWithValue("example.com/owner", "someone-else"))
+						Expect(service.Spec.ClusterIP).To(Equal(clusterIP))
+					})
+
 					It("Should delete the service", func() {
 						By("By removing routes and reconciling service using app bundle")
 						// DELETE ROUTE
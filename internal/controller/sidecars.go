@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// CreateExpectedSidecars creates the sidecar containers of the appbundle, sorted by name so they always come out in the same order.
+// Volumes and configs are mounted by the key they have in the app bundle, from the volumes the pod template already has.
+func CreateExpectedSidecars(ab *atroxyzv1alpha1.AppBundle) ([]corev1.Container, error) {
+	containers := []corev1.Container{}
+	for _, name := range getSortedKeys(ab.Spec.Sidecars) {
+		sidecar := ab.Spec.Sidecars[name]
+
+		if sidecar.Image == nil || sidecar.Image.Repository == nil || sidecar.Image.Tag == nil {
+			return nil, fmt.Errorf("sidecar %s has no image repository or tag", name)
+		}
+		imagePullPolicy := corev1.PullAlways
+		if sidecar.Image.PullPolicy != nil {
+			imagePullPolicy = *sidecar.Image.PullPolicy
+		}
+
+		env, err := GetContainerEnv(ab, sidecar.Envs, sidecar.SourcedEnvs)
+		if err != nil {
+			return nil, fmt.Errorf("sidecar %s: %w", name, err)
+		}
+
+		var ports []corev1.ContainerPort
+		for _, portName := range getSortedKeys(sidecar.Ports) {
+			ports = append(ports, corev1.ContainerPort{Name: portName, ContainerPort: int32(sidecar.Ports[portName]), Protocol: "TCP"})
+		}
+
+		var volumeMounts []corev1.VolumeMount
+		for _, key := range sidecar.Volumes {
+			volumeMount, err := GetVolumeMount(ab, key)
+			if err != nil {
+				return nil, fmt.Errorf("sidecar %s: %w", name, err)
+			}
+			volumeMounts = append(volumeMounts, *volumeMount)
+		}
+		for _, key := range sidecar.Configs {
+			if _, ok := ab.Spec.Configs[key]; !ok {
+				return nil, fmt.Errorf("sidecar %s: config %s does not exist", name, key)
+			}
+			volumeMounts = append(volumeMounts, GetConfigVolumeMount(ab, key))
+		}
+
+		resources := corev1.ResourceRequirements{}
+		if sidecar.Resources != nil {
+			resources = *sidecar.Resources
+		}
+
+		container := corev1.Container{
+			Name:            name,
+			Image:           fmt.Sprintf("%s:%s", *sidecar.Image.Repository, *sidecar.Image.Tag),
+			ImagePullPolicy: imagePullPolicy,
+			Resources:       resources,
+			Ports:           ports,
+			Env:             env,
+			VolumeMounts:    volumeMounts,
+			LivenessProbe:   sidecar.LivenessProbe,
+			ReadinessProbe:  sidecar.ReadinessProbe,
+			StartupProbe:    sidecar.StartupProbe,
+		}
+
+		for _, command := range sidecar.Command {
+			container.Command = append(container.Command, *command)
+		}
+		for _, arg := range sidecar.Args {
+			container.Args = append(container.Args, *arg)
+		}
+
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
+
+// GetContainerSourcedEnvs returns the sourced envs of every container of the app bundle, its own first followed by those of the sidecars sorted by name
+// and those the init containers set on top of the ones of the app bundle.
+func GetContainerSourcedEnvs(ab *atroxyzv1alpha1.AppBundle) []map[string]atroxyzv1alpha1.AppBundleSourcedEnv {
+	sourcedEnvs := []map[string]atroxyzv1alpha1.AppBundleSourcedEnv{ab.Spec.SourcedEnvs}
+	for _, name := range getSortedKeys(ab.Spec.Sidecars) {
+		sourcedEnvs = append(sourcedEnvs, ab.Spec.Sidecars[name].SourcedEnvs)
+	}
+	for _, initContainer := range ab.Spec.InitContainers {
+		sourcedEnvs = append(sourcedEnvs, initContainer.SourcedEnvs)
+	}
+	return sourcedEnvs
+}
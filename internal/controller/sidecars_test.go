@@ -0,0 +1,101 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle with sidecars", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		repository := "quay.io/oauth2-proxy/oauth2-proxy"
+		tag := "v7.6.0"
+		upstream := "--upstream=http://localhost:80"
+		path := "/data"
+		emptyDir := true
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {EmptyDir: &emptyDir, Path: &path}}
+		ab.Spec.Configs = map[string]atroxyzv1alpha1.AppBundleConfig{"proxy": {FileName: "proxy.cfg", Content: "provider = \"github\"", DirPath: "/etc/oauth2-proxy"}}
+		ab.Spec.Sidecars = map[string]atroxyzv1alpha1.AppBundleSidecar{
+			"oauth": {
+				Image:   &atroxyzv1alpha1.AppBundleImage{Repository: &repository, Tag: &tag},
+				Args:    []*string{&upstream},
+				Envs:    map[string]string{"OAUTH2_PROXY_HTTP_ADDRESS": "0.0.0.0:4180"},
+				Ports:   map[string]int{"oauth": 4180},
+				Volumes: []string{"data"},
+				Configs: []string{"proxy"},
+			},
+		}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileConfigMap(ctx, ab)).To(Succeed())
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should run the sidecar next to the container of the app bundle", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		containers := deployment.Spec.Template.Spec.Containers
+		Expect(containers).To(HaveLen(2))
+		Expect(containers[0].Name).To(Equal(ab.Name))
+
+		sidecar := containers[1]
+		Expect(sidecar.Name).To(Equal("oauth"))
+		Expect(sidecar.Image).To(Equal("quay.io/oauth2-proxy/oauth2-proxy:v7.6.0"))
+		Expect(sidecar.Args).To(Equal([]string{"--upstream=http://localhost:80"}))
+		Expect(sidecar.Env).To(Equal([]corev1.EnvVar{{Name: "OAUTH2_PROXY_HTTP_ADDRESS", Value: "0.0.0.0:4180"}}))
+		Expect(sidecar.Ports).To(Equal([]corev1.ContainerPort{{Name: "oauth", ContainerPort: 4180, Protocol: corev1.ProtocolTCP}}))
+	})
+
+	It("Should share the volumes and configs of the app bundle by key", func() {
+		deployment := &appsv1.Deployment{}
+		Expect(rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)).To(Succeed())
+
+		mounts := deployment.Spec.Template.Spec.Containers[1].VolumeMounts
+		Expect(mounts).To(HaveLen(2))
+		Expect(mounts[0].Name).To(Equal("data"))
+		Expect(mounts[0].MountPath).To(Equal("/data"))
+		Expect(mounts[1].Name).To(Equal("cm-proxy"))
+		Expect(mounts[1].MountPath).To(Equal("/etc/oauth2-proxy/proxy.cfg"))
+		Expect(mounts[1].ReadOnly).To(BeTrue())
+
+		// No volumes of its own, only those the container of the app bundle mounts too
+		Expect(deployment.Spec.Template.Spec.Volumes).To(HaveLen(2))
+	})
+
+	It("Should run sidecars of a job as native sidecars", func() {
+		kind := atroxyzv1alpha1.WorkloadKindJob
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Kind: &kind}
+
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		job, err := CreateExpectedJob(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(job.Spec.Template.Spec.Containers).To(HaveLen(1))
+		initContainers := job.Spec.Template.Spec.InitContainers
+		Expect(initContainers).To(HaveLen(1))
+		Expect(initContainers[0].Name).To(Equal("oauth"))
+		Expect(*initContainers[0].RestartPolicy).To(Equal(corev1.ContainerRestartPolicyAlways))
+	})
+})
@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// GetHeadlessServiceName returns the name of the headless service governing the stateful set of the app bundle.
+// It is separate from the service of the routes, which may be of any type and come and go with them.
+func GetHeadlessServiceName(ab *atroxyzv1alpha1.AppBundle) string {
+	return ab.Name + "-headless"
+}
+
+// CreateExpectedHeadlessService creates the headless service giving every replica of the stateful set of the appbundle a stable network identity.
+func CreateExpectedHeadlessService(ab *atroxyzv1alpha1.AppBundle) (*corev1.Service, error) {
+	ports, err := GetServicePorts(ab)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &corev1.Service{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+	service.ObjectMeta.Name = GetHeadlessServiceName(ab)
+	service.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+	service.Spec = corev1.ServiceSpec{
+		ClusterIP: corev1.ClusterIPNone,
+		Ports:     ports,
+		Selector:  GetSelectorLabels(ab),
+		// Replicas find each other before they are ready, e.g. to form a cluster
+		PublishNotReadyAddresses: true,
+	}
+
+	return service, nil
+}
+
+// CreateExpectedVolumeClaimTemplates creates a volume claim template for every volume of the appbundle backed by a generated claim.
+// Templates are named after the volume so they replace the volume of the same name in the pod template, with the labels (backup ones included) of the claim it replaces.
+func CreateExpectedVolumeClaimTemplates(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) ([]corev1.PersistentVolumeClaim, error) {
+	templates := []corev1.PersistentVolumeClaim{}
+	for _, key := range getSortedKeys(ab.Spec.Volumes) {
+		volume := ab.Spec.Volumes[key]
+		if !IsGeneratedClaim(&volume) {
+			continue
+		}
+
+		pvc, err := CreateExpectedPVC(ab, cfg, &volume, ab.Name+"-"+key)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: key, Labels: pvc.Labels},
+			Spec:       pvc.Spec,
+		})
+	}
+
+	return templates, nil
+}
+
+// CreateExpectedStatefulSet creates expected stateful set from appbundle
+func CreateExpectedStatefulSet(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (*appsv1.StatefulSet, error) {
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+
+	// Metadata
+	statefulSet.ObjectMeta.Annotations = ab.GetAnnotations()
+	if statefulSet.ObjectMeta.Annotations == nil {
+		statefulSet.ObjectMeta.Annotations = make(map[string]string)
+	}
+	statefulSet.ObjectMeta.Labels = SetDefaultAppBundleLabels(ab, nil)
+
+	template, err := CreateExpectedPodTemplate(ab, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	claimTemplates, err := CreateExpectedVolumeClaimTemplates(ab, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every replica mounts a claim of its own made from the template instead of the one claim shared by a deployment
+	volumes := []corev1.Volume{}
+	for _, volume := range template.Spec.Volumes {
+		replaced := false
+		for _, claimTemplate := range claimTemplates {
+			if volume.Name == claimTemplate.Name {
+				replaced = true
+			}
+		}
+		if !replaced {
+			volumes = append(volumes, volume)
+		}
+	}
+	template.Spec.Volumes = volumes
+
+	revHistLimit := int32(3)
+	statefulSet.Spec = appsv1.StatefulSetSpec{
+		Replicas:             ab.Spec.Replicas,
+		RevisionHistoryLimit: &revHistLimit,
+		ServiceName:          GetHeadlessServiceName(ab),
+		Selector:             &metav1.LabelSelector{MatchLabels: GetSelectorLabels(ab)},
+		Template:             *template,
+		VolumeClaimTemplates: claimTemplates,
+	}
+
+	return statefulSet, nil
+}
+
+// ReconcileStatefulSet applies the stateful set of the app bundle along with its headless service.
+func (r *AppBundleReconciler) ReconcileStatefulSet(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	// LOCK APPBUNDLE STATEFULSET MUTEX
+	mu := getMutex("statefulset", ab.Name, ab.Namespace)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// GET EXPECTED RESOURCES
+	cfg, err := r.GetAtrokConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	expectedService, err := CreateExpectedHeadlessService(ab)
+	if err != nil {
+		return err
+	}
+
+	expectedStatefulSet, err := CreateExpectedStatefulSet(ab, cfg)
+	if err != nil {
+		return err
+	}
+
+	// APPLY EXPECTED RESOURCES, the service first as the stateful set names it
+	if _, err := r.ApplyResource(ctx, ab, expectedService, false); err != nil {
+		return err
+	}
+
+	// The claims are expanded first, as growing a claim template has the stateful set recreated and would leave the existing claims as they are
+	if err := r.ExpandStatefulSetClaims(ctx, ab, expectedStatefulSet); err != nil {
+		return err
+	}
+
+	if _, err := r.ApplyResource(ctx, ab, expectedStatefulSet, false); err != nil {
+		return err
+	}
+
+	return r.ReportStatefulSetStatus(ctx, ab)
+}
+
+// ExpandStatefulSetClaims grows the storage requested by the claims made from the claim templates of the stateful set to what the templates now request.
+// The claims are named <template>-<stateful set>-<ordinal>, claims of replicas scaled away are expanded too so they fit once scaled back.
+// Claims are never shrunk, and claims not bound yet are left alone as only bound claims can be expanded.
+func (r *AppBundleReconciler) ExpandStatefulSetClaims(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, statefulSet *appsv1.StatefulSet) error {
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcList, client.InNamespace(statefulSet.Namespace), client.MatchingLabels{AppBundleSelector: ab.Name}); err != nil {
+		return err
+	}
+
+	for _, claimTemplate := range statefulSet.Spec.VolumeClaimTemplates {
+		expected, ok := claimTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+		if !ok {
+			continue
+		}
+
+		prefix := claimTemplate.Name + "-" + statefulSet.Name + "-"
+		for _, pvc := range pvcList.Items {
+			ordinal, found := strings.CutPrefix(pvc.Name, prefix)
+			if !found {
+				continue
+			}
+			if _, err := strconv.Atoi(ordinal); err != nil {
+				continue
+			}
+
+			current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+			if pvc.Status.Phase != corev1.ClaimBound || expected.Cmp(current) <= 0 {
+				continue
+			}
+
+			patch := client.MergeFrom(pvc.DeepCopy())
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = expected
+			if err := r.Patch(ctx, &pvc, patch); err != nil {
+				r.RecordEvent(ab, &pvc, corev1.EventTypeWarning, EventReasonUpdateFailed, "Expand", "Failed to expand PersistentVolumeClaim %s to %s: %s", pvc.Name, expected.String(), err)
+				return err
+			}
+			r.RecordEvent(ab, &pvc, corev1.EventTypeNormal, EventReasonUpdated, "Expand", "Expanded PersistentVolumeClaim %s from %s to %s", pvc.Name, current.String(), expected.String())
+		}
+	}
+
+	return nil
+}
+
+// ReportStatefulSetStatus sets the WorkloadAvailable condition and the stateful set resource status on the app bundle.
+func (r *AppBundleReconciler) ReportStatefulSetStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	statefulSet := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, GetAppBundleNamespacedName(ab), statefulSet); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		// Just created and not yet visible
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, false, atroxyzv1alpha1.ReasonProgressing, "StatefulSet is being created")
+		return nil
+	}
+
+	healthy, message := GetStatefulSetHealth(statefulSet)
+	reason := atroxyzv1alpha1.ReasonAvailable
+	if !healthy {
+		reason = atroxyzv1alpha1.ReasonProgressing
+	}
+
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionWorkloadAvailable, healthy, reason, message)
+	SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+		Kind:      "StatefulSet",
+		Name:      statefulSet.Name,
+		Namespace: statefulSet.Namespace,
+		Healthy:   healthy,
+		Message:   message,
+	})
+
+	return nil
+}
+
+// GetStatefulSetHealth tells whether all the replicas of the stateful set are updated and available, along with a human readable explanation.
+func GetStatefulSetHealth(statefulSet *appsv1.StatefulSet) (bool, string) {
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return false, "Latest stateful set spec has not been observed yet"
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	if statefulSet.Status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d replicas updated", statefulSet.Status.UpdatedReplicas, replicas)
+	}
+
+	if statefulSet.Status.AvailableReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d replicas available", statefulSet.Status.AvailableReplicas, replicas)
+	}
+
+	return true, fmt.Sprintf("%d of %d replicas available", statefulSet.Status.AvailableReplicas, replicas)
+}
@@ -0,0 +1,178 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Correctly populated AppBundle running as a StatefulSet", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+
+		kind := atroxyzv1alpha1.WorkloadKindStatefulSet
+		replicas := int32(2)
+		port := 5432
+		size := "1Gi"
+		path1 := "/var/lib/postgresql"
+		path2 := "/tmp"
+		emptyDir := true
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Kind: &kind}
+		ab.Spec.Replicas = &replicas
+		ab.Spec.Routes = map[string]atroxyzv1alpha1.AppBundleRoute{"db": {Port: &port}}
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{
+			"data": {Size: &size, Path: &path1},
+			"tmp":  {EmptyDir: &emptyDir, Path: &path2},
+		}
+
+		// CREATE APPBUNDLE
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+		ApplyTypeMetaToAppBundleForTesting(ab)
+
+		// RECONCILE
+		Expect(rec.ReconcileVolumes(ctx, ab)).To(Succeed())
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+	})
+
+	It("Should make a stateful set with a claim template per generated volume", func() {
+		statefulSet := &appsv1.StatefulSet{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(statefulSet), statefulSet)).To(Succeed())
+
+		Expect(statefulSet.Spec.ServiceName).To(Equal(GetHeadlessServiceName(ab)))
+		Expect(statefulSet.Spec.VolumeClaimTemplates).To(HaveLen(1))
+		Expect(statefulSet.Spec.VolumeClaimTemplates[0].Name).To(Equal("data"))
+		Expect(statefulSet.Spec.VolumeClaimTemplates[0].Labels).To(HaveKeyWithValue(AppBundleSelector, ab.Name))
+
+		// Only the empty dir is left as a volume of the pod, the claim template takes the place of the other
+		volumes := statefulSet.Spec.Template.Spec.Volumes
+		Expect(volumes).To(HaveLen(1))
+		Expect(volumes[0].Name).To(Equal("tmp"))
+		Expect(statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts[0].Name).To(Equal("data"))
+	})
+
+	It("Should make a headless service for the stateful set", func() {
+		service := &corev1.Service{}
+		Expect(rec.Get(ctx, client.ObjectKey{Name: GetHeadlessServiceName(ab), Namespace: ab.Namespace}, service)).To(Succeed())
+		Expect(service.Spec.ClusterIP).To(Equal(corev1.ClusterIPNone))
+		Expect(service.Spec.Selector).To(Equal(GetSelectorLabels(ab)))
+	})
+
+	It("Should leave the claims to the stateful set", func() {
+		pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: ab.Name + "-data", Namespace: ab.Namespace}}
+		err := rec.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		Expect(GetClaimNames(ab)).To(Equal([]string{"data-" + ab.Name + "-0", "data-" + ab.Name + "-1"}))
+	})
+
+	It("Should label the claim templates for backups", func() {
+		frequency := "0 3 * * *"
+		retain := 3
+		ab.Spec.Backup = &atroxyzv1alpha1.AppBundleVolumeLonghornBackup{Frequency: &frequency, Retain: &retain}
+
+		cfg := atroxyzv1alpha1.DefaultAtrokConfigSpec()
+		statefulSet, err := CreateExpectedStatefulSet(ab, &cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statefulSet.Spec.VolumeClaimTemplates[0].Labels).To(HaveKeyWithValue("recurring-job.longhorn.io/"+GetRecurringJobName(ab), "enabled"))
+	})
+
+	It("Should prune the deployment once switched to a stateful set", func() {
+		By("Running it as a deployment first")
+		deploymentKind := atroxyzv1alpha1.WorkloadKindDeployment
+		ab.Spec.Workload.Kind = &deploymentKind
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+
+		By("Switching back to a stateful set")
+		statefulSetKind := atroxyzv1alpha1.WorkloadKindStatefulSet
+		ab.Spec.Workload.Kind = &statefulSetKind
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+		Expect(rec.PruneResources(ctx, ab)).To(Succeed())
+
+		deployment := &appsv1.Deployment{}
+		err := rec.Get(ctx, GetAppBundleNamespacedName(ab), deployment)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+	It("Should expand the claims and keep the pods when a claim template grows", func() {
+		By("Binding a claim made from the template on an expandable storage class")
+		allowExpansion := true
+		storageClass := &storagev1.StorageClass{
+			ObjectMeta:           metav1.ObjectMeta{Name: GetRandomName()},
+			Provisioner:          "driver.longhorn.io",
+			AllowVolumeExpansion: &allowExpansion,
+		}
+		Expect(rec.Create(ctx, storageClass)).To(Succeed())
+
+		claim := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data-" + ab.Name + "-0", Namespace: ab.Namespace, Labels: map[string]string{AppBundleSelector: ab.Name}},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: &storageClass.Name,
+				VolumeName:       "pv-" + ab.Name,
+				Resources:        corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}},
+			},
+		}
+		Expect(rec.Create(ctx, claim)).To(Succeed())
+		claim.Status.Phase = corev1.ClaimBound
+		Expect(rec.Status().Update(ctx, claim)).To(Succeed())
+
+		By("Growing the volume")
+		size := "2Gi"
+		volume := ab.Spec.Volumes["data"]
+		volume.Size = &size
+		volume.StorageClass = &storageClass.Name
+		ab.Spec.Volumes["data"] = volume
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(claim), claim)).To(Succeed())
+		Expect(claim.Spec.Resources.Requests.Storage().String()).To(Equal("2Gi"))
+
+		// Nothing garbage collects in the test environment, so the stateful set stays held by the orphan finalizer
+		statefulSet := &appsv1.StatefulSet{ObjectMeta: GetAppBundleObjectMetaWithOwnerReference(ab)}
+		Expect(rec.Get(ctx, client.ObjectKeyFromObject(statefulSet), statefulSet)).To(Succeed())
+		Expect(statefulSet.DeletionTimestamp).NotTo(BeNil())
+		Expect(statefulSet.Finalizers).To(ContainElement(metav1.FinalizerOrphanDependents))
+	})
+
+	It("Should report DeploymentAvailable only while running as a deployment", func() {
+		By("Running it as a deployment first")
+		deploymentKind := atroxyzv1alpha1.WorkloadKindDeployment
+		ab.Spec.Workload.Kind = &deploymentKind
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+		SetDeploymentAvailableCondition(ab)
+
+		workload := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionWorkloadAvailable)
+		deployment := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionDeploymentAvailable)
+		Expect(deployment).NotTo(BeNil())
+		Expect(deployment.Status).To(Equal(workload.Status))
+		Expect(deployment.Reason).To(Equal(workload.Reason))
+
+		By("Switching back to a stateful set")
+		statefulSetKind := atroxyzv1alpha1.WorkloadKindStatefulSet
+		ab.Spec.Workload.Kind = &statefulSetKind
+		Expect(rec.ReconcileWorkload(ctx, ab)).To(Succeed())
+		SetDeploymentAvailableCondition(ab)
+
+		Expect(meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionDeploymentAvailable)).To(BeNil())
+	})
+})
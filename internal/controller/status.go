@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	equality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ChildConditionTypes are the conditions set by the individual reconcile functions, Ready is derived from them.
+var ChildConditionTypes = []string{
+	atroxyzv1alpha1.ConditionWorkloadAvailable,
+	atroxyzv1alpha1.ConditionServiceReady,
+	atroxyzv1alpha1.ConditionIngressReady,
+	atroxyzv1alpha1.ConditionSecretsSynced,
+	atroxyzv1alpha1.ConditionVolumesBound,
+	atroxyzv1alpha1.ConditionBackupConfigured,
+	atroxyzv1alpha1.ConditionBaseResolved,
+}
+
+// SetAppBundleCondition sets a condition on the app bundle status. Safe to call from reconciles running concurrently.
+func SetAppBundleCondition(ab *atroxyzv1alpha1.AppBundle, conditionType string, healthy bool, reason, message string) {
+	mu := getMutex("status", ab.Name, ab.Namespace)
+	mu.Lock()
+	defer mu.Unlock()
+
+	status := metav1.ConditionFalse
+	if healthy {
+		status = metav1.ConditionTrue
+	}
+
+	meta.SetStatusCondition(&ab.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: ab.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// SetAppBundleResourceStatus records the health of a generated resource on the app bundle status, replacing any previous entry of the same kind and name.
+// Safe to call from reconciles running concurrently.
+func SetAppBundleResourceStatus(ab *atroxyzv1alpha1.AppBundle, resource atroxyzv1alpha1.AppBundleResourceStatus) {
+	mu := getMutex("status", ab.Name, ab.Namespace)
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, existing := range ab.Status.Resources {
+		if existing.Kind == resource.Kind && existing.Name == resource.Name && existing.Namespace == resource.Namespace {
+			ab.Status.Resources[i] = resource
+			return
+		}
+	}
+
+	ab.Status.Resources = append(ab.Status.Resources, resource)
+}
+
+// WithCondition wraps a reconcile function so that a failure marks the given condition as false with the error as the message.
+func WithCondition(conditionType string, reconcile func(context.Context, *atroxyzv1alpha1.AppBundle) error) func(context.Context, *atroxyzv1alpha1.AppBundle) error {
+	return func(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+		err := reconcile(ctx, ab)
+
+		// Cancellation is caused by a sibling reconcile failing, that one reports the actual problem.
+		if err != nil && !errors.Is(err, context.Canceled) {
+			SetAppBundleCondition(ab, conditionType, false, atroxyzv1alpha1.ReasonReconcileFailed, err.Error())
+		}
+
+		return err
+	}
+}
+
+// SetReadyCondition derives the Ready condition from the others, reconcileErr is the error (if any) returned by the reconciles.
+func SetReadyCondition(ab *atroxyzv1alpha1.AppBundle, reconcileErr error) {
+	if reconcileErr != nil {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionReady, false, atroxyzv1alpha1.ReasonReconcileFailed, reconcileErr.Error())
+		return
+	}
+
+	for _, conditionType := range ChildConditionTypes {
+		condition := meta.FindStatusCondition(ab.Status.Conditions, conditionType)
+		if condition == nil || condition.Status != metav1.ConditionTrue {
+			SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionReady, false, atroxyzv1alpha1.ReasonNotReady, conditionType+" is not true")
+			return
+		}
+	}
+
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionReady, true, atroxyzv1alpha1.ReasonAvailable, "All resources are ready")
+}
+
+// SetDeploymentAvailableCondition mirrors WorkloadAvailable into DeploymentAvailable when the workload is a deployment and removes it otherwise,
+// so it neither goes stale once the workload kind changes nor disappears for those relying on it from before WorkloadAvailable.
+func SetDeploymentAvailableCondition(ab *atroxyzv1alpha1.AppBundle) {
+	workload := meta.FindStatusCondition(ab.Status.Conditions, atroxyzv1alpha1.ConditionWorkloadAvailable)
+	if workload == nil || ab.Spec.GetWorkloadKind() != atroxyzv1alpha1.WorkloadKindDeployment {
+		meta.RemoveStatusCondition(&ab.Status.Conditions, atroxyzv1alpha1.ConditionDeploymentAvailable)
+		return
+	}
+
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionDeploymentAvailable, workload.Status == metav1.ConditionTrue, workload.Reason, workload.Message)
+}
+
+// SetEffectiveSpec records the spec the resources are built from in the status if the config asks for it, clearing it otherwise.
+func SetEffectiveSpec(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) {
+	if cfg.RecordEffectiveSpec == nil || !*cfg.RecordEffectiveSpec {
+		ab.Status.EffectiveSpec = nil
+		return
+	}
+
+	ab.Status.EffectiveSpec = ab.Spec.DeepCopy()
+}
+
+// UpdateAppBundleStatus writes the status collected during the reconcile back to the app bundle.
+// The write is skipped when nothing changed compared to originalStatus, so that writing the status does not by itself trigger another reconcile.
+func (r *AppBundleReconciler) UpdateAppBundleStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, originalStatus *atroxyzv1alpha1.AppBundleStatus, reconcileErr error) error {
+	SetDeploymentAvailableCondition(ab)
+	SetReadyCondition(ab, reconcileErr)
+
+	sort.Slice(ab.Status.Resources, func(i, j int) bool {
+		if ab.Status.Resources[i].Kind != ab.Status.Resources[j].Kind {
+			return ab.Status.Resources[i].Kind < ab.Status.Resources[j].Kind
+		}
+		return ab.Status.Resources[i].Name < ab.Status.Resources[j].Name
+	})
+
+	ab.Status.ObservedGeneration = ab.Generation
+	ab.Status.LastReconciliation = originalStatus.LastReconciliation
+	if equality.Semantic.DeepEqual(*originalStatus, ab.Status) {
+		return nil
+	}
+
+	lastReconciliation := time.Now().UTC().Format(time.RFC3339)
+	ab.Status.LastReconciliation = &lastReconciliation
+
+	return r.Status().Update(ctx, ab)
+}
@@ -3,9 +3,11 @@ package controller
 import (
 	"context"
 	"fmt"
+	"maps"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
-	equality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -13,40 +15,99 @@ import (
 	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
 )
 
+// RetainAnnotation marks a generated claim to be released rather than deleted once the app bundle no longer needs it.
+// It lives on the claim as by then the volume asking for it is gone from the spec.
+const RetainAnnotation = "atro.xyz/retain"
+
 // CreateExpectedPVC creates the expected PVC in order to be compared to an already existing PVC if one exists, reconcille if doesn't.
-func CreateExpectedPVC(ab *atroxyzv1alpha1.AppBundle, volume *atroxyzv1alpha1.AppBundleVolume, volumeName string) (*corev1.PersistentVolumeClaim, error) {
+func CreateExpectedPVC(ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec, volume *atroxyzv1alpha1.AppBundleVolume, volumeName string) (*corev1.PersistentVolumeClaim, error) {
 	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
 		Name:            volumeName,
 		Namespace:       ab.Namespace,
 		OwnerReferences: []metav1.OwnerReference{ab.OwnerReference()},
 	}}
 
+	// Defaults to the operator-wide storage class, which if also unset leaves it to the cluster default
+	storageClass := cfg.StorageClass
+	if volume.StorageClass != nil {
+		storageClass = volume.StorageClass
+	}
+
+	if volume.Size == nil {
+		return nil, fmt.Errorf("volume %s has no size", volumeName)
+	}
+	size, err := resource.ParseQuantity(*volume.Size)
+	if err != nil {
+		return nil, fmt.Errorf("volume %s has an invalid size: %w", volumeName, err)
+	}
+
 	pvc.Spec = corev1.PersistentVolumeClaimSpec{
 		AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
-		StorageClassName: volume.StorageClass,
-		Resources:        corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(*volume.Size)}},
+		StorageClassName: storageClass,
+		Resources:        corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: size}},
 	}
 	pvc.ObjectMeta.Labels = GetPVCLabels(ab, volume, pvc)
+	if volume.Retain != nil && *volume.Retain {
+		pvc.ObjectMeta.Annotations = map[string]string{RetainAnnotation: "true"}
+	}
 
 	return pvc, nil
 }
 
+// IsGeneratedClaim reports whether the volume is backed by a claim generated for the app bundle, rather than an existing claim, a host path or an empty dir.
+func IsGeneratedClaim(volume *atroxyzv1alpha1.AppBundleVolume) bool {
+	return volume.ExistingClaim == nil && volume.HostPath == nil && (volume.EmptyDir == nil || !*volume.EmptyDir)
+}
+
+// GetClaimNames returns the names of the claims mounted by the app bundle, in the order of its volumes.
+// A stateful set makes a claim per replica from each generated volume, named after the volume, the stateful set and the ordinal of the replica.
+func GetClaimNames(ab *atroxyzv1alpha1.AppBundle) []string {
+	names := []string{}
+	for _, key := range getSortedKeys(ab.Spec.Volumes) {
+		volume := ab.Spec.Volumes[key]
+		switch {
+		case volume.ExistingClaim != nil:
+			names = append(names, *volume.ExistingClaim)
+		case !IsGeneratedClaim(&volume):
+			continue
+		case ab.Spec.GetWorkloadKind() == atroxyzv1alpha1.WorkloadKindStatefulSet:
+			replicas := int32(1)
+			if ab.Spec.Replicas != nil {
+				replicas = *ab.Spec.Replicas
+			}
+			for i := int32(0); i < replicas; i++ {
+				names = append(names, fmt.Sprintf("%s-%s-%d", key, ab.Name, i))
+			}
+		default:
+			names = append(names, ab.Name+"-"+key)
+		}
+	}
+
+	return names
+}
+
 func GetPVCLabels(ab *atroxyzv1alpha1.AppBundle, volume *atroxyzv1alpha1.AppBundleVolume, pvc *corev1.PersistentVolumeClaim) map[string]string {
 	labels := SetDefaultAppBundleLabels(ab, nil)
 	shouldBackup := ab.Spec.Backup != nil && !(volume.Backup != nil && !*volume.Backup)
 	if shouldBackup {
-		reccuringJobName := fmt.Sprintf("%s-%s", ab.Name, ab.Namespace)
-		jobSpecificKey := fmt.Sprintf("recurring-job.longhorn.io/%s", reccuringJobName)
-		jobGenericKey := "recurring-job.longhorn.io/source"
-		defaultGroupKey := "recurring-job-group.longhorn.io/default"
-
-		labels[jobSpecificKey] = "enabled"
-		labels[jobGenericKey] = "enabled"
-		labels[defaultGroupKey] = "enabled"
+		maps.Copy(labels, GetPVCBackupLabels(ab))
 	}
 	return labels
 }
 
+// GetPVCBackupLabels returns the labels that have longhorn back up a claim with the recurring job of the app bundle.
+func GetPVCBackupLabels(ab *atroxyzv1alpha1.AppBundle) map[string]string {
+	jobSpecificKey := fmt.Sprintf("recurring-job.longhorn.io/%s", GetRecurringJobName(ab))
+	jobGenericKey := "recurring-job.longhorn.io/source"
+	defaultGroupKey := "recurring-job-group.longhorn.io/default"
+
+	return map[string]string{
+		jobSpecificKey:  "enabled",
+		jobGenericKey:   "enabled",
+		defaultGroupKey: "enabled",
+	}
+}
+
 // ReconcileVolumes is a generic function that takes in a volume, checks if its a hostPath, emptyDir or a PVC. If hostPath or a emptyDir it just returns, if a PVC it reconciles it using ReconcilePVC function. If backup is requested it is also reconciled using ReconcileBackup function.
 func (r *AppBundleReconciler) ReconcileVolumes(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
 	// LOCK the resource
@@ -54,9 +115,11 @@ func (r *AppBundleReconciler) ReconcileVolumes(ctx context.Context, ab *atroxyzv
 	mu.Lock()
 	defer mu.Unlock()
 
-	// If no volumes requested leave.
+	// If no volumes requested leave, after removing the backup job of volumes there were before.
 	if ab.Spec.Volumes == nil {
-		return nil
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionVolumesBound, true, atroxyzv1alpha1.ReasonNotRequired, "No volumes defined")
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionBackupConfigured, true, atroxyzv1alpha1.ReasonNotRequired, "No volumes to back up")
+		return r.DeleteRecurringBackupJob(ctx, ab, "there are no volumes anymore")
 	}
 
 	// figure out what kind of volume this is
@@ -71,13 +134,13 @@ func (r *AppBundleReconciler) ReconcileVolumes(ctx context.Context, ab *atroxyzv
 			continue
 		}
 
-		// IF a HostPath volume then nothing to be done here
-		if volume.HostPath != nil {
+		// IF a HostPath or an emptydir volume then nothing to be done here
+		if !IsGeneratedClaim(&volume) {
 			continue
 		}
 
-		// If its an emptydir volume, we leave it alone
-		if volume.EmptyDir != nil && *volume.EmptyDir {
+		// A stateful set makes the claims of its replicas itself from its volume claim templates
+		if ab.Spec.GetWorkloadKind() == atroxyzv1alpha1.WorkloadKindStatefulSet {
 			continue
 		}
 
@@ -87,91 +150,101 @@ func (r *AppBundleReconciler) ReconcileVolumes(ctx context.Context, ab *atroxyzv
 		}
 	}
 
-	// LONGHORN backup plugin reconciliation
+	// LONGHORN backup plugin reconciliation, also removing the job once backups are turned off
+	if err := r.ReconcileRecurringBackupJob(ctx, ab); err != nil {
+		return err
+	}
 	if ab.Spec.Backup != nil {
-		if err := r.ReconcileRecurringBackupJob(ctx, ab); err != nil {
-			return err
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionBackupConfigured, true, atroxyzv1alpha1.ReasonConfigured, "Longhorn recurring backup job is configured")
+	} else {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionBackupConfigured, true, atroxyzv1alpha1.ReasonNotRequired, "No backup requested")
+	}
+
+	return r.ReportVolumeStatus(ctx, ab, GetClaimNames(ab))
+}
+
+// ReportVolumeStatus sets the VolumesBound condition and the claim resource statuses on the app bundle.
+func (r *AppBundleReconciler) ReportVolumeStatus(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, claimNames []string) error {
+	pending := []string{}
+	for _, name := range claimNames {
+		pvc := &corev1.PersistentVolumeClaim{}
+		phase := corev1.ClaimPending
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: ab.Namespace}, pvc); err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+		} else {
+			phase = pvc.Status.Phase
 		}
+
+		healthy := phase == corev1.ClaimBound
+		if !healthy {
+			pending = append(pending, name)
+		}
+
+		SetAppBundleResourceStatus(ab, atroxyzv1alpha1.AppBundleResourceStatus{
+			Kind:      "PersistentVolumeClaim",
+			Name:      name,
+			Namespace: ab.Namespace,
+			Healthy:   healthy,
+			Message:   "Claim is " + string(phase),
+		})
 	}
 
+	if len(pending) != 0 {
+		SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionVolumesBound, false, atroxyzv1alpha1.ReasonPending, "Claims not bound: "+strings.Join(pending, ", "))
+		return nil
+	}
+
+	SetAppBundleCondition(ab, atroxyzv1alpha1.ConditionVolumesBound, true, atroxyzv1alpha1.ReasonBound, fmt.Sprintf("%d claims bound", len(claimNames)))
 	return nil
 }
 
+// ReconcileExistingPVC applies the labels of the app bundle (and those needed for backups) to a claim it uses but did not create.
+// Only the labels are applied, leaving the rest of the claim to whoever owns it. Labels it already has with a different value are left alone.
 func (r *AppBundleReconciler) ReconcileExistingPVC(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, volume *atroxyzv1alpha1.AppBundleVolume) error {
 	// GET CURRENT PVC
 	currentPVC := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
 		Name:      *volume.ExistingClaim,
 		Namespace: ab.Namespace,
 	}}
-	er := r.Get(ctx, client.ObjectKeyFromObject(currentPVC), currentPVC)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(currentPVC), currentPVC); err != nil {
+		return err
+	}
 
 	// GET EXPECTED LABELS
 	expectedLabels := GetPVCLabels(ab, volume, currentPVC)
-	if currentPVC.Labels != nil {
-		for k, v := range currentPVC.Labels {
-			expectedLabels[k] = v
-		}
-	}
-
-	// IF CURRENT != EXPECTED LABEL-WISE THEN UPSERT
-	if !StringMapsMatch(currentPVC.Labels, expectedLabels) {
-		reason, err := FormulateDiffMessageForSpecs(currentPVC.ObjectMeta.Labels, expectedLabels)
-		if err != nil {
-			return err
+	for k, v := range currentPVC.Labels {
+		if expected, ok := expectedLabels[k]; ok && expected != v {
+			delete(expectedLabels, k)
 		}
-
-		// WARN: We re-upsert the existing PVC, upserting expectedPVC will fail as defaults are not set.
-		currentPVC.ObjectMeta.Labels = expectedLabels
-		return UpsertResource(ctx, r, currentPVC, reason, er, true)
 	}
 
-	return nil
+	// APPLY THE LABELS
+	labels := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+		Name:      currentPVC.Name,
+		Namespace: currentPVC.Namespace,
+		Labels:    expectedLabels,
+	}}
+	labels.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"))
+	_, err := r.ApplyResource(ctx, ab, labels, true)
+	return err
 }
 
-// ReconcilePVC compares currently existing PVC (if one exists) with what is the expected PVC and upserts if they differ.
+// ReconcilePVC applies the PVC expected for the volume. Claims are never recreated, so their data is never lost.
 func (r *AppBundleReconciler) ReconcilePVC(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, volume *atroxyzv1alpha1.AppBundleVolume, volumeName string) error {
-	// GET CURRENT PVC
-	currentPVC := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
-		Name:      volumeName,
-		Namespace: ab.Namespace,
-	}}
-	er := r.Get(ctx, client.ObjectKeyFromObject(currentPVC), currentPVC)
-
 	// GET EXPECTED PVC
-	expectedPVC, err := CreateExpectedPVC(ab, volume, volumeName)
+	cfg, err := r.GetAtrokConfig(ctx)
 	if err != nil {
 		return err
 	}
 
-	// IF CURRENT != EXPECTED THEN UPSERT
-	if !equality.Semantic.DeepDerivative(expectedPVC.Spec, currentPVC.Spec) {
-		reason, err := FormulateDiffMessageForSpecs(currentPVC.Spec, expectedPVC.Spec)
-		if err != nil {
-			return err
-		}
-
-		// Maybe labels changed because of backup label reasons
-		if reason == "" {
-			labelReason, err := GetDiffPaths(currentPVC.ObjectMeta.GetLabels(), expectedPVC.ObjectMeta.GetLabels())
-			if err != nil {
-				return err
-			}
-			reason = "labels changed: " + labelReason
-		}
-
-		return UpsertResource(ctx, r, expectedPVC, reason, er, true)
-	}
-
-	if !StringMapsMatch(expectedPVC.ObjectMeta.Labels, currentPVC.ObjectMeta.Labels) {
-		reason, err := FormulateDiffMessageForSpecs(currentPVC.ObjectMeta.Labels, expectedPVC.ObjectMeta.Labels)
-		if err != nil {
-			return err
-		}
-
-		// WARN: We re-upsert the existing PVC, upserting expectedPVC will fail as defaults are not set.
-		currentPVC.ObjectMeta.Labels = expectedPVC.ObjectMeta.Labels
-		return UpsertResource(ctx, r, currentPVC, reason, er, true)
+	expectedPVC, err := CreateExpectedPVC(ab, cfg, volume, volumeName)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// APPLY EXPECTED PVC
+	_, err = r.ApplyResource(ctx, ab, expectedPVC, true)
+	return err
 }
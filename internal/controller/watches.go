@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	longhornv1beta2 "github.com/longhorn/longhorn-manager/k8s/pkg/apis/longhorn/v1beta2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// mapConfigMapToAppBundles enqueues the AppBundles in the namespace of the ConfigMap that use it without owning it.
+func (r *AppBundleReconciler) mapConfigMapToAppBundles(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.mapReferencesToAppBundles(ctx, obj.GetNamespace(), func(ab *atroxyzv1alpha1.AppBundle) bool {
+		return ReferencesConfigMap(ab, obj.GetName())
+	})
+}
+
+// mapSecretToAppBundles enqueues the AppBundles in the namespace of the Secret that use it.
+func (r *AppBundleReconciler) mapSecretToAppBundles(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.mapReferencesToAppBundles(ctx, obj.GetNamespace(), func(ab *atroxyzv1alpha1.AppBundle) bool {
+		return ReferencesSecret(ab, obj.GetName())
+	})
+}
+
+// mapLonghornVolumeToAppBundles enqueues the AppBundles using the claim the Longhorn volume is bound to.
+func (r *AppBundleReconciler) mapLonghornVolumeToAppBundles(ctx context.Context, obj client.Object) []reconcile.Request {
+	vol, ok := obj.(*longhornv1beta2.Volume)
+	if !ok || vol.Status.KubernetesStatus.PVCName == "" {
+		return nil
+	}
+
+	return r.mapReferencesToAppBundles(ctx, vol.Status.KubernetesStatus.Namespace, func(ab *atroxyzv1alpha1.AppBundle) bool {
+		return ReferencesClaim(ab, vol.Status.KubernetesStatus.PVCName)
+	})
+}
+
+// mapReferencesToAppBundles enqueues the AppBundles in the namespace for which references returns true.
+// References are checked against the spec with the base merged in, as that is what the resources are built from.
+func (r *AppBundleReconciler) mapReferencesToAppBundles(ctx context.Context, namespace string, references func(*atroxyzv1alpha1.AppBundle) bool) []reconcile.Request {
+	abList := &atroxyzv1alpha1.AppBundleList{}
+	if err := r.List(ctx, abList, client.InNamespace(namespace)); err != nil {
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, ab := range abList.Items {
+		resolved := ab.DeepCopy()
+		if err := r.MergeBase(ctx, resolved); err != nil {
+			// Still worth checking what the app bundle sets itself
+			resolved = &ab
+		}
+
+		if references(resolved) {
+			requests = append(requests, reconcile.Request{NamespacedName: GetAppBundleNamespacedName(&ab)})
+		}
+	}
+	return requests
+}
+
+// ReferencesConfigMap reports whether the app bundle uses the named ConfigMap, either as an existing config or as the source of an env.
+func ReferencesConfigMap(ab *atroxyzv1alpha1.AppBundle, name string) bool {
+	for _, config := range ab.Spec.Configs {
+		if config.Existing != nil && *config.Existing == name {
+			return true
+		}
+	}
+
+	for _, sourcedEnvs := range GetContainerSourcedEnvs(ab) {
+		for _, env := range sourcedEnvs {
+			if env.ConfigMap == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ReferencesSecret reports whether the app bundle uses the named Secret as the source of an env.
+func ReferencesSecret(ab *atroxyzv1alpha1.AppBundle, name string) bool {
+	for _, sourcedEnvs := range GetContainerSourcedEnvs(ab) {
+		for _, env := range sourcedEnvs {
+			if env.Secret == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ReferencesClaim reports whether the app bundle mounts the named PersistentVolumeClaim, whether it generates it or uses an existing one.
+func ReferencesClaim(ab *atroxyzv1alpha1.AppBundle, name string) bool {
+	return slices.Contains(GetClaimNames(ab), name)
+}
@@ -0,0 +1,75 @@
+package controller
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	//+kubebuilder:scaffold:imports
+)
+
+var _ = Describe("Watching what an AppBundle refers to", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var rec *AppBundleReconciler
+	var ctx context.Context
+
+	BeforeEach(func() {
+		// SETUP
+		ctx = context.Background()
+		ab = GetBasicAppBundle()
+		rec = &AppBundleReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+	})
+
+	It("Should enqueue app bundles using an existing config map", func() {
+		existing := GetRandomName()
+		ab.Spec.Configs = map[string]atroxyzv1alpha1.AppBundleConfig{"app.yaml": {Existing: &existing, DirPath: "/config"}}
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: existing, Namespace: ab.Namespace}}
+		requests := rec.mapConfigMapToAppBundles(ctx, cm)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].NamespacedName).To(Equal(GetAppBundleNamespacedName(ab)))
+
+		By("Ignoring config maps it does not use")
+		cm.Name = GetRandomName()
+		Expect(rec.mapConfigMapToAppBundles(ctx, cm)).To(BeEmpty())
+	})
+
+	It("Should enqueue app bundles sourcing envs from a secret set on their base", func() {
+		secretName := GetRandomName()
+		abb := &atroxyzv1alpha1.AppBundleBase{
+			ObjectMeta: metav1.ObjectMeta{Name: GetRandomName()},
+			Spec: atroxyzv1alpha1.AppBundleBaseSpec{
+				SourcedEnvs: map[string]atroxyzv1alpha1.AppBundleSourcedEnv{"TOKEN": {Secret: secretName, Key: "token"}},
+			},
+		}
+		Expect(rec.Create(ctx, abb)).To(Succeed())
+		ab.Spec.Base = &abb.Name
+		Expect(rec.Create(ctx, ab)).To(Succeed())
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: ab.Namespace}}
+		Expect(rec.mapSecretToAppBundles(ctx, secret)).To(HaveLen(1))
+	})
+
+	It("Should tell which claims an app bundle mounts", func() {
+		path := "/data"
+		size := "1Gi"
+		existing := "media"
+		emptyDir := true
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{
+			"data":  {Path: &path, Size: &size},
+			"media": {Path: &path, ExistingClaim: &existing},
+			"cache": {Path: &path, EmptyDir: &emptyDir},
+		}
+
+		Expect(ReferencesClaim(ab, ab.Name+"-data")).To(BeTrue())
+		Expect(ReferencesClaim(ab, "media")).To(BeTrue())
+		Expect(ReferencesClaim(ab, ab.Name+"-cache")).To(BeFalse())
+	})
+})
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// ReconcileWorkload applies the workload of the kind the app bundle asks for. A workload of another kind left from before is deleted by PruneResources.
+func (r *AppBundleReconciler) ReconcileWorkload(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	// Only jobs have runs, the report of the job (if any) sets them again
+	ab.Status.LastRun = nil
+	ab.Status.LastScheduleTime = nil
+
+	switch kind := ab.Spec.GetWorkloadKind(); kind {
+	case atroxyzv1alpha1.WorkloadKindDeployment:
+		return r.ReconcileDeployment(ctx, ab)
+	case atroxyzv1alpha1.WorkloadKindStatefulSet:
+		return r.ReconcileStatefulSet(ctx, ab)
+	case atroxyzv1alpha1.WorkloadKindDaemonSet:
+		return r.ReconcileDaemonSet(ctx, ab)
+	case atroxyzv1alpha1.WorkloadKindCronJob:
+		return r.ReconcileCronJob(ctx, ab)
+	case atroxyzv1alpha1.WorkloadKindJob:
+		return r.ReconcileJob(ctx, ab)
+	default:
+		return fmt.Errorf("unknown workload kind %s", kind)
+	}
+}
@@ -0,0 +1,66 @@
+package v1alpha1
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+var _ = Describe("AppBundle defaulting webhook", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var defaulter *AppBundleCustomDefaulter
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ab = GetValidAppBundle()
+		defaulter = &AppBundleCustomDefaulter{}
+
+		port := 80
+		frequency := "0 3 * * *"
+		ab.Spec.Routes = map[string]atroxyzv1alpha1.AppBundleRoute{
+			"web": {Port: &port, Ingress: &atroxyzv1alpha1.AppBundleRouteIngress{}},
+		}
+		ab.Spec.Backup = &atroxyzv1alpha1.AppBundleVolumeLonghornBackup{Frequency: &frequency}
+	})
+
+	It("Should apply the constant defaults", func() {
+		err := defaulter.Default(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(*ab.Spec.Image.PullPolicy).To(Equal(atroxyzv1alpha1.DefaultPullPolicy))
+		Expect(*ab.Spec.Routes["web"].Protocol).To(Equal(atroxyzv1alpha1.DefaultRouteProtocol))
+		Expect(*ab.Spec.Routes["web"].Ingress.Auth).To(Equal(atroxyzv1alpha1.DefaultIngressAuth))
+		Expect(*ab.Spec.Backup.Retain).To(Equal(atroxyzv1alpha1.DefaultBackupRetain))
+	})
+
+	It("Should leave the service type to the reconciler", func() {
+		err := defaulter.Default(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ab.Spec.ServiceType).To(BeNil())
+	})
+
+	It("Should leave values that are set alone", func() {
+		pullPolicy := corev1.PullIfNotPresent
+		ab.Spec.Image.PullPolicy = &pullPolicy
+
+		err := defaulter.Default(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*ab.Spec.Image.PullPolicy).To(Equal(pullPolicy))
+	})
+
+	It("Should leave app bundles with a base to the reconciler", func() {
+		base := "base"
+		ab.Spec.Base = &base
+
+		err := defaulter.Default(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ab.Spec.Image.PullPolicy).To(BeNil())
+		Expect(ab.Spec.Routes["web"].Protocol).To(BeNil())
+	})
+})
@@ -0,0 +1,124 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// validateServiceAccountAccess keeps app bundles from granting their service account more than whoever creates or changes them may do, as the operator does the granting.
+// The rules have to be held by the requesting user, checked with a SubjectAccessReview each, and the existing roles have to be among the bindable roles of the AtrokConfig.
+func (v *AppBundleCustomValidator) validateServiceAccountAccess(ctx context.Context, ab *atroxyzv1alpha1.AppBundle, cfg *atroxyzv1alpha1.AtrokConfigSpec) (field.ErrorList, error) {
+	allErrs := field.ErrorList{}
+	serviceAccount := ab.Spec.ServiceAccount
+	fldPath := field.NewPath("spec", "serviceAccount")
+
+	for i, role := range serviceAccount.Roles {
+		if !slices.Contains(cfg.BindableRoles, role.Name) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("roles").Index(i).Child("name"), fmt.Sprintf("%s %s is not among the bindableRoles of the AtrokConfig", role.Kind, role.Name)))
+		}
+	}
+
+	if len(serviceAccount.Rules) == 0 && len(serviceAccount.ClusterRules) == 0 {
+		return allErrs, nil
+	}
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, rule := range serviceAccount.Rules {
+		ruleErrs, err := v.validateRuleHeld(ctx, req, rule, ab.Namespace, fldPath.Child("rules").Index(i))
+		if err != nil {
+			return nil, err
+		}
+		allErrs = append(allErrs, ruleErrs...)
+	}
+	for i, rule := range serviceAccount.ClusterRules {
+		ruleErrs, err := v.validateRuleHeld(ctx, req, rule, "", fldPath.Child("clusterRules").Index(i))
+		if err != nil {
+			return nil, err
+		}
+		allErrs = append(allErrs, ruleErrs...)
+	}
+
+	return allErrs, nil
+}
+
+// validateRuleHeld checks the user of the admission request may do everything the rule grants in the namespace, across the cluster if it is empty.
+// Non-resource urls are never granted in a namespace and are checked as such for cluster rules.
+func (v *AppBundleCustomValidator) validateRuleHeld(ctx context.Context, req admission.Request, rule rbacv1.PolicyRule, namespace string, fldPath *field.Path) (field.ErrorList, error) {
+	attributes := []authorizationv1.SubjectAccessReviewSpec{}
+	for _, verb := range rule.Verbs {
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				resourceNames := rule.ResourceNames
+				if len(resourceNames) == 0 {
+					resourceNames = []string{""}
+				}
+				for _, name := range resourceNames {
+					attributes = append(attributes, authorizationv1.SubjectAccessReviewSpec{ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace: namespace,
+						Verb:      verb,
+						Group:     group,
+						Resource:  resource,
+						Name:      name,
+					}})
+				}
+			}
+		}
+		for _, url := range rule.NonResourceURLs {
+			attributes = append(attributes, authorizationv1.SubjectAccessReviewSpec{NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: url, Verb: verb}})
+		}
+	}
+
+	for _, spec := range attributes {
+		spec.User = req.UserInfo.Username
+		spec.UID = req.UserInfo.UID
+		spec.Groups = req.UserInfo.Groups
+		spec.Extra = map[string]authorizationv1.ExtraValue{}
+		for key, value := range req.UserInfo.Extra {
+			spec.Extra[key] = authorizationv1.ExtraValue(value)
+		}
+
+		review := &authorizationv1.SubjectAccessReview{Spec: spec}
+		if err := v.Client.Create(ctx, review); err != nil {
+			return nil, err
+		}
+		if !review.Status.Allowed {
+			return field.ErrorList{field.Forbidden(fldPath, fmt.Sprintf("%s may not %s, so it can not grant it", req.UserInfo.Username, describeAccess(spec)))}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// describeAccess describes the access checked by the review, e.g. list pods in namespace devel.
+func describeAccess(spec authorizationv1.SubjectAccessReviewSpec) string {
+	if spec.NonResourceAttributes != nil {
+		return fmt.Sprintf("%s %s", spec.NonResourceAttributes.Verb, spec.NonResourceAttributes.Path)
+	}
+
+	attributes := spec.ResourceAttributes
+	resource := attributes.Resource
+	if attributes.Group != "" {
+		resource += "." + attributes.Group
+	}
+	if attributes.Name != "" {
+		resource += " " + attributes.Name
+	}
+	if attributes.Namespace == "" {
+		return fmt.Sprintf("%s %s across the cluster", attributes.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", attributes.Verb, resource, attributes.Namespace)
+}
@@ -0,0 +1,143 @@
+// Package v1alpha1 holds the admission webhooks of the atro.xyz/v1alpha1 resources.
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	"github.com/atropos112/atrok/internal/controller"
+)
+
+// +kubebuilder:webhook:path=/mutate-atro-xyz-v1alpha1-appbundle,mutating=true,failurePolicy=fail,sideEffects=None,groups=atro.xyz,resources=appbundles,verbs=create;update,versions=v1alpha1,name=mappbundle-v1alpha1.atro.xyz,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-atro-xyz-v1alpha1-appbundle,mutating=false,failurePolicy=fail,sideEffects=None,groups=atro.xyz,resources=appbundles,verbs=create;update,versions=v1alpha1,name=vappbundle-v1alpha1.atro.xyz,admissionReviewVersions=v1
+
+// AppBundleCustomDefaulter writes the constant defaults (see AppBundleSpec.DefaultStatic) to app bundles without a base, so the stored spec shows them.
+// The service type is left to the reconciler, as written to the spec it would no longer follow a change to the AtrokConfig,
+// and so are app bundles with a base, as the defaults would override what the base sets. The status records which fields the reconciler defaulted.
+type AppBundleCustomDefaulter struct{}
+
+// AppBundleCustomValidator rejects app bundles that could not be turned into resources, checking them with their base merged in.
+type AppBundleCustomValidator struct {
+	Client client.Client
+	// ConfigName is the name of the AtrokConfig the defaults are read from.
+	ConfigName string
+}
+
+// SetupAppBundleWebhookWithManager registers the app bundle webhooks with the manager.
+func SetupAppBundleWebhookWithManager(mgr ctrl.Manager, configName string) error {
+	return ctrl.NewWebhookManagedBy(mgr, &atroxyzv1alpha1.AppBundle{}).
+		WithDefaulter(&AppBundleCustomDefaulter{}).
+		WithValidator(&AppBundleCustomValidator{Client: mgr.GetClient(), ConfigName: configName}).
+		Complete()
+}
+
+func (d *AppBundleCustomDefaulter) Default(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	if ab.Spec.Base != nil || ab.DeletionTimestamp != nil {
+		return nil
+	}
+
+	ab.Spec.DefaultStatic()
+	return nil
+}
+
+func (v *AppBundleCustomValidator) ValidateCreate(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) (admission.Warnings, error) {
+	return deprecationWarnings(ab.Spec.UseNvidia), v.validate(ctx, ab)
+}
+
+func (v *AppBundleCustomValidator) ValidateUpdate(ctx context.Context, oldAb, newAb *atroxyzv1alpha1.AppBundle) (admission.Warnings, error) {
+	// Let app bundles being deleted through, otherwise their finalizers could never be removed
+	if newAb.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	// Let changes leaving the spec alone through (e.g. the finalizer being added), so app bundles stored before a validation was added can still be finalized
+	if equality.Semantic.DeepEqual(oldAb.Spec, newAb.Spec) {
+		return nil, nil
+	}
+
+	return deprecationWarnings(newAb.Spec.UseNvidia), v.validate(ctx, newAb)
+}
+
+func (v *AppBundleCustomValidator) ValidateDelete(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *AppBundleCustomValidator) validate(ctx context.Context, ab *atroxyzv1alpha1.AppBundle) error {
+	resolver := &controller.AppBundleReconciler{Client: v.Client, ConfigName: v.ConfigName}
+	resolved := ab.DeepCopy()
+
+	if err := resolver.MergeBase(ctx, resolved); err != nil {
+		allErrs, err := baseChainErrors(*ab.Spec.Base, err)
+		if err != nil {
+			return err
+		}
+		return invalid("AppBundle", ab.Name, allErrs)
+	}
+
+	// Validate what the reconciler will build from, which has the defaults applied
+	cfg, err := resolver.GetAtrokConfig(ctx)
+	if err != nil {
+		return err
+	}
+	resolved.Default(cfg)
+
+	allErrs := resolved.Validate()
+	if resolved.Spec.ServiceAccount != nil && resolved.Spec.ServiceAccount.HasClusterRBAC() && !*cfg.AllowClusterRBAC {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "serviceAccount"), "cluster roles and cluster wide bindings are not allowed by the AtrokConfig"))
+	}
+
+	// Access is only reviewed for otherwise valid app bundles, their rules may not even make sense to review
+	if len(allErrs) == 0 && resolved.Spec.ServiceAccount != nil {
+		accessErrs, err := v.validateServiceAccountAccess(ctx, resolved, cfg)
+		if err != nil {
+			return err
+		}
+		allErrs = append(allErrs, accessErrs...)
+	}
+
+	return invalid("AppBundle", ab.Name, allErrs)
+}
+
+// baseChainErrors turns an error resolving the chain of bases into field errors on spec.base.
+// Errors that are not about the chain itself (e.g. failing to reach the api server) are returned as they are.
+func baseChainErrors(base string, err error) (field.ErrorList, error) {
+	basePath := field.NewPath("spec", "base")
+
+	var notFound controller.BaseNotFoundError
+	var cycle controller.BaseCycleError
+	var tooDeep controller.BaseChainTooDeepError
+
+	switch {
+	case errors.As(err, &notFound):
+		return field.ErrorList{field.NotFound(basePath, notFound.Name)}, nil
+	case errors.As(err, &cycle), errors.As(err, &tooDeep):
+		return field.ErrorList{field.Invalid(basePath, base, err.Error())}, nil
+	default:
+		return nil, err
+	}
+}
+
+// deprecationWarnings warns about the deprecated fields that are set, they still work but are on their way out.
+func deprecationWarnings(useNvidia *bool) admission.Warnings {
+	if useNvidia != nil {
+		return admission.Warnings{"spec.useNvidia is deprecated, use spec.accelerators with nvidia.com/gpu instead"}
+	}
+	return nil
+}
+
+// invalid turns the errors into the error returned to the api server, or nil if there are none.
+func invalid(kind, name string, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(atroxyzv1alpha1.GroupVersion.WithKind(kind).GroupKind(), name, allErrs)
+}
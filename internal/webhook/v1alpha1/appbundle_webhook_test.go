@@ -0,0 +1,341 @@
+package v1alpha1
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+var _ = Describe("AppBundle validating webhook", func() {
+	var ab *atroxyzv1alpha1.AppBundle
+	var validator *AppBundleCustomValidator
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ab = GetValidAppBundle()
+		validator = &AppBundleCustomValidator{Client: NewFakeClient()}
+	})
+
+	// expectInvalidField checks the app bundle is rejected with an error about the given field
+	expectInvalidField := func(fieldPath string) {
+		_, err := validator.ValidateCreate(ctx, ab)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected an invalid error, got %v", err)
+		Expect(err.Error()).To(ContainSubstring(fieldPath))
+	}
+
+	It("Should accept a valid app bundle", func() {
+		_, err := validator.ValidateCreate(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should reject a missing image", func() {
+		ab.Spec.Image = nil
+		expectInvalidField("spec.image")
+	})
+
+	It("Should reject a volume without path or source", func() {
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {}}
+		expectInvalidField("spec.volumes[data].path")
+		expectInvalidField("one of hostPath, emptyDir, existingClaim or size must be set")
+	})
+
+	It("Should reject conflicting volume kinds", func() {
+		path := "/data"
+		hostPath := "/mnt/data"
+		size := "1Gi"
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {Path: &path, HostPath: &hostPath, Size: &size}}
+		expectInvalidField("spec.volumes[data]")
+	})
+
+	It("Should reject an unparsable volume size", func() {
+		path := "/data"
+		size := "lots"
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {Path: &path, Size: &size}}
+		expectInvalidField("spec.volumes[data].size")
+	})
+
+	It("Should reject retaining a claim the app bundle does not generate", func() {
+		path := "/data"
+		claim := "media"
+		retain := true
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {Path: &path, ExistingClaim: &claim, Retain: &retain}}
+		expectInvalidField("spec.volumes[data].retain")
+	})
+
+	It("Should reject a daemon set mounting a generated claim", func() {
+		kind := atroxyzv1alpha1.WorkloadKindDaemonSet
+		path := "/data"
+		size := "1Gi"
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Kind: &kind}
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {Path: &path, Size: &size}}
+		expectInvalidField("spec.volumes[data].size")
+	})
+
+	It("Should reject daemon set settings on another kind of workload", func() {
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{DaemonSet: &atroxyzv1alpha1.AppBundleDaemonSet{}}
+		expectInvalidField("spec.workload.daemonSet")
+	})
+
+	It("Should reject a cron job without a schedule", func() {
+		kind := atroxyzv1alpha1.WorkloadKindCronJob
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Kind: &kind}
+		expectInvalidField("spec.workload.cronJob.schedule")
+	})
+
+	It("Should reject job settings on a long running workload", func() {
+		backoffLimit := int32(3)
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{Job: &atroxyzv1alpha1.AppBundleJob{BackoffLimit: &backoffLimit}}
+		expectInvalidField("spec.workload.job")
+	})
+
+	It("Should accept a valid cron job", func() {
+		kind := atroxyzv1alpha1.WorkloadKindCronJob
+		schedule := "@daily"
+		ttl := int32(3600)
+		ab.Spec.Workload = &atroxyzv1alpha1.AppBundleWorkload{
+			Kind:    &kind,
+			CronJob: &atroxyzv1alpha1.AppBundleCronJob{Schedule: &schedule},
+			Job:     &atroxyzv1alpha1.AppBundleJob{TTLSecondsAfterFinished: &ttl},
+		}
+		_, err := validator.ValidateCreate(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should reject a sidecar mounting a volume the app bundle does not have", func() {
+		repository := "busybox"
+		tag := "stable"
+		ab.Spec.Sidecars = map[string]atroxyzv1alpha1.AppBundleSidecar{
+			"tail": {Image: &atroxyzv1alpha1.AppBundleImage{Repository: &repository, Tag: &tag}, Volumes: []string{"logs"}},
+		}
+		expectInvalidField("spec.sidecars[tail].volumes[0]")
+	})
+
+	It("Should reject a sidecar named after the app bundle", func() {
+		repository := "busybox"
+		tag := "stable"
+		ab.Spec.Sidecars = map[string]atroxyzv1alpha1.AppBundleSidecar{
+			ab.Name: {Image: &atroxyzv1alpha1.AppBundleImage{Repository: &repository, Tag: &tag}},
+		}
+		expectInvalidField("spec.sidecars[" + ab.Name + "]")
+	})
+
+	It("Should reject an init container named like a sidecar", func() {
+		repository := "busybox"
+		tag := "stable"
+		ab.Spec.Sidecars = map[string]atroxyzv1alpha1.AppBundleSidecar{
+			"setup": {Image: &atroxyzv1alpha1.AppBundleImage{Repository: &repository, Tag: &tag}},
+		}
+		ab.Spec.InitContainers = []atroxyzv1alpha1.AppBundleInitContainer{{Name: "setup"}}
+		expectInvalidField("spec.initContainers[0].name")
+	})
+
+	It("Should reject surge settings without a rolling update", func() {
+		maxSurge := intstr.FromInt32(1)
+		ab.Spec.Strategy = &atroxyzv1alpha1.AppBundleStrategy{MaxSurge: &maxSurge}
+		expectInvalidField("spec.strategy.maxSurge")
+	})
+
+	It("Should reject a rolling update that can not make progress", func() {
+		rollingUpdate := appsv1.RollingUpdateDeploymentStrategyType
+		zero := intstr.FromString("0%")
+		ab.Spec.Strategy = &atroxyzv1alpha1.AppBundleStrategy{Type: &rollingUpdate, MaxSurge: &zero, MaxUnavailable: &zero}
+		expectInvalidField("spec.strategy.maxUnavailable")
+	})
+
+	It("Should reject a toleration matching any value with a value", func() {
+		ab.Spec.Scheduling = &atroxyzv1alpha1.AppBundleScheduling{
+			Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists, Value: "media"}},
+		}
+		expectInvalidField("spec.scheduling.tolerations[0].value")
+	})
+
+	It("Should reject an accelerator that is not an extended resource", func() {
+		count := int64(1)
+		ab.Spec.Accelerators = map[string]atroxyzv1alpha1.AppBundleAccelerator{"gpu": {Count: &count}}
+		expectInvalidField("spec.accelerators[gpu]")
+	})
+
+	It("Should warn about UseNvidia being deprecated", func() {
+		useNvidia := true
+		ab.Spec.UseNvidia = &useNvidia
+		warnings, err := validator.ValidateCreate(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ContainElement(ContainSubstring("spec.accelerators")))
+	})
+
+	It("Should reject running as root with the restricted security preset", func() {
+		restricted := atroxyzv1alpha1.SecurityPresetRestricted
+		root := int64(0)
+		ab.Spec.Security = &atroxyzv1alpha1.AppBundleSecurity{Preset: &restricted, RunAsUser: &root}
+		expectInvalidField("spec.security.runAsUser")
+	})
+
+	It("Should require a user with the restricted security preset", func() {
+		restricted := atroxyzv1alpha1.SecurityPresetRestricted
+		ab.Spec.Security = &atroxyzv1alpha1.AppBundleSecurity{Preset: &restricted}
+		expectInvalidField("spec.security.runAsUser: Required value")
+	})
+
+	It("Should reject a host path volume with the baseline security preset", func() {
+		baseline := atroxyzv1alpha1.SecurityPresetBaseline
+		hostPath := "/var/run/docker.sock"
+		path := "/var/run/docker.sock"
+		ab.Spec.Security = &atroxyzv1alpha1.AppBundleSecurity{Preset: &baseline}
+		ab.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"docker": {HostPath: &hostPath, Path: &path}}
+		expectInvalidField("spec.volumes[docker].hostPath")
+	})
+
+	It("Should reject a role granting access to non-resource urls", func() {
+		ab.Spec.ServiceAccount = &atroxyzv1alpha1.AppBundleServiceAccount{
+			Rules: []rbacv1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}},
+		}
+		expectInvalidField("spec.serviceAccount.rules[0].nonResourceURLs")
+	})
+
+	It("Should reject cluster access unless the AtrokConfig allows it", func() {
+		ab.Spec.ServiceAccount = &atroxyzv1alpha1.AppBundleServiceAccount{
+			ClusterRules: []rbacv1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}},
+		}
+		expectInvalidField("spec.serviceAccount: Forbidden")
+	})
+
+	It("Should reject roles that are not bindable", func() {
+		ab.Spec.ServiceAccount = &atroxyzv1alpha1.AppBundleServiceAccount{
+			Roles: []atroxyzv1alpha1.AppBundleRoleRef{{Kind: "ClusterRole", Name: "cluster-admin"}},
+		}
+		expectInvalidField("spec.serviceAccount.roles[0].name: Forbidden")
+	})
+
+	It("Should accept roles the AtrokConfig lists as bindable", func() {
+		validator.ConfigName = "atrok"
+		validator.Client = NewFakeClient(&atroxyzv1alpha1.AtrokConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: validator.ConfigName},
+			Spec:       atroxyzv1alpha1.AtrokConfigSpec{BindableRoles: []string{"view"}},
+		})
+		ab.Spec.ServiceAccount = &atroxyzv1alpha1.AppBundleServiceAccount{
+			Roles: []atroxyzv1alpha1.AppBundleRoleRef{{Kind: "ClusterRole", Name: "view"}},
+		}
+
+		_, err := validator.ValidateCreate(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should reject rules the requesting user does not hold", func() {
+		validator.Client = NewReviewingFakeClient("admin")
+		ab.Spec.ServiceAccount = &atroxyzv1alpha1.AppBundleServiceAccount{
+			Rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+		}
+
+		_, err := validator.ValidateCreate(NewAdmissionContext("developer"), ab)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected an invalid error, got %v", err)
+		Expect(err.Error()).To(ContainSubstring("spec.serviceAccount.rules[0]: Forbidden: developer may not get secrets in namespace devel"))
+	})
+
+	It("Should accept rules the requesting user holds", func() {
+		validator.Client = NewReviewingFakeClient("admin")
+		ab.Spec.ServiceAccount = &atroxyzv1alpha1.AppBundleServiceAccount{
+			Rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+		}
+
+		_, err := validator.ValidateCreate(NewAdmissionContext("admin"), ab)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should reject an unparsable backup cron", func() {
+		frequency := "every day"
+		retain := 3
+		ab.Spec.Backup = &atroxyzv1alpha1.AppBundleVolumeLonghornBackup{Frequency: &frequency, Retain: &retain}
+		expectInvalidField("spec.backup.frequency")
+	})
+
+	It("Should accept a valid backup cron", func() {
+		frequency := "0 3 * * mon-fri"
+		retain := 3
+		ab.Spec.Backup = &atroxyzv1alpha1.AppBundleVolumeLonghornBackup{Frequency: &frequency, Retain: &retain}
+		_, err := validator.ValidateCreate(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should reject a sourced env without a source", func() {
+		ab.Spec.SourcedEnvs = map[string]atroxyzv1alpha1.AppBundleSourcedEnv{"TOKEN": {Key: "token"}}
+		expectInvalidField("spec.sourcedEnvs[TOKEN]")
+	})
+
+	It("Should reject configs with secrets but no secret store", func() {
+		ab.Spec.Configs = map[string]atroxyzv1alpha1.AppBundleConfig{"cfg": {FileName: "config.yaml", Secrets: map[string]string{"password": "remote/password"}}}
+		expectInvalidField("spec.secretStoreRef")
+	})
+
+	It("Should reject registry credentials but no secret store", func() {
+		ab.Spec.Image.Registry = &atroxyzv1alpha1.AppBundleImageRegistry{Server: "ghcr.io", Username: "ghcr/username", Password: "ghcr/token"}
+		expectInvalidField("spec.secretStoreRef")
+	})
+
+	It("Should reject pull secrets on the image of a sidecar", func() {
+		repository := "busybox"
+		tag := "stable"
+		ab.Spec.Sidecars = map[string]atroxyzv1alpha1.AppBundleSidecar{
+			"tail": {Image: &atroxyzv1alpha1.AppBundleImage{Repository: &repository, Tag: &tag, PullSecrets: []string{"ghcr"}}},
+		}
+		expectInvalidField("spec.sidecars[tail].image.pullSecrets")
+	})
+
+	It("Should reject a dangling base", func() {
+		base := "missing"
+		ab.Spec.Base = &base
+		expectInvalidField("spec.base")
+	})
+
+	It("Should validate the app bundle with its base merged in", func() {
+		By("Leaving the image to the base")
+		rep := "nginx"
+		tag := "latest"
+		abb := &atroxyzv1alpha1.AppBundleBase{
+			ObjectMeta: metav1.ObjectMeta{Name: "base"},
+			Spec:       atroxyzv1alpha1.AppBundleBaseSpec{Image: &atroxyzv1alpha1.AppBundleImage{Repository: &rep, Tag: &tag}},
+		}
+		validator.Client = NewFakeClient(abb)
+		ab.Spec.Image = nil
+		ab.Spec.Base = &abb.Name
+
+		_, err := validator.ValidateCreate(ctx, ab)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should let app bundles being deleted through", func() {
+		now := metav1.Now()
+		ab.Spec.Image = nil
+		ab.DeletionTimestamp = &now
+
+		_, err := validator.ValidateUpdate(ctx, ab, ab)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should let updates leaving the spec alone through", func() {
+		ab.Spec.Image = nil
+		updated := ab.DeepCopy()
+		updated.Finalizers = []string{"atro.xyz/cleanup"}
+
+		_, err := validator.ValidateUpdate(ctx, ab, updated)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should validate updates changing the spec", func() {
+		updated := ab.DeepCopy()
+		updated.Spec.Image = nil
+
+		_, err := validator.ValidateUpdate(ctx, ab, updated)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,66 @@
+package v1alpha1
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+	"github.com/atropos112/atrok/internal/controller"
+)
+
+// +kubebuilder:webhook:path=/validate-atro-xyz-v1alpha1-appbundlebase,mutating=false,failurePolicy=fail,sideEffects=None,groups=atro.xyz,resources=appbundlebases,verbs=create;update,versions=v1alpha1,name=vappbundlebase-v1alpha1.atro.xyz,admissionReviewVersions=v1
+
+// AppBundleBaseCustomValidator rejects app bundle bases with malformed values or a base that does not exist.
+type AppBundleBaseCustomValidator struct {
+	Client client.Client
+	// ConfigName is the name of the AtrokConfig the maximum depth of base chains is read from.
+	ConfigName string
+}
+
+// SetupAppBundleBaseWebhookWithManager registers the app bundle base webhooks with the manager.
+func SetupAppBundleBaseWebhookWithManager(mgr ctrl.Manager, configName string) error {
+	return ctrl.NewWebhookManagedBy(mgr, &atroxyzv1alpha1.AppBundleBase{}).
+		WithValidator(&AppBundleBaseCustomValidator{Client: mgr.GetClient(), ConfigName: configName}).
+		Complete()
+}
+
+func (v *AppBundleBaseCustomValidator) ValidateCreate(ctx context.Context, abb *atroxyzv1alpha1.AppBundleBase) (admission.Warnings, error) {
+	return deprecationWarnings(abb.Spec.UseNvidia), v.validate(ctx, abb)
+}
+
+func (v *AppBundleBaseCustomValidator) ValidateUpdate(ctx context.Context, oldAbb, newAbb *atroxyzv1alpha1.AppBundleBase) (admission.Warnings, error) {
+	if newAbb.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	return deprecationWarnings(newAbb.Spec.UseNvidia), v.validate(ctx, newAbb)
+}
+
+func (v *AppBundleBaseCustomValidator) ValidateDelete(ctx context.Context, abb *atroxyzv1alpha1.AppBundleBase) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *AppBundleBaseCustomValidator) validate(ctx context.Context, abb *atroxyzv1alpha1.AppBundleBase) error {
+	allErrs := abb.Validate()
+
+	// The chain is walked from the incoming spec so that a change introducing a cycle is caught
+	if abb.Spec.Base != nil {
+		cfg, err := (&controller.AppBundleReconciler{Client: v.Client, ConfigName: v.ConfigName}).GetAtrokConfig(ctx)
+		if err != nil {
+			return err
+		}
+
+		if _, err := controller.GetBaseChain(ctx, v.Client, abb, *cfg.MaxBaseDepth); err != nil {
+			chainErrs, err := baseChainErrors(*abb.Spec.Base, err)
+			if err != nil {
+				return err
+			}
+			allErrs = append(allErrs, chainErrs...)
+		}
+	}
+
+	return invalid("AppBundleBase", abb.Name, allErrs)
+}
@@ -0,0 +1,97 @@
+package v1alpha1
+
+// Test framework setup
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+var _ = Describe("AppBundleBase validating webhook", func() {
+	var abb *atroxyzv1alpha1.AppBundleBase
+	var validator *AppBundleBaseCustomValidator
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		abb = &atroxyzv1alpha1.AppBundleBase{ObjectMeta: metav1.ObjectMeta{Name: "base"}}
+		validator = &AppBundleBaseCustomValidator{Client: NewFakeClient()}
+	})
+
+	It("Should accept a base that leaves out required fields", func() {
+		path := "/data"
+		abb.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {Path: &path}}
+		_, err := validator.ValidateCreate(ctx, abb)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should reject malformed values", func() {
+		size := "lots"
+		abb.Spec.Volumes = map[string]atroxyzv1alpha1.AppBundleVolume{"data": {Size: &size}}
+		_, err := validator.ValidateCreate(ctx, abb)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.volumes[data].size"))
+	})
+
+	It("Should reject a merge strategy that does not fit the field", func() {
+		abb.Spec.Merge = &atroxyzv1alpha1.AppBundleMerge{
+			Strategies: map[string]atroxyzv1alpha1.MergeStrategy{"envs": atroxyzv1alpha1.MergeStrategyAppend},
+			Delete:     map[string][]string{"command": {"sh"}},
+		}
+		_, err := validator.ValidateCreate(ctx, abb)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.merge.strategies[envs]"))
+		Expect(err.Error()).To(ContainSubstring("spec.merge.delete[command]"))
+	})
+
+	It("Should reject a dangling base", func() {
+		base := "missing"
+		abb.Spec.Base = &base
+		_, err := validator.ValidateCreate(ctx, abb)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.base"))
+	})
+
+	It("Should reject a base referencing itself", func() {
+		abb.Spec.Base = &abb.Name
+		_, err := validator.ValidateCreate(ctx, abb)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("Should reject a change introducing a cycle", func() {
+		By("Having another base inherit from this one")
+		other := &atroxyzv1alpha1.AppBundleBase{
+			ObjectMeta: metav1.ObjectMeta{Name: "other"},
+			Spec:       atroxyzv1alpha1.AppBundleBaseSpec{Base: &abb.Name},
+		}
+		validator.Client = NewFakeClient(other)
+		abb.Spec.Base = &other.Name
+
+		_, err := validator.ValidateCreate(ctx, abb)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("base -> other -> base"))
+	})
+
+	It("Should reject a chain deeper than the configured maximum", func() {
+		By("Chaining bases deeper than allowed")
+		maxDepth := 2
+		first := "first"
+		second := "second"
+		validator.Client = NewFakeClient(
+			&atroxyzv1alpha1.AtrokConfig{ObjectMeta: metav1.ObjectMeta{Name: "atrok"}, Spec: atroxyzv1alpha1.AtrokConfigSpec{MaxBaseDepth: &maxDepth}},
+			&atroxyzv1alpha1.AppBundleBase{ObjectMeta: metav1.ObjectMeta{Name: first}, Spec: atroxyzv1alpha1.AppBundleBaseSpec{Base: &second}},
+			&atroxyzv1alpha1.AppBundleBase{ObjectMeta: metav1.ObjectMeta{Name: second}},
+		)
+		validator.ConfigName = "atrok"
+		abb.Spec.Base = &first
+
+		_, err := validator.ValidateCreate(ctx, abb)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("deeper than 2"))
+	})
+})
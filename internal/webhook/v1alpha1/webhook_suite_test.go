@@ -0,0 +1,71 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" //lint:ignore ST1001 we need to use ginkgo
+	. "github.com/onsi/gomega"    //lint:ignore ST1001 we need to use ginkgo
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	atroxyzv1alpha1 "github.com/atropos112/atrok/api/v1alpha1"
+)
+
+func TestWebhooks(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Webhook Suite")
+}
+
+// NewFakeClient returns a client backed by the given objects, the webhooks only read from it.
+func NewFakeClient(objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(atroxyzv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+// NewReviewingFakeClient returns a client backed by the given objects that answers subject access reviews, allowing everything to the given user only.
+func NewReviewingFakeClient(allowedUser string, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(atroxyzv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if review, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+				review.Status.Allowed = review.Spec.User == allowedUser
+				return nil
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}).Build()
+}
+
+// NewAdmissionContext returns a context holding an admission request made by the given user.
+func NewAdmissionContext(username string) context.Context {
+	return admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		UserInfo: authenticationv1.UserInfo{Username: username},
+	}})
+}
+
+func GetValidAppBundle() *atroxyzv1alpha1.AppBundle {
+	rep := "nginx"
+	tag := "latest"
+
+	return &atroxyzv1alpha1.AppBundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "devel"},
+		Spec: atroxyzv1alpha1.AppBundleSpec{
+			Image: &atroxyzv1alpha1.AppBundleImage{Repository: &rep, Tag: &tag},
+		},
+	}
+}
@@ -1,7 +0,0 @@
-package types
-
-type AppId interface {
-	ID() string
-	GetSpecHash() (string, error)
-	GetLastReconciliation() (bool, string)
-}